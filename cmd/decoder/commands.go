@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyneMMQT/decoder"
+)
+
+// runExplain - подкоманда explain: аннотированный разбор одной строки захвата
+func runExplain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	packetID := fs.String("id", "", "ID пакета (десятичный, 0x... или !...) для поиска в файле захвата")
+	lineNum := fs.Int("line", 0, "номер строки в файле захвата")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder explain \"<timestamp | topic | hex>\"")
+		fmt.Println("Или: ./decoder explain -id <packet_id> <raw_messages.txt>")
+		fmt.Println("Или: ./decoder explain -line <N> <raw_messages.txt>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	arg := fs.Arg(0)
+	if strings.Contains(arg, " | ") {
+		decoder.ExplainLine(os.Stdout, arg)
+		return
+	}
+	exitOnError(decoder.ExplainCapture(os.Stdout, arg, *packetID, *lineNum))
+}
+
+// runTopology - подкоманда topology: граф сети по соседям, traceroute и прямым приемам
+func runTopology(args []string) {
+	fs := flag.NewFlagSet("topology", flag.ExitOnError)
+	output := fs.String("o", "topology", "префикс выходных файлов (.dot, .graphml, .geojson, _nodes.csv)")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder topology [-o prefix] <raw_messages.txt>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	exitOnError(decoder.WriteTopology(fs.Arg(0), *output))
+}
+
+// runTracks - подкоманда tracks: треки узлов в GPX, KML и GeoJSON
+func runTracks(args []string) {
+	fs := flag.NewFlagSet("tracks", flag.ExitOnError)
+	output := fs.String("o", "tracks", "префикс выходных файлов (.gpx, .kml, .geojson)")
+	var opts decoder.TrackOptions
+	fs.StringVar(&opts.Nodes, "node", "", "узлы через запятую (!xxxxxxxx или десятичный номер), по умолчанию все")
+	fs.StringVar(&opts.From, "from", "", "начало интервала (2006-01-02 15:04:05 или RFC3339)")
+	fs.StringVar(&opts.To, "to", "", "конец интервала")
+	fs.IntVar(&opts.MinPrecision, "min-precision", 0, "пропускать позиции с precision_bits меньше заданного")
+	tz := fs.String("tz", "", "часовой пояс меток времени захвата и границ интервала")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder tracks [-o prefix] [-node !id,...] [-from t] [-to t] <raw_messages.txt>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	setTimezone(*tz)
+	exitOnError(decoder.WriteTracks(fs.Arg(0), *output, opts))
+}
+
+// runLOS - подкоманда los: профиль рельефа, зона Френеля и прогноз SNR между двумя точками
+func runLOS(args []string) {
+	fs := flag.NewFlagSet("los", flag.ExitOnError)
+	var opts decoder.LOSOptions
+	fs.StringVar(&opts.DEMDir, "dem", "", "каталог с тайлами SRTM .hgt (N64E040.hgt и т.д.)")
+	fs.StringVar(&opts.CapturePath, "capture", "", "файл захвата для позиций, региона, пресета и наблюдаемого SNR узлов")
+	fs.Float64Var(&opts.HeightA, "ha", 2, "высота антенны первого узла над землей, м")
+	fs.Float64Var(&opts.HeightB, "hb", 2, "высота антенны второго узла над землей, м")
+	fs.StringVar(&opts.Region, "region", "", "регион (RU, EU_868...), по умолчанию из MapReport узла или RU")
+	fs.StringVar(&opts.Preset, "preset", "", "пресет (LONG_FAST...), по умолчанию из MapReport узла или LONG_FAST")
+	fs.StringVar(&opts.Channel, "channel", "", "имя канала для выбора частотного слота, по умолчанию имя пресета")
+	fs.Float64Var(&opts.Frequency, "freq", 0, "частота в МГц вместо расчетной по региону и каналу")
+	fs.Float64Var(&opts.TxPower, "tx-power", 0, "мощность передатчика, дБм (по умолчанию предел региона, не больше 22)")
+	fs.Float64Var(&opts.Gain, "gain", 2, "усиление каждой антенны, дБи")
+	fs.Float64Var(&opts.Step, "step", 30, "шаг профиля, м")
+	fs.StringVar(&opts.ProfilePath, "o", "", "CSV файл профиля рельефа")
+	tz := fs.String("tz", "", "часовой пояс меток времени захвата")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder los -dem <каталог> [-capture raw_messages.txt] <узел|lat,lon> <узел|lat,lon>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 || opts.DEMDir == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	setTimezone(*tz)
+	exitOnError(decoder.PredictLOS(fs.Arg(0), fs.Arg(1), opts))
+}
+
+// runServe - подкоманда serve: HTTP API поверх файла захвата
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "адрес HTTP сервера")
+	maxPackets := fs.Int("max-packets", decoder.DefaultStorePackets, "сколько последних пакетов держать в памяти")
+	tz := fs.String("tz", "", "часовой пояс меток времени захвата и параметров since/until")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder serve [-listen addr] <raw_messages.txt>")
+		fmt.Println("Эндпоинты: /api/nodes, /api/nodes/{id}, /api/nodes/{id}/history, /api/channels, /api/messages, /api/packets/{id}")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	setTimezone(*tz)
+	exitOnError(decoder.ServeCapture(fs.Arg(0), *listen, *maxPackets))
+}
+
+// runAlertSink - подкоманда alert-sink: локальный приемник webhook для проверки оповещений
+func runAlertSink(args []string) {
+	fs := flag.NewFlagSet("alert-sink", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8089", "адрес HTTP сервера")
+	output := fs.String("o", "", "файл для записи полученных оповещений (JSON по строке)")
+	status := fs.Int("status", http.StatusNoContent, "код ответа (например 500 для проверки ошибок доставки)")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder alert-sink [флаги]")
+		fmt.Println("Локальный приемник webhook: в файле правил укажите \"url\": \"http://127.0.0.1:8089/\"")
+		fmt.Println("Флаги:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	exitOnError(decoder.ServeAlertSink(*listen, *output, *status))
+}
+
+// runSend - подкоманда send: публикует текстовое сообщение в сеть через MQTT
+func runSend(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	var mqttOpts decoder.MQTTOptions
+	fs.StringVar(&mqttOpts.Broker, "broker", "tcp://mqtt.skobk.in:1883", "адрес MQTT брокера")
+	fs.StringVar(&mqttOpts.User, "user", os.Getenv("MQTT_USER"), "пользователь MQTT (по умолчанию $MQTT_USER)")
+	fs.StringVar(&mqttOpts.Password, "password", os.Getenv("MQTT_PASSWORD"), "пароль MQTT (по умолчанию $MQTT_PASSWORD)")
+	fs.DurationVar(&mqttOpts.Timeout, "timeout", 10*time.Second, "таймаут подключения и публикации")
+	region := fs.String("region", "RU/ARKH", "часть топика после msh/: msh/<region>/2/e/<channel>/<gateway>")
+	channel := fs.String("channel", "LongFast", "имя канала")
+	psk := fs.String("psk", "default", "ключ канала: default, none, simpleN, base64 или 0x...")
+	gateway := fs.String("gateway", "", "ID узла-шлюза, от имени которого отправляется сообщение (!xxxxxxxx)")
+	to := fs.String("to", "^all", "получатель личного сообщения (!xxxxxxxx), по умолчанию всем в канале")
+	replyID := fs.String("reply-id", "", "id пакета, на который отвечает сообщение (десятичный или 0x...)")
+	hopLimit := fs.Uint("hop-limit", 3, "число ретрансляций (1-7)")
+	wantAck := fs.Bool("want-ack", false, "запросить подтверждение доставки")
+	dryRun := fs.Bool("dry-run", false, "только показать топик и пакет, не публиковать")
+	fs.Usage = func() {
+		fmt.Println("Использование: ./decoder send -gateway !xxxxxxxx [флаги] <текст>")
+		fmt.Println("Флаги:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || *gateway == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	msg := decoder.TextMessage{
+		Channel:  *channel,
+		Text:     strings.Join(fs.Args(), " "),
+		HopLimit: uint32(*hopLimit),
+		WantAck:  *wantAck,
+	}
+	var err error
+	if msg.From, err = decoder.ParseNodeID(*gateway); err != nil || msg.From == decoder.BroadcastAddr {
+		exitOnError(fmt.Errorf("неверный ID шлюза %q", *gateway))
+	}
+	msg.To, err = decoder.ParseNodeID(*to)
+	exitOnError(err)
+	if *replyID != "" {
+		id, err := strconv.ParseUint(*replyID, 0, 32)
+		if err != nil {
+			exitOnError(fmt.Errorf("неверный reply-id %q", *replyID))
+		}
+		msg.ReplyID = uint32(id)
+	}
+	msg.PSK, err = decoder.ParsePSK(*psk)
+	exitOnError(err)
+
+	payload, id, err := decoder.EncodeTextMessage(msg)
+	if err != nil {
+		exitOnError(fmt.Errorf("ошибка сборки пакета: %w", err))
+	}
+	topic := decoder.DownlinkTopic(*region, *channel, msg.From)
+	if *dryRun {
+		fmt.Printf("Топик: %s\nПакет: %d (0x%08x)\n%s\n", topic, id, id, hex.EncodeToString(payload))
+		return
+	}
+
+	exitOnError(decoder.PublishMQTT(mqttOpts, topic, payload))
+	fmt.Printf("Отправлено в %s: пакет %d (0x%08x) от !%08x к !%08x\n", topic, id, id, msg.From, msg.To)
+}
@@ -7,7 +7,8 @@ import (
 	"github.com/joho/godotenv"
 )
 
-func init() {
+// loadConfig читает параметры подключения к брокеру из .env в корне репозитория
+func loadConfig() {
 	err := godotenv.Load("../../.env")
 	if err != nil {
 		log.Fatal("Error loading .env file")
@@ -1,45 +1,37 @@
 package main
 
 import (
-	"encoding/hex"
 	"log"
-	"os"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// writer - очередь записи в raw_messages.txt, создается в main
+var writer *rawWriter
+
 var MessageHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
+	now := time.Now()
 	// Сохраняем сырые данные в файл
-	saveRawData(msg.Topic(), msg.Payload())
+	writer.Write(now, msg.Topic(), msg.Payload())
+	if live != nil {
+		live.Handle(msg.Topic(), msg.Payload(), now)
+	}
 
-	log.Printf("Saved message from topic: %s", msg.Topic())
+	// С панелью каждое сообщение и так видно в ленте пакетов
+	if dash == nil {
+		log.Printf("Saved message from topic: %s", msg.Topic())
+	}
 }
 
 var ConnectHandler mqtt.OnConnectHandler = func(client mqtt.Client) {
+	metrics.Connected()
+	dash.Connected()
 	log.Println("Connected to MQTT broker")
 }
 
 var ConnectionLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
+	metrics.ConnectionLost()
+	dash.ConnectionLost(err)
 	log.Printf("Connection lost: %v", err)
 }
-
-func saveRawData(topic string, payload []byte) {
-	timestamp := time.Now().Format("01.02.2006 15:04:05")
-	filename := "raw_messages.txt"
-
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Printf("Error opening file: %v", err)
-		return
-	}
-	defer file.Close()
-
-	// Сохраняем в формате: timestamp | topic | hex_data
-	hexData := hex.EncodeToString(payload)
-	line := timestamp + " | " + topic + " | " + hexData + "\n"
-
-	if _, err := file.WriteString(line); err != nil {
-		log.Printf("Error writing to file: %v", err)
-	}
-}
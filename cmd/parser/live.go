@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"fyneMMQT/decoder"
+)
+
+// liveDecoder декодирует сообщения на лету для метрик, HTTP API, потока WebSocket,
+// терминальной панели и событий сборщика (геозоны)
+type liveDecoder struct {
+	mu     sync.Mutex
+	fences *decoder.GeofenceTracker
+	store  *decoder.Store
+	stream *decoder.StreamHub
+}
+
+// live - включается флагами командной строки, nil если декодирование не нужно
+var live *liveDecoder
+
+// Handle разбирает сообщение, обновляет метрики, проверяет геозоны и передает запись
+// хранилищу, потоку и панели. События геозон пишутся в лог и попадают в хранилище.
+func (d *liveDecoder) Handle(topic string, payload []byte, at time.Time) {
+	record := decoder.DecodeMessage(decoder.CaptureTimestamp(at), topic, payload)
+	metrics.Observe(&record, at)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Геозоны проверяются первыми, чтобы запись в хранилище и потоке несла колонку GeofenceEvents
+	var events []decoder.GeofenceEvent
+	if d.fences != nil {
+		events = d.fences.Observe(&record)
+		for _, event := range events {
+			log.Printf("Geofence: %s", event)
+		}
+	}
+	if d.store != nil {
+		d.store.Add(record)
+		d.store.HandleGeofence(events)
+	}
+	if d.stream != nil {
+		d.stream.PublishRecord(&record)
+	}
+	dash.Observe(&record, at)
+}
+
+// Как часто проверять замолчавшие узлы
+const presenceCheckInterval = 30 * time.Second
+
+// advancePresence переводит замолчавшие узлы в stale и offline и проверяет правила
+// оповещений offline, не дожидаясь пакетов
+func (d *liveDecoder) advancePresence() {
+	ticker := time.NewTicker(presenceCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		d.store.Advance(now)
+	}
+}
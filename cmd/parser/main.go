@@ -1,16 +1,121 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"fyneMMQT/decoder"
 )
 
 func main() {
+	geofenceFile := flag.String("geofence", "", "GeoJSON файл геозон: события входа и выхода узлов пишутся в лог, отдаются в /api/geofence и потоке WebSocket")
+	geofenceHysteresis := flag.Float64("geofence-hysteresis", 25, "запас от границы геозоны в метрах сверх неопределенности позиции")
+	alertsFile := flag.String("alerts", "", "JSON файл правил оповещений (формат как у ./decoder -alerts)")
+	metricsAddr := flag.String("metrics", "", "адрес HTTP сервера метрик Prometheus (например :9464), отдаются по /metrics")
+	metricsMaxSeries := flag.Int("metrics-max-series", 1000, "лимит комбинаций topic/gateway/portnum, остальное считается в серии \"other\"")
+	metricsMaxNodes := flag.Int("metrics-max-nodes", 500, "лимит узлов с отдельными метриками")
+	apiAddr := flag.String("api", "", "адрес HTTP API узлов, сообщений и пакетов (например :8080), эндпоинты /api/...")
+	apiMaxPackets := flag.Int("api-max-packets", decoder.DefaultStorePackets, "сколько последних пакетов держать в памяти для API")
+	wsAddr := flag.String("ws", "", "адрес WebSocket потока пакетов и состояний узлов (например :8080), путь /ws")
+	wsBuffer := flag.Int("ws-buffer", decoder.DefaultStreamBuffer, "буфер сообщений на клиента WebSocket, при переполнении сообщения отбрасываются")
+	wsAllowOrigin := flag.String("ws-allow-origin", "", "через запятую Origin страниц с других адресов, которым разрешен поток WebSocket, * - любым; по умолчанию только тот же адрес")
+	uiAddr := flag.String("ui", "", "адрес веб-интерфейса с картой узлов и чатом (например :8080), включает API и поток WebSocket на этом адресе")
+	uiMap := flag.String("ui-map", "", "картинка подложки карты веб-интерфейса (PNG, JPEG), по умолчанию только координатная сетка")
+	uiMapBounds := flag.String("ui-map-bounds", "", "границы подложки карты: lat1,lon1,lat2,lon2")
+	tui := flag.Bool("tui", false, "полноэкранная панель в терминале: пакеты, узлы, чат и состояние подключения")
+	flag.Parse()
+	loadConfig()
+
+	var err error
+	writer, err = newRawWriter("raw_messages.txt")
+	if err != nil {
+		fmt.Printf("❌ Ошибка открытия файла: %v\n", err)
+		return
+	}
+	defer writer.Close()
+
+	if *metricsAddr != "" {
+		metrics = newCollectorMetrics(*metricsMaxSeries, *metricsMaxNodes, writer)
+		httpHandle(*metricsAddr, "/metrics", metrics)
+		fmt.Printf("📈 Метрики Prometheus: http://%s/metrics\n", *metricsAddr)
+		live = &liveDecoder{}
+	}
+
+	// Хранилище ведет состояние узлов для API, переходов в потоке WebSocket и оповещений
+	if *apiAddr != "" || *wsAddr != "" || *uiAddr != "" || *alertsFile != "" {
+		if live == nil {
+			live = &liveDecoder{}
+		}
+		live.store = decoder.NewStore(*apiMaxPackets)
+		live.store.Now = time.Now
+	}
+	if *alertsFile != "" {
+		alerts, err := decoder.LoadAlertEngine(*alertsFile)
+		if err != nil {
+			fmt.Printf("❌ Ошибка загрузки правил оповещений: %v\n", err)
+			return
+		}
+		live.store.SetAlerts(alerts)
+		fmt.Printf("🔔 Правила оповещений: %s\n", *alertsFile)
+	}
+	if *apiAddr != "" {
+		httpHandle(*apiAddr, "/api/", live.store.Handler())
+		fmt.Printf("🌐 HTTP API: http://%s/api/nodes\n", *apiAddr)
+	}
+	if *wsAddr != "" || *uiAddr != "" {
+		live.stream = decoder.NewStreamHub(*wsBuffer)
+		if *wsAllowOrigin != "" {
+			live.stream.AllowedOrigins = strings.Split(*wsAllowOrigin, ",")
+		}
+		live.store.OnPresence = live.stream.PublishPresence
+		live.store.OnGeofence = live.stream.PublishGeofence
+	}
+	if *wsAddr != "" {
+		httpHandle(*wsAddr, "/ws", live.stream)
+		fmt.Printf("📺 Поток WebSocket: ws://%s/ws\n", *wsAddr)
+	}
+	if *uiAddr != "" {
+		ui, err := newUIHandler(*uiMap, *uiMapBounds)
+		if err != nil {
+			fmt.Printf("❌ Ошибка настройки веб-интерфейса: %v\n", err)
+			return
+		}
+		httpHandle(*uiAddr, "/", ui)
+		httpHandle(*uiAddr, "/api/", live.store.Handler())
+		httpHandle(*uiAddr, "/ws", live.stream)
+		fmt.Printf("🗺️ Веб-интерфейс: http://%s/\n", *uiAddr)
+	}
+	if live != nil && live.store != nil {
+		go live.advancePresence()
+	}
+
+	if *tui {
+		dash = newDashboard(os.Stdout)
+		if live == nil {
+			live = &liveDecoder{}
+		}
+	}
+
+	if *geofenceFile != "" {
+		fences, err := decoder.LoadGeofences(*geofenceFile, *geofenceHysteresis)
+		if err != nil {
+			fmt.Printf("❌ Ошибка загрузки геозон: %v\n", err)
+			return
+		}
+		if live == nil {
+			live = &liveDecoder{}
+		}
+		live.fences = fences
+	}
+	startHTTPServers()
+
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker("tcp://mqtt.skobk.in:1883")
 	opts.SetClientID("go_mqtt_client_" + fmt.Sprint(time.Now().Unix()))
@@ -48,7 +153,19 @@ func main() {
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	var quit <-chan struct{}
+	if dash != nil {
+		if err := dash.Start(); err != nil {
+			fmt.Printf("❌ Ошибка запуска панели: %v\n", err)
+			return
+		}
+		quit = dash.Done()
+	}
+	select {
+	case <-sigChan:
+	case <-quit:
+	}
+	dash.Stop()
 
 	fmt.Println("\n🛑 Завершение работы...")
 	client.Unsubscribe(topic)
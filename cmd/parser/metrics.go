@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyneMMQT/decoder"
+)
+
+// Сводная серия, в которую попадают сообщения сверх лимита комбинаций меток
+const overflowLabel = "other"
+
+type messageLabels struct {
+	Topic, Gateway, Portnum string
+}
+
+// nodeGauges - последние показания узла
+type nodeGauges struct {
+	Name               string
+	Battery            float64
+	Voltage            float64
+	ChannelUtilization float64
+	LastHeard          time.Time
+	hasBattery         bool
+	hasVoltage         bool
+	hasChannelUtil     bool
+}
+
+// collectorMetrics считает метрики сборщика для Prometheus. Число серий сообщений
+// и узлов ограничено, чтобы случайный поток мусорных топиков или узлов не раздул
+// базу Prometheus. Методы допускают nil получатель - тогда метрики выключены.
+type collectorMetrics struct {
+	mu        sync.Mutex
+	maxSeries int
+	maxNodes  int
+
+	messages      map[messageLabels]uint64
+	decodeErrors  uint64
+	decryptErrors uint64
+	droppedSeries uint64
+	droppedNodes  uint64
+	nodes         map[string]*nodeGauges
+
+	connects       uint64
+	connectionLost uint64
+	connected      bool
+	connectedSince time.Time
+	writer         *rawWriter
+}
+
+// metrics - nil если флаг -metrics не задан
+var metrics *collectorMetrics
+
+func newCollectorMetrics(maxSeries, maxNodes int, writer *rawWriter) *collectorMetrics {
+	return &collectorMetrics{
+		maxSeries: maxSeries,
+		maxNodes:  maxNodes,
+		messages:  make(map[messageLabels]uint64),
+		nodes:     make(map[string]*nodeGauges),
+		writer:    writer,
+	}
+}
+
+// Connected отмечает успешное подключение к брокеру (первое или после обрыва)
+func (m *collectorMetrics) Connected() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connects++
+	m.connected = true
+	m.connectedSince = time.Now()
+}
+
+// ConnectionLost отмечает обрыв соединения
+func (m *collectorMetrics) ConnectionLost() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connectionLost++
+	m.connected = false
+}
+
+// Observe учитывает декодированное сообщение
+func (m *collectorMetrics) Observe(record *decoder.CSVRecord, at time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := messageLabels{Topic: topicRoot(record.Topic), Gateway: record.GatewayID, Portnum: record.PortnumName}
+	if labels.Portnum == "" {
+		labels.Portnum = strings.ToUpper(record.PayloadType)
+	}
+	if _, ok := m.messages[labels]; !ok && len(m.messages) >= m.maxSeries {
+		m.droppedSeries++
+		labels = messageLabels{overflowLabel, overflowLabel, overflowLabel}
+	}
+	m.messages[labels]++
+
+	if record.Error != "" {
+		m.decodeErrors++
+	}
+	// Пакет остался зашифрованным - ни один ключ не подошел
+	if record.PayloadType == "Encrypted" {
+		m.decryptErrors++
+	}
+
+	if record.From == "" || record.From == "0" {
+		return
+	}
+	node := decoder.NodeIDFromString(record.From)
+	n := m.nodes[node]
+	if n == nil {
+		if len(m.nodes) >= m.maxNodes {
+			m.droppedNodes++
+			return
+		}
+		n = &nodeGauges{}
+		m.nodes[node] = n
+	}
+	n.LastHeard = at
+	if record.UserLongName != "" {
+		n.Name = record.UserLongName
+	} else if record.MapLongName != "" && n.Name == "" {
+		n.Name = record.MapLongName
+	}
+	if v, err := strconv.ParseFloat(record.BatteryLevel, 64); err == nil {
+		n.Battery, n.hasBattery = v, true
+	}
+	if v, err := strconv.ParseFloat(record.Voltage, 64); err == nil {
+		n.Voltage, n.hasVoltage = v, true
+	}
+	if v, err := strconv.ParseFloat(record.ChannelUtilization, 64); err == nil {
+		n.ChannelUtilization, n.hasChannelUtil = v, true
+	}
+}
+
+// topicRoot убирает из топика последний сегмент с ID шлюза: msh/RU/ARKH/2/e/LongFast/!abcd -> msh/RU/ARKH/2/e/LongFast
+func topicRoot(topic string) string {
+	if i := strings.LastIndex(topic, "/"); i >= 0 && strings.HasPrefix(topic[i+1:], "!") {
+		return topic[:i]
+	}
+	return topic
+}
+
+// ServeHTTP отдает метрики в текстовом формате Prometheus
+func (m *collectorMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.write(w)
+}
+
+func (m *collectorMetrics) write(w io.Writer) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("meshtastic_messages_total", "counter", "Messages received per topic, gateway and portnum.")
+	keys := make([]messageLabels, 0, len(m.messages))
+	for k := range m.messages {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		if a.Gateway != b.Gateway {
+			return a.Gateway < b.Gateway
+		}
+		return a.Portnum < b.Portnum
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "meshtastic_messages_total{topic=%s,gateway=%s,portnum=%s} %d\n",
+			labelValue(k.Topic), labelValue(k.Gateway), labelValue(k.Portnum), m.messages[k])
+	}
+
+	metric("meshtastic_decode_errors_total", "counter", "Messages that failed to decode.")
+	fmt.Fprintf(w, "meshtastic_decode_errors_total %d\n", m.decodeErrors)
+	metric("meshtastic_decrypt_errors_total", "counter", "Encrypted packets no known key could decrypt.")
+	fmt.Fprintf(w, "meshtastic_decrypt_errors_total %d\n", m.decryptErrors)
+	metric("meshtastic_dropped_series_total", "counter", "Messages counted in the overflow series because of the label cardinality limit.")
+	fmt.Fprintf(w, "meshtastic_dropped_series_total %d\n", m.droppedSeries)
+	metric("meshtastic_dropped_nodes_total", "counter", "Packets from nodes not tracked because of the node limit.")
+	fmt.Fprintf(w, "meshtastic_dropped_nodes_total %d\n", m.droppedNodes)
+
+	metric("mqtt_connected", "gauge", "1 if the collector is connected to the broker.")
+	fmt.Fprintf(w, "mqtt_connected %d\n", boolValue(m.connected))
+	metric("mqtt_reconnects_total", "counter", "Successful reconnects after the first connection.")
+	fmt.Fprintf(w, "mqtt_reconnects_total %d\n", max(m.connects, 1)-1)
+	metric("mqtt_connection_lost_total", "counter", "Connection losses.")
+	fmt.Fprintf(w, "mqtt_connection_lost_total %d\n", m.connectionLost)
+	if m.connected {
+		metric("mqtt_connected_since_timestamp_seconds", "gauge", "Time of the current connection.")
+		fmt.Fprintf(w, "mqtt_connected_since_timestamp_seconds %d\n", m.connectedSince.Unix())
+	}
+
+	if m.writer != nil {
+		metric("collector_writer_queue_depth", "gauge", "Messages waiting to be written to disk.")
+		fmt.Fprintf(w, "collector_writer_queue_depth %d\n", m.writer.QueueDepth())
+		metric("collector_writer_queue_capacity", "gauge", "Capacity of the writer queue.")
+		fmt.Fprintf(w, "collector_writer_queue_capacity %d\n", writerQueueSize)
+		metric("collector_bytes_written_total", "counter", "Bytes written to the raw messages file.")
+		fmt.Fprintf(w, "collector_bytes_written_total %d\n", m.writer.bytes.Load())
+		metric("collector_write_errors_total", "counter", "Failed writes to the raw messages file.")
+		fmt.Fprintf(w, "collector_write_errors_total %d\n", m.writer.errors.Load())
+		metric("collector_writer_dropped_lines_total", "counter", "Messages dropped because the writer queue was full.")
+		fmt.Fprintf(w, "collector_writer_dropped_lines_total %d\n", m.writer.dropped.Load())
+	}
+
+	nodes := make([]string, 0, len(m.nodes))
+	for node := range m.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	gauge := func(name, help string, value func(n *nodeGauges) (float64, bool)) {
+		metric(name, "gauge", help)
+		for _, node := range nodes {
+			if v, ok := value(m.nodes[node]); ok {
+				fmt.Fprintf(w, "%s{node=%s} %s\n", name, labelValue(node), strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	metric("meshtastic_node_info", "gauge", "Node names, value is always 1.")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "meshtastic_node_info{node=%s,name=%s} 1\n", labelValue(node), labelValue(m.nodes[node].Name))
+	}
+	gauge("meshtastic_node_battery_level", "Last reported battery level, percent (101 means external power).",
+		func(n *nodeGauges) (float64, bool) { return n.Battery, n.hasBattery })
+	gauge("meshtastic_node_voltage", "Last reported battery voltage, volts.",
+		func(n *nodeGauges) (float64, bool) { return n.Voltage, n.hasVoltage })
+	gauge("meshtastic_node_channel_utilization", "Last reported channel utilization, percent.",
+		func(n *nodeGauges) (float64, bool) { return n.ChannelUtilization, n.hasChannelUtil })
+	gauge("meshtastic_node_last_heard_timestamp_seconds", "Time the last packet from the node was received.",
+		func(n *nodeGauges) (float64, bool) { return float64(n.LastHeard.Unix()), true })
+}
+
+// labelValue экранирует значение метки по правилам текстового формата Prometheus
+func labelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// httpMuxes - HTTP серверы сборщика по адресам. Метрики, API и поток могут
+// слушать один адрес, тогда их пути обслуживает общий mux.
+var httpMuxes = make(map[string]*http.ServeMux)
+
+// httpPatterns - уже зарегистрированные пути по адресам
+var httpPatterns = make(map[string]bool)
+
+// httpMux возвращает mux для адреса, создавая его при первом обращении
+func httpMux(addr string) *http.ServeMux {
+	mux, ok := httpMuxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		httpMuxes[addr] = mux
+	}
+	return mux
+}
+
+// httpHandle регистрирует обработчик на адресе. Повторная регистрация того же пути
+// (например, -ui и -api на одном адресе) пропускается - ServeMux на нее паникует.
+func httpHandle(addr, pattern string, handler http.Handler) {
+	key := addr + " " + pattern
+	if httpPatterns[key] {
+		return
+	}
+	httpPatterns[key] = true
+	httpMux(addr).Handle(pattern, handler)
+}
+
+// startHTTPServers запускает серверы для всех зарегистрированных адресов
+func startHTTPServers() {
+	for addr, mux := range httpMuxes {
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Printf("HTTP server %s error: %v", addr, err)
+			}
+		}()
+	}
+}
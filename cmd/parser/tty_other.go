@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func enterRawMode() (restore func(), err error) {
+	return nil, errors.New("терминальный режим поддерживается только в Unix")
+}
+
+func terminalSize() (width, height int, err error) {
+	return 80, 24, nil
+}
+
+func notifyResize(ch chan<- os.Signal) {}
@@ -0,0 +1,820 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"fyneMMQT/decoder"
+)
+
+// Сколько пакетов и сообщений чата держит панель
+const (
+	dashboardPackets  = 2000
+	dashboardMessages = 500
+	// Копии пакета через другие шлюзы в этом окне помечаются как повторы
+	dashboardDupWindow = time.Minute
+)
+
+// Панели, между которыми переключается Tab
+const (
+	paneNodes = iota
+	paneChat
+	panePackets
+	paneCount
+)
+
+// ANSI последовательности
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+)
+
+type dashboardPacket struct {
+	At        time.Time
+	Gateway   string
+	From      string
+	FromName  string
+	Portnum   string
+	Channel   string
+	Hops      string
+	SNR       string
+	Summary   string
+	Error     bool
+	Duplicate bool
+}
+
+type dashboardNode struct {
+	ID        string
+	Name      string
+	ShortName string
+	Hops      string
+	SNR       string
+	Battery   string
+	LastHeard time.Time
+	Packets   int
+}
+
+type dashboardMessage struct {
+	At       time.Time
+	From     string
+	FromName string
+	To       string
+	Text     string
+}
+
+// dashboard - полноэкранная панель сборщика на ANSI последовательностях: пакеты,
+// таблица узлов, чат по каналам и состояние подключения. Работает в любом терминале,
+// в том числе по SSH. Методы допускают nil получатель - тогда панель выключена.
+type dashboard struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	packets  []dashboardPacket
+	nodes    map[string]*dashboardNode
+	messages map[string][]dashboardMessage
+	seen     map[string]time.Time
+	total    int
+
+	connected      bool
+	connectedSince time.Time
+	connectionLost int
+	lastError      string
+	logLine        string
+
+	width, height int
+	focus         int
+	nodeCursor    int
+	nodeTop       int
+	chatScroll    int
+	packetScroll  int
+	channel       string
+	filter        string
+	editing       bool
+	dirty         bool
+
+	restore func()
+	done    chan struct{}
+	stop    sync.Once
+}
+
+// dash - nil если флаг -tui не задан
+var dash *dashboard
+
+func newDashboard(out io.Writer) *dashboard {
+	return &dashboard{
+		out:      out,
+		nodes:    make(map[string]*dashboardNode),
+		messages: make(map[string][]dashboardMessage),
+		seen:     make(map[string]time.Time),
+		width:    80,
+		height:   24,
+		done:     make(chan struct{}),
+	}
+}
+
+// Connected отмечает подключение к брокеру
+func (d *dashboard) Connected() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connected = true
+	d.connectedSince = time.Now()
+	d.dirty = true
+}
+
+// ConnectionLost отмечает обрыв соединения
+func (d *dashboard) ConnectionLost(err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connected = false
+	d.connectionLost++
+	d.lastError = err.Error()
+	d.dirty = true
+}
+
+// Write принимает вывод log, пока панель занимает экран: последняя строка
+// показывается внизу
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logLine = strings.TrimSpace(string(p))
+	d.dirty = true
+	return len(p), nil
+}
+
+// Observe добавляет декодированное сообщение в панели
+func (d *dashboard) Observe(record *decoder.CSVRecord, at time.Time) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.total++
+	d.dirty = true
+
+	packet := dashboardPacket{
+		At: at, Gateway: record.GatewayID, Portnum: record.PortnumName, Channel: record.ChannelID,
+		Hops: record.HopsAway, SNR: record.RxSNR, Summary: packetSummary(record), Error: record.Error != "",
+	}
+	if packet.Portnum == "" {
+		packet.Portnum = strings.ToUpper(record.PayloadType)
+	}
+
+	var node *dashboardNode
+	if record.From != "" && record.From != "0" {
+		packet.From = decoder.NodeIDFromString(record.From)
+		node = d.nodes[packet.From]
+		if node == nil {
+			node = &dashboardNode{ID: packet.From}
+			d.nodes[packet.From] = node
+		}
+		node.LastHeard = at
+		node.Packets++
+		node.Name = firstNonEmpty(record.UserLongName, record.MapLongName, node.Name)
+		node.ShortName = firstNonEmpty(record.UserShortName, record.MapShortName, node.ShortName)
+		if record.HopsAway != "" {
+			node.Hops = record.HopsAway
+			// SNR имеет смысл только для пакетов, услышанных шлюзом напрямую
+			if record.HopsAway == "0" && record.RxSNR != "" {
+				node.SNR = record.RxSNR
+			}
+		}
+		if record.BatteryLevel != "" {
+			node.Battery = record.BatteryLevel
+		}
+		packet.FromName = node.Name
+	}
+
+	if record.PacketID != "" && record.PacketID != "0" {
+		key := packet.From + "|" + record.PacketID
+		if seen, ok := d.seen[key]; ok && at.Sub(seen) < dashboardDupWindow {
+			packet.Duplicate = true
+		} else {
+			d.seen[key] = at
+		}
+		if len(d.seen) > 4*dashboardPackets {
+			for key, seen := range d.seen {
+				if at.Sub(seen) >= dashboardDupWindow {
+					delete(d.seen, key)
+				}
+			}
+		}
+	}
+
+	d.packets = append(d.packets, packet)
+	if len(d.packets) > dashboardPackets {
+		d.packets = append(d.packets[:0], d.packets[len(d.packets)-dashboardPackets:]...)
+	}
+	if d.packetScroll > 0 {
+		// Прокрученный список стоит на месте, пока приходят новые пакеты
+		d.packetScroll++
+	}
+
+	if record.TextMessage != "" && !packet.Duplicate {
+		message := dashboardMessage{At: at, From: packet.From, FromName: packet.FromName, Text: record.TextMessage}
+		if record.To != "" {
+			message.To = decoder.NodeIDFromString(record.To)
+		}
+		list := append(d.messages[record.ChannelID], message)
+		if len(list) > dashboardMessages {
+			list = list[len(list)-dashboardMessages:]
+		}
+		d.messages[record.ChannelID] = list
+		if d.channel == "" {
+			d.channel = record.ChannelID
+		}
+	}
+}
+
+// packetSummary - короткое описание содержимого пакета для ленты
+func packetSummary(r *decoder.CSVRecord) string {
+	switch {
+	case r.Error != "":
+		return "ошибка: " + r.Error
+	case r.TextMessage != "":
+		return strconv.Quote(r.TextMessage)
+	case r.Latitude != "" && r.Longitude != "":
+		text := r.Latitude + ", " + r.Longitude
+		if r.PositionUncertainty != "" {
+			text += " ±" + r.PositionUncertainty + " м"
+		}
+		if r.GeofenceEvents != "" {
+			text += " [" + r.GeofenceEvents + "]"
+		}
+		return text
+	case r.BatteryLevel != "" || r.Voltage != "" || r.ChannelUtilization != "":
+		var parts []string
+		if r.BatteryLevel != "" {
+			parts = append(parts, "бат "+batteryText(r.BatteryLevel))
+		}
+		if r.Voltage != "" {
+			parts = append(parts, r.Voltage+" В")
+		}
+		if r.ChannelUtilization != "" {
+			parts = append(parts, "канал "+r.ChannelUtilization+"%")
+		}
+		return strings.Join(parts, ", ")
+	case r.Temperature != "":
+		return r.Temperature + " °C"
+	case r.UserLongName != "":
+		return r.UserLongName + " " + r.UserHwModel
+	case r.MapLongName != "":
+		return r.MapLongName
+	}
+	return r.PayloadType
+}
+
+func batteryText(level string) string {
+	if level == "" {
+		return ""
+	}
+	if v, err := strconv.ParseFloat(level, 64); err == nil && v > 100 {
+		return "внеш"
+	}
+	return level + "%"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Start занимает экран и запускает обработку клавиш и перерисовку.
+// Вывод log до Stop идет в нижнюю строку панели.
+func (d *dashboard) Start() error {
+	restore, err := enterRawMode()
+	if err != nil {
+		return err
+	}
+	d.restore = restore
+	if w, h, err := terminalSize(); err == nil {
+		d.width, d.height = w, h
+	}
+	log.SetOutput(d)
+	// Альтернативный экран и скрытый курсор
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	go d.readKeys(os.Stdin)
+	go d.refresh(resize)
+	d.redraw()
+	return nil
+}
+
+// Stop возвращает терминал в обычный режим
+func (d *dashboard) Stop() {
+	if d == nil {
+		return
+	}
+	d.stop.Do(func() {
+		// log держит свой мьютекс, пока вызывает Write, а Write ждет d.mu,
+		// поэтому вывод лога возвращается до захвата d.mu
+		log.SetOutput(os.Stderr)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		fmt.Fprint(d.out, ansiReset+"\x1b[?25h\x1b[?1049l")
+		if d.restore != nil {
+			d.restore()
+		}
+		close(d.done)
+	})
+}
+
+// Done закрывается, когда пользователь вышел из панели
+func (d *dashboard) Done() <-chan struct{} {
+	return d.done
+}
+
+// refresh перерисовывает экран при новых данных (не чаще 4 раз в секунду),
+// раз в секунду для обновления времени и при изменении размера терминала
+func (d *dashboard) refresh(resize <-chan os.Signal) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	ticks := 0
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-resize:
+			if w, h, err := terminalSize(); err == nil {
+				d.mu.Lock()
+				d.width, d.height = w, h
+				d.mu.Unlock()
+			}
+			d.redraw()
+		case <-ticker.C:
+			ticks++
+			d.mu.Lock()
+			dirty := d.dirty
+			d.mu.Unlock()
+			if dirty || ticks%4 == 0 {
+				d.redraw()
+			}
+		}
+	}
+}
+
+// readKeys разбирает ввод: обычные символы, стрелки и другие ESC последовательности
+func (d *dashboard) readKeys(in io.Reader) {
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			d.Stop()
+			return
+		}
+		for input := buf[:n]; len(input) > 0; {
+			key, size := nextKey(input)
+			input = input[size:]
+			if d.handleKey(key) {
+				d.Stop()
+				return
+			}
+		}
+		d.redraw()
+	}
+}
+
+// nextKey выделяет из ввода одну клавишу. Стрелки и прочие специальные клавиши
+// возвращаются именами (up, pgdn...), символы - как есть.
+func nextKey(input []byte) (string, int) {
+	if input[0] == 0x1b {
+		if len(input) == 1 || (input[1] != '[' && input[1] != 'O') {
+			return "esc", 1
+		}
+		// CSI: параметры до финального символа в диапазоне @..~
+		end := 2
+		for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+			end++
+		}
+		if end == len(input) {
+			return "", len(input)
+		}
+		names := map[string]string{
+			"A": "up", "B": "down", "C": "right", "D": "left", "H": "home", "F": "end", "Z": "backtab",
+			"1~": "home", "4~": "end", "5~": "pgup", "6~": "pgdn", "7~": "home", "8~": "end", "3~": "delete",
+		}
+		return names[string(input[2:end+1])], end + 1
+	}
+	switch input[0] {
+	case 3:
+		return "ctrl-c", 1
+	case '\t':
+		return "tab", 1
+	case '\r', '\n':
+		return "enter", 1
+	case 8, 127:
+		return "backspace", 1
+	}
+	r, size := utf8.DecodeRune(input)
+	return string(r), size
+}
+
+// handleKey меняет состояние панели по клавише, true - выход
+func (d *dashboard) handleKey(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dirty = true
+
+	if d.editing {
+		switch key {
+		case "enter":
+			d.editing = false
+		case "esc":
+			d.editing = false
+			d.filter = ""
+		case "backspace":
+			if _, size := utf8.DecodeLastRuneInString(d.filter); size > 0 {
+				d.filter = d.filter[:len(d.filter)-size]
+			}
+		case "ctrl-c":
+			return true
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); utf8.RuneCountInString(key) == 1 && unicode.IsPrint(r) {
+				d.filter += key
+			}
+		}
+		d.nodeCursor, d.nodeTop, d.packetScroll, d.chatScroll = 0, 0, 0, 0
+		return false
+	}
+
+	page := max(d.height/2-3, 1)
+	switch key {
+	case "q", "Q", "й", "Й", "ctrl-c":
+		return true
+	case "tab":
+		d.focus = (d.focus + 1) % paneCount
+	case "backtab":
+		d.focus = (d.focus + paneCount - 1) % paneCount
+	case "/":
+		d.editing = true
+	case "esc":
+		d.filter = ""
+	case "up", "k":
+		d.scroll(-1)
+	case "down", "j":
+		d.scroll(1)
+	case "pgup":
+		d.scroll(-page)
+	case "pgdn":
+		d.scroll(page)
+	case "home":
+		d.scroll(-1 << 30)
+	case "end":
+		d.scroll(1 << 30)
+	case "left", "h":
+		d.switchChannel(-1)
+	case "right", "l":
+		d.switchChannel(1)
+	case "enter":
+		// Enter на узле фильтрует все панели по его ID
+		if d.focus == paneNodes {
+			if nodes := d.filteredNodes(); d.nodeCursor < len(nodes) {
+				d.filter = nodes[d.nodeCursor].ID
+				d.nodeCursor, d.nodeTop, d.packetScroll, d.chatScroll = 0, 0, 0, 0
+			}
+		}
+	}
+	return false
+}
+
+// scroll двигает курсор таблицы узлов или прокручивает чат и ленту пакетов.
+// Отрицательный шаг - вверх, к более старым записям.
+func (d *dashboard) scroll(step int) {
+	switch d.focus {
+	case paneNodes:
+		d.nodeCursor = max(0, min(d.nodeCursor+step, len(d.filteredNodes())-1))
+	case paneChat:
+		d.chatScroll = max(0, d.chatScroll-step)
+	case panePackets:
+		d.packetScroll = max(0, min(d.packetScroll-step, len(d.packets)))
+	}
+}
+
+func (d *dashboard) switchChannel(step int) {
+	channels := d.channels()
+	if len(channels) == 0 {
+		return
+	}
+	i := sort.SearchStrings(channels, d.channel)
+	d.channel = channels[(i+step+len(channels))%len(channels)]
+	d.chatScroll = 0
+}
+
+func (d *dashboard) channels() []string {
+	channels := make([]string, 0, len(d.messages))
+	for name := range d.messages {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// matches проверяет строки записи на вхождение фильтра без учета регистра
+func (d *dashboard) matches(fields ...string) bool {
+	if d.filter == "" {
+		return true
+	}
+	filter := strings.ToLower(d.filter)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredNodes - узлы под фильтром, последние услышанные сверху
+func (d *dashboard) filteredNodes() []*dashboardNode {
+	var nodes []*dashboardNode
+	for _, n := range d.nodes {
+		if d.matches(n.ID, n.Name, n.ShortName) {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if !nodes[i].LastHeard.Equal(nodes[j].LastHeard) {
+			return nodes[i].LastHeard.After(nodes[j].LastHeard)
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes
+}
+
+func (d *dashboard) redraw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	d.dirty = false
+	io.WriteString(d.out, d.render(time.Now()))
+}
+
+// render собирает кадр целиком: каждая строка ставится в свою позицию и
+// дополняется пробелами до ширины экрана, поэтому очистка экрана не нужна
+func (d *dashboard) render(now time.Time) string {
+	width, height := max(d.width, 40), max(d.height, 12)
+	var b strings.Builder
+	line := func(row int, text string) {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s%s", row, text, ansiReset)
+	}
+
+	// Заголовок: подключение и счетчики
+	statusColor, statusText := ansiGreen, "● подключено "+formatDuration(now.Sub(d.connectedSince))
+	if !d.connected {
+		statusColor, statusText = ansiRed, "● нет связи"
+		if d.lastError != "" {
+			statusText += ": " + d.lastError
+		}
+	}
+	prefix := " Meshtastic MQTT │ "
+	counters := fmt.Sprintf(" │ пакетов %d │ узлов %d │ обрывов %d ", d.total, len(d.nodes), d.connectionLost)
+	clock := now.Format("15:04:05 ")
+	plain := prefix + statusText + counters
+	if pad := width - utf8.RuneCountInString(plain) - len(clock); pad < 0 {
+		line(1, ansiReverse+fit(plain, width))
+	} else {
+		line(1, ansiReverse+prefix+statusColor+statusText+ansiReset+ansiReverse+counters+strings.Repeat(" ", pad)+clock)
+	}
+
+	body := height - 3
+	topHeight := max(body/2, 5)
+	bottomHeight := body - topHeight
+	leftWidth := width * 55 / 100
+	rightWidth := width - leftWidth - 1
+
+	left := d.renderNodes(now, leftWidth, topHeight)
+	right := d.renderChat(rightWidth, topHeight)
+	for i := 0; i < topHeight; i++ {
+		line(2+i, left[i]+ansiReset+ansiDim+"│"+ansiReset+right[i])
+	}
+	for i, text := range d.renderPackets(width, bottomHeight) {
+		line(2+topHeight+i, text)
+	}
+
+	line(height-1, ansiDim+fit(d.logLine, width))
+	if d.editing {
+		line(height, ansiBold+fit("Фильтр: "+d.filter+"█", width))
+	} else {
+		hint := "Tab панель  ↑↓ PgUp PgDn Home End прокрутка  ←→ канал  / фильтр  Enter узел  Esc сброс  q выход"
+		if d.filter != "" {
+			hint = "фильтр: " + d.filter + "  │  " + hint
+		}
+		line(height, ansiReverse+fit(hint, width))
+	}
+	return b.String()
+}
+
+// title - заголовок панели, у активной выделен
+func (d *dashboard) title(pane int, text string, width int) string {
+	if d.focus == pane {
+		return ansiReverse + ansiBold + fit(text, width)
+	}
+	return ansiBold + fit(text, width)
+}
+
+func (d *dashboard) renderNodes(now time.Time, width, height int) []string {
+	nodes := d.filteredNodes()
+	d.nodeCursor = max(0, min(d.nodeCursor, len(nodes)-1))
+	rows := height - 2
+	if d.nodeCursor < d.nodeTop {
+		d.nodeTop = d.nodeCursor
+	}
+	if d.nodeCursor >= d.nodeTop+rows {
+		d.nodeTop = d.nodeCursor - rows + 1
+	}
+	d.nodeTop = max(0, min(d.nodeTop, len(nodes)-rows))
+
+	nameWidth := max(width-34, 8)
+	columns := func(id, name, hops, snr, battery, heard string) string {
+		return fit(id, 10) + " " + fit(name, nameWidth) + " " + fit(hops, 4) + " " + fit(snr, 6) + " " + fit(battery, 5) + " " + fit(heard, 4)
+	}
+	lines := []string{
+		d.title(paneNodes, fmt.Sprintf(" Узлы %d/%d", len(nodes), len(d.nodes)), width),
+		ansiDim + fit(columns("ID", "Имя", "Хопы", "SNR", "Бат.", "Слыш"), width),
+	}
+	for i := d.nodeTop; i < len(nodes) && len(lines) < height; i++ {
+		n := nodes[i]
+		name := n.Name
+		if n.ShortName != "" {
+			name = "[" + n.ShortName + "] " + name
+		}
+		text := fit(columns(n.ID, name, n.Hops, n.SNR, batteryText(n.Battery), formatDuration(now.Sub(n.LastHeard))), width)
+		color := ansiDim
+		switch age := now.Sub(n.LastHeard); {
+		case age < 15*time.Minute:
+			color = ansiGreen
+		case age < time.Hour:
+			color = ansiYellow
+		}
+		if i == d.nodeCursor && d.focus == paneNodes {
+			color = ansiReverse
+		}
+		lines = append(lines, color+text)
+	}
+	return padLines(lines, width, height)
+}
+
+func (d *dashboard) renderChat(width, height int) []string {
+	channels := d.channels()
+	label := d.channel
+	if label == "" {
+		label = "нет сообщений"
+	}
+	position := ""
+	if len(channels) > 1 {
+		position = fmt.Sprintf(" %d/%d ←→", sort.SearchStrings(channels, d.channel)+1, len(channels))
+	}
+	lines := []string{d.title(paneChat, " Чат: "+label+position, width)}
+
+	var text []string
+	for _, m := range d.messages[d.channel] {
+		if !d.matches(m.From, m.FromName, m.Text) {
+			continue
+		}
+		from := firstNonEmpty(m.FromName, m.From)
+		if m.To != "" && m.To != "!ffffffff" {
+			from += " → " + firstNonEmpty(d.nodeName(m.To), m.To)
+		}
+		prefix := m.At.Format("15:04") + " " + from + ": "
+		for i, part := range wrapText(prefix+m.Text, width) {
+			if i == 0 && strings.HasPrefix(part, prefix) {
+				part = ansiCyan + prefix + ansiReset + strings.TrimPrefix(part, prefix)
+			}
+			text = append(text, part)
+		}
+	}
+	rows := height - 1
+	d.chatScroll = max(0, min(d.chatScroll, len(text)-rows))
+	end := len(text) - d.chatScroll
+	lines = append(lines, text[max(0, end-rows):end]...)
+	return padLines(lines, width, height)
+}
+
+func (d *dashboard) nodeName(id string) string {
+	if n := d.nodes[id]; n != nil {
+		return n.Name
+	}
+	return ""
+}
+
+func (d *dashboard) renderPackets(width, height int) []string {
+	var packets []*dashboardPacket
+	for i := range d.packets {
+		p := &d.packets[i]
+		if d.matches(p.From, p.FromName, p.Portnum, p.Channel, p.Gateway, p.Summary) {
+			packets = append(packets, p)
+		}
+	}
+	rows := height - 1
+	scroll := max(0, min(d.packetScroll, len(packets)-rows))
+	end := len(packets) - scroll
+
+	title := fmt.Sprintf(" Пакеты %d", len(packets))
+	if scroll > 0 {
+		title += fmt.Sprintf("  (пауза, -%d, End - к новым)", scroll)
+	}
+	lines := []string{d.title(panePackets, title, width)}
+	for _, p := range packets[max(0, end-rows):end] {
+		hops := p.Hops
+		if hops == "0" && p.SNR != "" {
+			hops += " " + p.SNR + "dB"
+		}
+		text := fit(p.At.Format("15:04:05")+" "+fit(p.From, 10)+" "+fit(p.FromName, 14)+" "+
+			fit(p.Portnum, 18)+" "+fit(p.Channel, 10)+" "+fit(hops, 10)+" "+p.Summary, width)
+		switch {
+		case p.Error:
+			text = ansiRed + text
+		case p.Duplicate:
+			text = ansiDim + text
+		}
+		lines = append(lines, text)
+	}
+	return padLines(lines, width, height)
+}
+
+// padLines дополняет панель пустыми строками до высоты
+func padLines(lines []string, width, height int) []string {
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+	return lines[:height]
+}
+
+// fit обрезает или дополняет пробелами строку до ширины в символах,
+// управляющие символы заменяются пробелами
+func fit(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text))
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// wrapText разбивает строку на строки ширины width, по возможности по пробелам
+func wrapText(text string, width int) []string {
+	runes := []rune(fit(text, utf8.RuneCountInString(text)))
+	var lines []string
+	for len(runes) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, fit(string(runes[:cut]), width))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(lines, fit(string(runes), width))
+}
+
+// formatDuration - короткая запись промежутка: 45с, 12м, 3ч, 2д
+func formatDuration(d time.Duration) string {
+	d = max(d, 0)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%dс", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dм", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dч", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dд", int(d.Hours()/24))
+}
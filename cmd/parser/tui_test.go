@@ -0,0 +1,257 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"fyneMMQT/decoder"
+)
+
+func TestNextKey(t *testing.T) {
+	tests := []struct {
+		input string
+		key   string
+		size  int
+	}{
+		{input: "q", key: "q", size: 1},
+		{input: "йq", key: "й", size: 2},
+		{input: "\t", key: "tab", size: 1},
+		{input: "\r", key: "enter", size: 1},
+		{input: "\x7f", key: "backspace", size: 1},
+		{input: "\x03", key: "ctrl-c", size: 1},
+		{input: "\x1b", key: "esc", size: 1},
+		{input: "\x1bx", key: "esc", size: 1},
+		{input: "\x1b[Aq", key: "up", size: 3},
+		{input: "\x1bOB", key: "down", size: 3},
+		{input: "\x1b[Z", key: "backtab", size: 3},
+		{input: "\x1b[5~", key: "pgup", size: 4},
+		{input: "\x1b[1;5C", key: "", size: 6},
+		// Обрезанная последовательность отбрасывается целиком
+		{input: "\x1b[1", key: "", size: 3},
+	}
+	for _, tt := range tests {
+		t.Run(strings.ToValidUTF8(tt.input, "?"), func(t *testing.T) {
+			key, size := nextKey([]byte(tt.input))
+			if key != tt.key || size != tt.size {
+				t.Errorf("nextKey(%q) = %q, %d, want %q, %d", tt.input, key, size, tt.key, tt.size)
+			}
+		})
+	}
+}
+
+func TestTextLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{name: "fit pad", got: []string{fit("узел", 6)}, want: []string{"узел  "}},
+		{name: "fit cut", got: []string{fit("Meshtastic", 5)}, want: []string{"Mesh…"}},
+		{name: "fit control", got: []string{fit("a\tb\x1b", 4)}, want: []string{"a b "}},
+		{name: "fit zero", got: []string{fit("a", 0)}, want: []string{""}},
+		{name: "wrap words", got: wrapText("привет всем в канале", 10), want: []string{"привет    ", "всем в    ", "канале    "}},
+		{name: "wrap long word", got: wrapText("abcdefghij", 4), want: []string{"abcd", "efgh", "ij  "}},
+		{name: "pad lines", got: padLines([]string{"a"}, 2, 3), want: []string{"a", "  ", "  "}},
+		{name: "durations", got: []string{
+			formatDuration(-time.Second), formatDuration(45 * time.Second), formatDuration(12 * time.Minute),
+			formatDuration(47 * time.Hour), formatDuration(72 * time.Hour),
+		}, want: []string{"0с", "45с", "12м", "47ч", "3д"}},
+		{name: "battery", got: []string{batteryText(""), batteryText("87"), batteryText("101")}, want: []string{"", "87%", "внеш"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Equal(tt.got, tt.want) {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacketSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		record decoder.CSVRecord
+		want   string
+	}{
+		{name: "error", record: decoder.CSVRecord{Error: "bad", TextMessage: "hi"}, want: "ошибка: bad"},
+		{name: "text", record: decoder.CSVRecord{TextMessage: "hi\n"}, want: `"hi\n"`},
+		{name: "position", record: decoder.CSVRecord{Latitude: "64.5", Longitude: "40.5", PositionUncertainty: "23", GeofenceEvents: "enter база"}, want: "64.5, 40.5 ±23 м [enter база]"},
+		{name: "telemetry", record: decoder.CSVRecord{BatteryLevel: "101", Voltage: "4.20", ChannelUtilization: "12.5"}, want: "бат внеш, 4.20 В, канал 12.5%"},
+		{name: "environment", record: decoder.CSVRecord{Temperature: "21.5"}, want: "21.5 °C"},
+		{name: "nodeinfo", record: decoder.CSVRecord{UserLongName: "Alpha", UserHwModel: "TBEAM"}, want: "Alpha TBEAM"},
+		{name: "payload type", record: decoder.CSVRecord{PayloadType: "encrypted"}, want: "encrypted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := packetSummary(&tt.record); got != tt.want {
+				t.Errorf("packetSummary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestDashboard - панель с двумя узлами и сообщениями в двух каналах
+func newTestDashboard(t *testing.T) (*dashboard, time.Time) {
+	t.Helper()
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.Local)
+	d := newDashboard(nil)
+	for _, step := range []struct {
+		at     time.Duration
+		record decoder.CSVRecord
+	}{
+		{0, decoder.CSVRecord{GatewayID: "!00000010", From: "1", PacketID: "1", PortnumName: "NODEINFO_APP", UserLongName: "Alpha", UserShortName: "ALP"}},
+		{time.Second, decoder.CSVRecord{GatewayID: "!00000010", From: "1", PacketID: "2", ChannelID: "LongFast", HopsAway: "0", RxSNR: "6.50", TextMessage: "hello"}},
+		// Копия через второй шлюз - повтор, в чат не попадает
+		{2 * time.Second, decoder.CSVRecord{GatewayID: "!00000011", From: "1", PacketID: "2", ChannelID: "LongFast", HopsAway: "1", TextMessage: "hello"}},
+		{3 * time.Second, decoder.CSVRecord{GatewayID: "!00000010", From: "2", To: "1", PacketID: "3", ChannelID: "Ops", TextMessage: "ping"}},
+		{4 * time.Second, decoder.CSVRecord{GatewayID: "!00000010", From: "2", PacketID: "4", BatteryLevel: "55"}},
+	} {
+		d.Observe(&step.record, start.Add(step.at))
+	}
+	return d, start
+}
+
+func TestDashboardObserve(t *testing.T) {
+	d, start := newTestDashboard(t)
+
+	if d.total != 5 || len(d.packets) != 5 {
+		t.Fatalf("total = %d, packets = %d", d.total, len(d.packets))
+	}
+	var duplicates []bool
+	for _, p := range d.packets {
+		duplicates = append(duplicates, p.Duplicate)
+	}
+	if want := []bool{false, false, true, false, false}; !slices.Equal(duplicates, want) {
+		t.Errorf("duplicates = %v, want %v", duplicates, want)
+	}
+
+	alpha := d.nodes["!00000001"]
+	// SNR берется только у пакета, принятого напрямую
+	if alpha == nil || alpha.Name != "Alpha" || alpha.ShortName != "ALP" || alpha.Hops != "1" || alpha.SNR != "6.50" || alpha.Packets != 3 {
+		t.Errorf("alpha = %+v", alpha)
+	}
+	if beta := d.nodes["!00000002"]; beta == nil || beta.Battery != "55" || !beta.LastHeard.Equal(start.Add(4*time.Second)) {
+		t.Errorf("beta = %+v", beta)
+	}
+
+	if len(d.messages["LongFast"]) != 1 || len(d.messages["Ops"]) != 1 || d.channel != "LongFast" {
+		t.Errorf("messages = %v, channel = %q", d.messages, d.channel)
+	}
+	if m := d.messages["Ops"][0]; m.From != "!00000002" || m.To != "!00000001" || m.Text != "ping" {
+		t.Errorf("ops message = %+v", m)
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  []string
+		quit  bool
+		check func(t *testing.T, d *dashboard)
+	}{
+		{name: "quit", keys: []string{"q"}, quit: true},
+		{name: "quit cyrillic", keys: []string{"й"}, quit: true},
+		{name: "typing q into filter", keys: []string{"/", "q"}, check: func(t *testing.T, d *dashboard) {
+			if !d.editing || d.filter != "q" {
+				t.Errorf("editing = %v, filter = %q", d.editing, d.filter)
+			}
+		}},
+		{name: "filter edit", keys: []string{"/", "a", "l", "x", "backspace", "enter"}, check: func(t *testing.T, d *dashboard) {
+			nodes := d.filteredNodes()
+			if d.editing || d.filter != "al" || len(nodes) != 1 || nodes[0].ID != "!00000001" {
+				t.Errorf("filter = %q, nodes = %d", d.filter, len(nodes))
+			}
+		}},
+		{name: "filter reset", keys: []string{"/", "a", "esc"}, check: func(t *testing.T, d *dashboard) {
+			if d.editing || d.filter != "" {
+				t.Errorf("editing = %v, filter = %q", d.editing, d.filter)
+			}
+		}},
+		{name: "focus", keys: []string{"tab", "tab", "tab", "backtab"}, check: func(t *testing.T, d *dashboard) {
+			if d.focus != panePackets {
+				t.Errorf("focus = %d, want %d", d.focus, panePackets)
+			}
+		}},
+		// Последний услышанный узел сверху, курсор не выходит за таблицу
+		{name: "enter on node", keys: []string{"down", "down", "down", "enter"}, check: func(t *testing.T, d *dashboard) {
+			if d.filter != "!00000001" {
+				t.Errorf("filter = %q", d.filter)
+			}
+		}},
+		{name: "channels", keys: []string{"right"}, check: func(t *testing.T, d *dashboard) {
+			if d.channel != "Ops" {
+				t.Errorf("channel = %q", d.channel)
+			}
+		}},
+		{name: "channels wrap", keys: []string{"left", "left"}, check: func(t *testing.T, d *dashboard) {
+			if d.channel != "LongFast" {
+				t.Errorf("channel = %q", d.channel)
+			}
+		}},
+		{name: "packet scroll", keys: []string{"tab", "tab", "up", "up", "end"}, check: func(t *testing.T, d *dashboard) {
+			if d.packetScroll != 0 {
+				t.Errorf("packetScroll = %d", d.packetScroll)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDashboard(t)
+			quit := false
+			for _, key := range tt.keys {
+				quit = d.handleKey(key)
+			}
+			if quit != tt.quit {
+				t.Errorf("quit = %v, want %v", quit, tt.quit)
+			}
+			if tt.check != nil {
+				tt.check(t, d)
+			}
+		})
+	}
+}
+
+var (
+	cursorPosition = regexp.MustCompile(`\x1b\[\d+;1H`)
+	ansiSequence   = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+)
+
+func TestDashboardRender(t *testing.T) {
+	d, start := newTestDashboard(t)
+	d.connected = true
+	d.connectedSince = start
+	d.width, d.height = 100, 20
+
+	// Кадр - по строке на каждую позицию экрана, каждая ровно в ширину экрана
+	var lines []string
+	for _, row := range cursorPosition.Split(d.render(start.Add(time.Minute)), -1)[1:] {
+		lines = append(lines, ansiSequence.ReplaceAllString(row, ""))
+	}
+	if len(lines) != d.height {
+		t.Fatalf("lines = %d, want %d", len(lines), d.height)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != d.width {
+			t.Errorf("line %d width = %d, want %d: %q", i+1, n, d.width, line)
+		}
+	}
+
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"● подключено 1м", "пакетов 5", "узлов 2", "12:01:00",
+		"Узлы 2/2", "[ALP] Alpha", "Чат: LongFast 1/2 ←→", "Alpha: hello", "Пакеты 5", "бат 55%",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen has no %q:\n%s", want, screen)
+		}
+	}
+
+	d.handleKey("right")
+	if screen := ansiSequence.ReplaceAllString(d.render(start.Add(time.Minute)), ""); !strings.Contains(screen, "!00000002 → Alpha: ping") {
+		t.Errorf("Ops chat not rendered:\n%s", screen)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Статика веб-интерфейса вшита в бинарник, внешние CDN не нужны
+//
+//go:embed web
+var webFiles embed.FS
+
+// uiConfig - настройки карты для веб-интерфейса
+type uiConfig struct {
+	// Background - адрес подложки карты или пусто, тогда рисуется только сетка
+	Background string `json:"background"`
+	// Bounds - углы подложки: lat1, lon1, lat2, lon2
+	Bounds []float64 `json:"bounds,omitempty"`
+}
+
+// newUIHandler собирает обработчик веб-интерфейса: статика, /ui/config.json и /ui/background
+func newUIHandler(mapImage, mapBounds string) (http.Handler, error) {
+	var config uiConfig
+	if mapBounds != "" {
+		bounds, err := parseBounds(mapBounds)
+		if err != nil {
+			return nil, err
+		}
+		config.Bounds = bounds
+	}
+	if mapImage != "" {
+		if config.Bounds == nil {
+			return nil, fmt.Errorf("для подложки %s нужны границы -ui-map-bounds", mapImage)
+		}
+		if _, err := os.Stat(mapImage); err != nil {
+			return nil, fmt.Errorf("подложка карты: %w", err)
+		}
+		config.Background = "/ui/background"
+	}
+
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("GET /ui/config.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(config)
+	})
+	if mapImage != "" {
+		mux.HandleFunc("GET /ui/background", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, mapImage)
+		})
+	}
+	return mux, nil
+}
+
+// parseBounds разбирает "lat1,lon1,lat2,lon2"
+func parseBounds(value string) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("границы карты %q: нужно lat1,lon1,lat2,lon2", value)
+	}
+	bounds := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("границы карты %q: %w", value, err)
+		}
+		bounds[i] = v
+	}
+	if bounds[0] == bounds[2] || bounds[1] == bounds[3] {
+		return nil, fmt.Errorf("границы карты %q: пустая область", value)
+	}
+	return bounds, nil
+}
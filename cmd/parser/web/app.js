@@ -0,0 +1,423 @@
+// Веб-интерфейс сборщика: список узлов, карта, чат каналов и графики телеметрии.
+// Начальное состояние берется из /api, обновления приходят из потока /ws.
+"use strict";
+
+const state = {
+  nodes: new Map(),
+  messages: new Map(), // канал -> сообщения по времени
+  channel: null,
+  selected: null,
+  history: [], // телеметрия выбранного узла
+  config: {},
+  background: null,
+  view: null,
+  counters: { packets: 0, dropped: 0 },
+};
+
+// Показатели телеметрии для графиков и их подписи
+const SPARKS = [
+  ["battery_level", "Батарея, %"],
+  ["voltage", "Напряжение, В"],
+  ["channel_utilization", "Загрузка канала, %"],
+  ["air_util_tx", "Передача, %"],
+  ["temperature", "Температура, °C"],
+  ["relative_humidity", "Влажность, %"],
+];
+const HISTORY_LIMIT = 300;
+const MESSAGES_LIMIT = 500;
+
+const $ = (id) => document.getElementById(id);
+
+async function fetchJSON(url) {
+  const resp = await fetch(url);
+  if (!resp.ok) throw new Error(url + ": " + resp.status);
+  return resp.json();
+}
+
+function nodeName(id) {
+  const n = state.nodes.get(id);
+  return (n && (n.name || n.short_name)) || id;
+}
+
+function formatAgo(time) {
+  if (!time) return "";
+  const s = Math.max(0, (Date.now() - new Date(time).getTime()) / 1000);
+  if (s < 60) return Math.round(s) + " с";
+  if (s < 3600) return Math.round(s / 60) + " мин";
+  if (s < 86400) return (s / 3600).toFixed(1) + " ч";
+  return (s / 86400).toFixed(1) + " д";
+}
+
+function formatTime(time) {
+  return new Date(time).toLocaleString("ru-RU", { day: "2-digit", month: "2-digit", hour: "2-digit", minute: "2-digit" });
+}
+
+function escapeHTML(text) {
+  return String(text).replace(/[&<>"']/g, (c) => ({ "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }[c]));
+}
+
+// --- Узлы ---
+
+function upsertNode(id) {
+  let n = state.nodes.get(id);
+  if (!n) {
+    n = { id, state: "online", telemetry: {} };
+    state.nodes.set(id, n);
+  }
+  return n;
+}
+
+function renderNodes() {
+  const filter = $("filter").value.trim().toLowerCase();
+  const rows = [...state.nodes.values()]
+    .filter((n) => !filter || (n.id + " " + (n.name || "") + " " + (n.short_name || "")).toLowerCase().includes(filter))
+    .sort((a, b) => new Date(b.last_heard || 0) - new Date(a.last_heard || 0));
+  $("nodes").tBodies[0].innerHTML = rows.map((n) => {
+    const battery = n.telemetry && n.telemetry.battery_level;
+    return `<tr data-id="${n.id}" class="${n.id === state.selected ? "selected" : ""}">
+      <td class="name" title="${escapeHTML(n.id)}"><span class="state state-${n.state}"></span>${escapeHTML(n.name || n.short_name || n.id)}</td>
+      <td>${n.hops_away ?? ""}</td>
+      <td>${n.snr != null ? n.snr.toFixed(1) : ""}</td>
+      <td>${battery != null ? (battery > 100 ? "внеш." : Math.round(battery) + "%") : ""}</td>
+      <td>${formatAgo(n.last_heard)}</td></tr>`;
+  }).join("");
+  $("counters").textContent = `узлов ${state.nodes.size}, пакетов ${state.counters.packets}` +
+    (state.counters.dropped ? `, пропущено ${state.counters.dropped}` : "");
+}
+
+async function selectNode(id) {
+  state.selected = id;
+  state.history = [];
+  renderNodes();
+  renderDetails();
+  drawMap();
+  try {
+    const page = await fetchJSON(`/api/nodes/${encodeURIComponent(id)}/history?kind=telemetry&limit=${HISTORY_LIMIT}`);
+    if (state.selected !== id) return;
+    state.history = page.items.reverse().map((e) => ({ time: new Date(e.time), values: e.telemetry }));
+    renderDetails();
+  } catch (err) {
+    console.warn(err);
+  }
+}
+
+function renderDetails() {
+  const n = state.nodes.get(state.selected);
+  if (!n) return;
+  const rows = [
+    ["ID", n.id],
+    ["Состояние", n.state],
+    ["Модель", n.hw_model],
+    ["Шлюз", n.last_gateway],
+    ["Слышен", n.last_heard && formatTime(n.last_heard)],
+    ["Позиция", n.position && `${n.position.lat.toFixed(5)}, ${n.position.lon.toFixed(5)} ±${Math.round(n.position.uncertainty_m)} м`],
+  ].filter((r) => r[1]);
+  $("details").innerHTML = `<h2>${escapeHTML(n.name || n.id)}</h2>` +
+    rows.map((r) => `<div>${r[0]}: ${escapeHTML(r[1])}</div>`).join("");
+
+  $("sparklines").innerHTML = SPARKS.map(([key, label]) => {
+    const points = state.history.filter((h) => h.values[key] != null).map((h) => [h.time.getTime(), h.values[key]]);
+    if (points.length === 0) return "";
+    return `<div class="spark"><div class="label"><span>${label}</span><span>${points[points.length - 1][1].toFixed(2)}</span></div>${sparkline(points)}</div>`;
+  }).join("");
+}
+
+// sparkline рисует ряд [время, значение] в SVG 190x44
+function sparkline(points) {
+  const w = 190, h = 44, pad = 3;
+  const t0 = points[0][0], t1 = points[points.length - 1][0];
+  let lo = Math.min(...points.map((p) => p[1])), hi = Math.max(...points.map((p) => p[1]));
+  if (hi === lo) { hi += 1; lo -= 1; }
+  const coords = points.map(([t, v]) => {
+    const x = t1 === t0 ? w / 2 : pad + ((t - t0) / (t1 - t0)) * (w - 2 * pad);
+    const y = h - pad - ((v - lo) / (hi - lo)) * (h - 2 * pad);
+    return x.toFixed(1) + "," + y.toFixed(1);
+  });
+  return `<svg viewBox="0 0 ${w} ${h}"><title>${lo.toFixed(2)} … ${hi.toFixed(2)}</title><polyline points="${coords.join(" ")}"/></svg>`;
+}
+
+// --- Чат ---
+
+function addMessage(m, prepend) {
+  let list = state.messages.get(m.channel);
+  if (!list) {
+    list = [];
+    state.messages.set(m.channel, list);
+  }
+  if (list.some((x) => x.from === m.from && x.packet_id === m.packet_id)) return;
+  if (prepend) list.unshift(m); else list.push(m);
+  if (list.length > MESSAGES_LIMIT) list.splice(0, list.length - MESSAGES_LIMIT);
+}
+
+function renderChannels() {
+  const names = [...state.messages.keys()].sort();
+  if (!state.channel && names.length) state.channel = names[0];
+  $("channels").innerHTML = names.map((c) =>
+    `<button data-channel="${escapeHTML(c)}" class="${c === state.channel ? "active" : ""}">${escapeHTML(c || "без канала")} (${state.messages.get(c).length})</button>`).join("");
+}
+
+function renderMessages() {
+  const list = state.messages.get(state.channel) || [];
+  const box = $("messages");
+  const atBottom = box.scrollTop + box.clientHeight >= box.scrollHeight - 20;
+  box.innerHTML = list.map((m) => {
+    const to = m.to && m.to !== "!ffffffff" ? ` → ${escapeHTML(nodeName(m.to))}` : "";
+    const alert = m.alert ? ` <span class="alert-label">тревога</span>` : "";
+    return `<li class="${m.alert ? "alert" : ""}"><div class="meta">${formatTime(m.time)} <span class="from">${escapeHTML(m.from_name || nodeName(m.from))}</span>${to}${alert}</div>
+      <div class="text">${escapeHTML(m.text)}</div></li>`;
+  }).join("");
+  if (atBottom) box.scrollTop = box.scrollHeight;
+}
+
+// --- Карта ---
+
+const canvas = $("map");
+const ctx = canvas.getContext("2d");
+
+// project переводит координаты в пиксели (равнопромежуточная проекция вокруг центра вида)
+function project(lat, lon) {
+  const v = state.view;
+  return [
+    canvas.width / 2 + (lon - v.lon) * Math.cos((v.lat * Math.PI) / 180) * v.scale,
+    canvas.height / 2 - (lat - v.lat) * v.scale,
+  ];
+}
+
+function unproject(x, y) {
+  const v = state.view;
+  return [
+    v.lat - (y - canvas.height / 2) / v.scale,
+    v.lon + (x - canvas.width / 2) / (Math.cos((v.lat * Math.PI) / 180) * v.scale),
+  ];
+}
+
+// fitView подбирает вид по позициям узлов и подложке
+function fitView() {
+  const lats = [], lons = [];
+  for (const n of state.nodes.values()) {
+    if (n.position) { lats.push(n.position.lat); lons.push(n.position.lon); }
+  }
+  const b = state.config.bounds;
+  if (b) { lats.push(b[0], b[2]); lons.push(b[1], b[3]); }
+  if (lats.length === 0) { lats.push(0); lons.push(0); }
+  const lat = (Math.min(...lats) + Math.max(...lats)) / 2;
+  const lon = (Math.min(...lons) + Math.max(...lons)) / 2;
+  const spanLat = Math.max(Math.max(...lats) - Math.min(...lats), 0.01);
+  const spanLon = Math.max((Math.max(...lons) - Math.min(...lons)) * Math.cos((lat * Math.PI) / 180), 0.01);
+  const scale = 0.85 * Math.min(canvas.height / spanLat, canvas.width / spanLon);
+  state.view = { lat, lon, scale };
+}
+
+function gridStep() {
+  const steps = [10, 5, 2, 1, 0.5, 0.2, 0.1, 0.05, 0.02, 0.01, 0.005, 0.002, 0.001, 0.0005];
+  const spanDeg = canvas.height / state.view.scale;
+  return steps.find((s) => spanDeg / s >= 4) || steps[steps.length - 1];
+}
+
+function drawMap() {
+  const rect = canvas.getBoundingClientRect();
+  if (canvas.width !== rect.width || canvas.height !== rect.height) {
+    canvas.width = rect.width;
+    canvas.height = rect.height;
+  }
+  if (!state.view) fitView();
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+
+  const b = state.config.bounds;
+  if (state.background && b) {
+    const [x1, y1] = project(Math.max(b[0], b[2]), Math.min(b[1], b[3]));
+    const [x2, y2] = project(Math.min(b[0], b[2]), Math.max(b[1], b[3]));
+    ctx.drawImage(state.background, x1, y1, x2 - x1, y2 - y1);
+  }
+
+  // Координатная сетка
+  const step = gridStep();
+  const [latTop, lonLeft] = unproject(0, 0);
+  const [latBottom, lonRight] = unproject(canvas.width, canvas.height);
+  ctx.strokeStyle = "rgba(0,0,0,0.12)";
+  ctx.fillStyle = "#6b7280";
+  ctx.font = "10px sans-serif";
+  ctx.lineWidth = 1;
+  const digits = Math.max(0, -Math.floor(Math.log10(step)));
+  for (let lat = Math.ceil(latBottom / step) * step; lat <= latTop; lat += step) {
+    const [, y] = project(lat, lonLeft);
+    ctx.beginPath(); ctx.moveTo(0, y); ctx.lineTo(canvas.width, y); ctx.stroke();
+    ctx.fillText(lat.toFixed(digits), 3, y - 2);
+  }
+  const lonStep = step * 2;
+  for (let lon = Math.ceil(lonLeft / lonStep) * lonStep; lon <= lonRight; lon += lonStep) {
+    const [x] = project(latTop, lon);
+    ctx.beginPath(); ctx.moveTo(x, 0); ctx.lineTo(x, canvas.height); ctx.stroke();
+    ctx.fillText(lon.toFixed(digits), x + 2, 10);
+  }
+
+  // Узлы: круг неопределенности позиции и метка
+  const metersToPx = state.view.scale / 111320;
+  const colors = { online: "#2e7d32", stale: "#f9a825", offline: "#9e9e9e" };
+  for (const n of state.nodes.values()) {
+    if (!n.position) continue;
+    const [x, y] = project(n.position.lat, n.position.lon);
+    const color = colors[n.state] || "#2e7d32";
+    const r = n.position.uncertainty_m * metersToPx;
+    if (r > 4) {
+      ctx.beginPath(); ctx.arc(x, y, r, 0, 2 * Math.PI);
+      ctx.fillStyle = color + "22"; ctx.fill();
+    }
+    const selected = n.id === state.selected;
+    ctx.beginPath(); ctx.arc(x, y, selected ? 7 : 5, 0, 2 * Math.PI);
+    ctx.fillStyle = color; ctx.fill();
+    ctx.strokeStyle = selected ? "#1d4ed8" : "#fff"; ctx.lineWidth = 2; ctx.stroke();
+    ctx.fillStyle = "#1d2330"; ctx.font = (selected ? "bold " : "") + "11px sans-serif";
+    ctx.fillText(n.short_name || n.name || n.id, x + 8, y + 4);
+  }
+}
+
+function setupMap() {
+  let drag = null;
+  canvas.addEventListener("mousedown", (e) => { drag = { x: e.offsetX, y: e.offsetY, moved: false }; });
+  window.addEventListener("mouseup", () => { setTimeout(() => { drag = null; }, 0); });
+  canvas.addEventListener("mousemove", (e) => {
+    if (!drag || !state.view) return;
+    const [lat0, lon0] = unproject(drag.x, drag.y);
+    const [lat1, lon1] = unproject(e.offsetX, e.offsetY);
+    state.view.lat += lat0 - lat1;
+    state.view.lon += lon0 - lon1;
+    drag.x = e.offsetX; drag.y = e.offsetY; drag.moved = true;
+    drawMap();
+  });
+  canvas.addEventListener("wheel", (e) => {
+    e.preventDefault();
+    const [lat, lon] = unproject(e.offsetX, e.offsetY);
+    state.view.scale *= e.deltaY < 0 ? 1.25 : 0.8;
+    // Точка под курсором остается на месте
+    const [lat2, lon2] = unproject(e.offsetX, e.offsetY);
+    state.view.lat += lat - lat2;
+    state.view.lon += lon - lon2;
+    drawMap();
+  }, { passive: false });
+  canvas.addEventListener("dblclick", () => { fitView(); drawMap(); });
+  canvas.addEventListener("click", (e) => {
+    if (drag && drag.moved) return;
+    let best = null, bestDist = 12;
+    for (const n of state.nodes.values()) {
+      if (!n.position) continue;
+      const [x, y] = project(n.position.lat, n.position.lon);
+      const d = Math.hypot(x - e.offsetX, y - e.offsetY);
+      if (d < bestDist) { best = n; bestDist = d; }
+    }
+    if (best) selectNode(best.id);
+  });
+  window.addEventListener("resize", drawMap);
+}
+
+// --- Поток ---
+
+function handlePacket(p) {
+  state.counters.packets++;
+  if (!p.from) return;
+  const n = upsertNode(p.from);
+  n.last_heard = p.time;
+  if (p.from_name) n.name = p.from_name;
+  if (n.state !== "online") n.state = "online";
+  if (p.position) {
+    const first = !n.position;
+    n.position = p.position;
+    if (first && state.view && state.nodes.size < 3) state.view = null;
+  }
+  if (p.hops_away != null) {
+    n.hops_away = p.hops_away;
+    if (p.hops_away === 0 && p.snr != null) n.snr = p.snr;
+  }
+  if (p.telemetry && !p.duplicate) {
+    n.telemetry = Object.assign(n.telemetry || {}, p.telemetry);
+    if (state.selected === p.from) {
+      state.history.push({ time: new Date(p.time), values: p.telemetry });
+      if (state.history.length > HISTORY_LIMIT) state.history.shift();
+    }
+  }
+  if (p.text && !p.duplicate) {
+    addMessage({ time: p.time, channel: p.channel, from: p.from, from_name: p.from_name, to: p.to, packet_id: p.id, text: p.text, alert: p.is_alert });
+  }
+}
+
+let redrawPending = false;
+function scheduleRender() {
+  if (redrawPending) return;
+  redrawPending = true;
+  requestAnimationFrame(() => {
+    redrawPending = false;
+    renderNodes();
+    renderChannels();
+    renderMessages();
+    if (state.selected) renderDetails();
+    drawMap();
+  });
+}
+
+function connect(delay = 1000) {
+  const proto = location.protocol === "https:" ? "wss:" : "ws:";
+  const ws = new WebSocket(`${proto}//${location.host}/ws`);
+  ws.onopen = () => {
+    delay = 1000;
+    $("status").textContent = "в сети";
+    $("status").className = "status online";
+  };
+  ws.onmessage = (e) => {
+    const msg = JSON.parse(e.data);
+    if (msg.type === "packet") handlePacket(msg.packet);
+    else if (msg.type === "node_state") {
+      const n = upsertNode(msg.node_state.node);
+      n.state = msg.node_state.to;
+      if (msg.node_state.name) n.name = msg.node_state.name;
+    } else if (msg.type === "dropped") state.counters.dropped += msg.dropped;
+    scheduleRender();
+  };
+  ws.onclose = () => {
+    $("status").textContent = "нет связи";
+    $("status").className = "status offline";
+    setTimeout(() => connect(Math.min(delay * 2, 30000)), delay);
+  };
+}
+
+// --- Запуск ---
+
+async function init() {
+  setupMap();
+  $("filter").addEventListener("input", renderNodes);
+  $("nodes").tBodies[0].addEventListener("click", (e) => {
+    const row = e.target.closest("tr");
+    if (row) selectNode(row.dataset.id);
+  });
+  $("channels").addEventListener("click", (e) => {
+    const button = e.target.closest("button");
+    if (!button) return;
+    state.channel = button.dataset.channel;
+    renderChannels();
+    renderMessages();
+    $("messages").scrollTop = $("messages").scrollHeight;
+  });
+
+  try {
+    state.config = await fetchJSON("/ui/config.json");
+    if (state.config.background) {
+      const img = new Image();
+      img.onload = () => { state.background = img; drawMap(); };
+      img.src = state.config.background;
+    }
+    const nodes = await fetchJSON("/api/nodes?limit=1000");
+    for (const n of nodes.items) state.nodes.set(n.id, Object.assign({ telemetry: {} }, n));
+    const channels = await fetchJSON("/api/channels");
+    for (const c of channels) {
+      const page = await fetchJSON(`/api/messages?channel=${encodeURIComponent(c.name)}&limit=${MESSAGES_LIMIT}`);
+      for (const m of page.items) addMessage(m, true);
+    }
+  } catch (err) {
+    console.warn(err);
+  }
+  scheduleRender();
+  connect();
+  // Обновление столбца "Слышен"
+  setInterval(renderNodes, 10000);
+}
+
+init();
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/hex"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Размер очереди записи: столько сообщений может ждать записи на диск
+const writerQueueSize = 1024
+
+// rawWriter дописывает сообщения в raw_messages.txt из отдельной горутины, чтобы
+// медленный диск (SD карта Raspberry Pi) не задерживал обработчик MQTT. Если очередь
+// полна, строка отбрасывается и учитывается в dropped.
+type rawWriter struct {
+	file    *os.File
+	queue   chan string
+	done    chan struct{}
+	bytes   atomic.Uint64
+	errors  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+func newRawWriter(filename string) (*rawWriter, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &rawWriter{
+		file:  file,
+		queue: make(chan string, writerQueueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write ставит сообщение в очередь в формате: timestamp | topic | hex_data.
+// Никогда не блокируется: при полной очереди строка теряется.
+func (w *rawWriter) Write(at time.Time, topic string, payload []byte) {
+	timestamp := at.Format("01.02.2006 15:04:05")
+	hexData := hex.EncodeToString(payload)
+	select {
+	case w.queue <- timestamp + " | " + topic + " | " + hexData + "\n":
+	default:
+		if w.dropped.Add(1) == 1 {
+			log.Printf("Writer queue is full, dropping messages (see collector_writer_dropped_lines_total)")
+		}
+	}
+}
+
+func (w *rawWriter) run() {
+	defer close(w.done)
+	for line := range w.queue {
+		n, err := w.file.WriteString(line)
+		w.bytes.Add(uint64(n))
+		if err != nil {
+			w.errors.Add(1)
+			log.Printf("Error writing to file: %v", err)
+		}
+	}
+}
+
+// QueueDepth возвращает число сообщений, ожидающих записи
+func (w *rawWriter) QueueDepth() int {
+	return len(w.queue)
+}
+
+// Close дописывает очередь и закрывает файл
+func (w *rawWriter) Close() error {
+	close(w.queue)
+	<-w.done
+	return w.file.Close()
+}
@@ -0,0 +1,145 @@
+package decoder
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// Поля, значения которых нельзя выводить в отчеты: ключи сессии администрирования,
+// приватный ключ PKI, ключи администраторов, PSK каналов, пароли Wi-Fi и MQTT
+var redactedFields = map[protoreflect.Name]bool{
+	"session_passkey": true,
+	"private_key":     true,
+	"admin_key":       true,
+	"psk":             true,
+	"wifi_psk":        true,
+	"password":        true,
+}
+
+// isRedacted сообщает, что значение поля скрывается. Кроме перечисленных полей
+// скрываются все, в имени которых есть psk или password, - на случай новых настроек.
+func isRedacted(name protoreflect.Name) bool {
+	return redactedFields[name] || strings.Contains(string(name), "psk") || strings.Contains(string(name), "password")
+}
+
+const redacted = "<скрыто>"
+
+// decodeAdmin разбирает AdminMessage и формирует читаемую сводку: кто, кому и что запросил
+func decodeAdmin(payload []byte, record *CSVRecord) {
+	var admin generated.AdminMessage
+	if err := proto.Unmarshal(payload, &admin); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования AdminMessage: %v", err)
+		return
+	}
+
+	msg := admin.ProtoReflect()
+	oneof := msg.Descriptor().Oneofs().ByName("payload_variant")
+	field := msg.WhichOneof(oneof)
+	if field == nil {
+		record.AdminVariant = "empty"
+	} else {
+		record.AdminVariant = string(field.Name())
+	}
+
+	var details string
+	if field != nil {
+		details = formatProtoValue(field, msg.Get(field))
+	}
+	if len(admin.GetSessionPasskey()) > 0 {
+		details = strings.TrimSpace(details + " session_passkey=" + redacted)
+	}
+
+	record.AdminSummary = strings.TrimSpace(fmt.Sprintf("%s -> %s: %s %s",
+		NodeIDFromString(record.From), NodeIDFromString(record.To), record.AdminVariant, details))
+}
+
+// decodeKeyVerification разбирает сообщение рукопожатия проверки ключей KEY_VERIFICATION_APP
+func decodeKeyVerification(payload []byte, record *CSVRecord) {
+	var kv generated.KeyVerification
+	if err := proto.Unmarshal(payload, &kv); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования KeyVerification: %v", err)
+		return
+	}
+
+	// По протоколу: запрос содержит только nonce, ответ - hash2, финал - hash1
+	stage := "request"
+	switch {
+	case len(kv.GetHash1()) > 0:
+		stage = "final"
+	case len(kv.GetHash2()) > 0:
+		stage = "reply"
+	}
+
+	record.AdminVariant = "key_verification_" + stage
+	record.AdminSummary = fmt.Sprintf("%s -> %s: %s %s",
+		NodeIDFromString(record.From), NodeIDFromString(record.To), record.AdminVariant,
+		formatProtoMessage(kv.ProtoReflect()))
+}
+
+// formatProtoMessage выводит установленные поля сообщения в виде {name=value ...}
+func formatProtoMessage(msg protoreflect.Message) string {
+	var fields []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	// Range не гарантирует порядок, выводим по номерам полей
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number() < fields[j].Number() })
+
+	parts := make([]string, 0, len(fields))
+	for _, fd := range fields {
+		parts = append(parts, string(fd.Name())+"="+formatProtoValue(fd, msg.Get(fd)))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// formatProtoValue выводит значение поля с учетом списков, вложенных сообщений и скрытых полей
+func formatProtoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if isRedacted(fd.Name()) {
+		return redacted
+	}
+
+	if fd.IsList() {
+		list := v.List()
+		items := make([]string, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			items = append(items, formatProtoScalar(fd, list.Get(i)))
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	if fd.IsMap() {
+		var items []string
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			items = append(items, k.String()+":"+formatProtoScalar(fd.MapValue(), mv))
+			return true
+		})
+		sort.Strings(items)
+		return "{" + strings.Join(items, " ") + "}"
+	}
+	return formatProtoScalar(fd, v)
+}
+
+func formatProtoScalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return formatProtoMessage(v.Message())
+	case protoreflect.BytesKind:
+		return hex.EncodeToString(v.Bytes())
+	case protoreflect.StringKind:
+		return fmt.Sprintf("%q", v.String())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return fmt.Sprintf("%d", v.Enum())
+	default:
+		return v.String()
+	}
+}
@@ -0,0 +1,75 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+func TestDecodeAdminRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		admin   *generated.AdminMessage
+		secrets []string
+		visible string
+	}{
+		{
+			name: "wifi",
+			admin: &generated.AdminMessage{PayloadVariant: &generated.AdminMessage_SetConfig{SetConfig: &generated.Config{
+				PayloadVariant: &generated.Config_Network{Network: &generated.Config_NetworkConfig{
+					WifiSsid: "dacha", WifiPsk: "wifi-secret",
+				}},
+			}}},
+			secrets: []string{"wifi-secret"},
+			visible: "dacha",
+		},
+		{
+			name: "mqtt",
+			admin: &generated.AdminMessage{PayloadVariant: &generated.AdminMessage_SetModuleConfig{SetModuleConfig: &generated.ModuleConfig{
+				PayloadVariant: &generated.ModuleConfig_Mqtt{Mqtt: &generated.ModuleConfig_MQTTConfig{
+					Address: "mqtt.example.org", Username: "meshdev", Password: "mqtt-secret",
+				}},
+			}}},
+			secrets: []string{"mqtt-secret"},
+			visible: "mqtt.example.org",
+		},
+		{
+			name: "security",
+			admin: &generated.AdminMessage{
+				SessionPasskey: []byte{0xaa, 0xbb},
+				PayloadVariant: &generated.AdminMessage_SetConfig{SetConfig: &generated.Config{
+					PayloadVariant: &generated.Config_Security{Security: &generated.Config_SecurityConfig{
+						PrivateKey: []byte{0xde, 0xad, 0xbe, 0xef},
+						AdminKey:   [][]byte{{0xca, 0xfe, 0xba, 0xbe}},
+					}},
+				}},
+			},
+			secrets: []string{"aabb", "deadbeef", "cafebabe"},
+			visible: "set_config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := proto.Marshal(tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record := CSVRecord{From: "1", To: "2"}
+			decodeAdmin(payload, &record)
+			if record.Error != "" {
+				t.Fatalf("decodeAdmin: %s", record.Error)
+			}
+			for _, secret := range tt.secrets {
+				if strings.Contains(record.AdminSummary, secret) {
+					t.Errorf("summary leaks %q: %s", secret, record.AdminSummary)
+				}
+			}
+			if !strings.Contains(record.AdminSummary, tt.visible) || !strings.Contains(record.AdminSummary, redacted) {
+				t.Errorf("summary = %s, want %q and %s", record.AdminSummary, tt.visible, redacted)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package decoder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Формат часа в отчетах по времени в эфире
+const airtimeHourLayout = "2006-01-02 15:00"
+
+// airTransmission - одна передача пакета в эфир
+type airTransmission struct {
+	Time      time.Time
+	Timestamp string
+	Node      string
+	PacketID  string
+	Channel   string
+	Portnum   string
+	HopLimit  string
+	Bytes     int
+	// Origin - передача самим отправителем, иначе ретрансляция
+	Origin bool
+}
+
+// utilizationReport - показания DeviceMetrics узла
+type utilizationReport struct {
+	Time               time.Time
+	AirUtilTx          float64
+	ChannelUtilization float64
+}
+
+// airtimeTracker считает время в эфире по пакетам захвата.
+//
+// Каждый пакет (from, id) отправитель передает один раз, даже если в захвате
+// видны только ретранслированные копии. Каждое новое значение hop_limit той же
+// пары - еще одна ретрансляция в эфире; кто ретранслировал, по relay_node
+// однозначно не определить, поэтому ретрансляции учитываются только по каналу.
+type airtimeTracker struct {
+	window        time.Duration
+	defaultRegion string
+	defaultPreset string
+
+	transmissions []airTransmission
+	seen          map[string]time.Time
+	regions       map[string]string
+	presets       map[string]string
+	names         map[string]string
+	reports       map[string][]utilizationReport
+
+	// Итоги по узлам, посчитанные WriteReport
+	totals map[string]*airtimeNode
+}
+
+func newAirtimeTracker(window time.Duration, region, preset string) (*airtimeTracker, error) {
+	if _, err := lookupRegion(region); err != nil {
+		return nil, err
+	}
+	if _, err := lookupPreset(preset); err != nil {
+		return nil, err
+	}
+	return &airtimeTracker{
+		window:        window,
+		defaultRegion: region,
+		defaultPreset: preset,
+		seen:          make(map[string]time.Time),
+		regions:       make(map[string]string),
+		presets:       make(map[string]string),
+		names:         make(map[string]string),
+		reports:       make(map[string][]utilizationReport),
+	}, nil
+}
+
+// Observe учитывает копию пакета. Вызывать нужно для всех копий, в том числе
+// повторных, чтобы увидеть ретрансляции с разным hop_limit.
+func (t *airtimeTracker) Observe(record *CSVRecord) {
+	if record.From == "" {
+		return
+	}
+	node := NodeIDFromString(record.From)
+	if record.MapRegion != "" {
+		t.regions[node] = record.MapRegion
+	}
+	if record.MapModemPreset != "" {
+		t.presets[node] = record.MapModemPreset
+	}
+	if record.UserLongName != "" {
+		t.names[node] = record.UserLongName
+	} else if record.MapLongName != "" && t.names[node] == "" {
+		t.names[node] = record.MapLongName
+	}
+
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		return
+	}
+	if airUtil, err := strconv.ParseFloat(record.AirUtilTx, 64); err == nil {
+		channelUtil, _ := strconv.ParseFloat(record.ChannelUtilization, 64)
+		t.reports[node] = append(t.reports[node], utilizationReport{
+			Time: at, AirUtilTx: airUtil, ChannelUtilization: channelUtil,
+		})
+	}
+
+	if record.airBytes == 0 || record.PacketID == "" || record.PacketID == "0" {
+		return
+	}
+
+	transmission := airTransmission{
+		Time:      at,
+		Timestamp: record.Timestamp,
+		Node:      node,
+		PacketID:  record.PacketID,
+		Channel:   record.ChannelID,
+		Portnum:   record.PortnumName,
+		HopLimit:  record.HopLimit,
+		Bytes:     record.airBytes,
+	}
+
+	origin := record.From + "|" + record.PacketID
+	if first, ok := t.seen[origin]; !ok || at.Sub(first) > t.window || first.Sub(at) > t.window {
+		t.seen[origin] = at
+		transmission.Origin = true
+		t.transmissions = append(t.transmissions, transmission)
+	}
+	if record.HopsAway == "" || record.HopsAway == "0" {
+		return
+	}
+	relay := origin + "|" + record.HopLimit
+	if first, ok := t.seen[relay]; !ok || at.Sub(first) > t.window || first.Sub(at) > t.window {
+		t.seen[relay] = at
+		t.transmissions = append(t.transmissions, transmission)
+	}
+}
+
+// modem возвращает параметры региона и пресета узла (из MapReport или по умолчанию)
+func (t *airtimeTracker) modem(node string) (string, loraRegion, string, loraModem) {
+	regionName, presetName := t.defaultRegion, t.defaultPreset
+	region, _ := lookupRegion(regionName)
+	modem, _ := lookupPreset(presetName)
+	if name, ok := t.regions[node]; ok {
+		if r, err := lookupRegion(name); err == nil {
+			regionName, region = name, r
+		}
+	}
+	if name, ok := t.presets[node]; ok {
+		if m, err := lookupPreset(name); err == nil {
+			presetName, modem = name, m
+		}
+	}
+	return regionName, region, presetName, modem
+}
+
+// airtimeBucket - суммарное время в эфире за час
+type airtimeBucket struct {
+	Hour    string
+	Key     string
+	Packets int
+	Origin  int
+	Relayed int
+	Airtime time.Duration
+}
+
+func addToBucket(buckets map[string]*airtimeBucket, hour, key string, tx airTransmission, airtime time.Duration) {
+	id := hour + "|" + key
+	b, ok := buckets[id]
+	if !ok {
+		b = &airtimeBucket{Hour: hour, Key: key}
+		buckets[id] = b
+	}
+	b.Packets++
+	if tx.Origin {
+		b.Origin++
+	} else {
+		b.Relayed++
+	}
+	b.Airtime += airtime
+}
+
+func sortedBuckets(buckets map[string]*airtimeBucket) []*airtimeBucket {
+	list := make([]*airtimeBucket, 0, len(buckets))
+	for _, b := range buckets {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Hour != list[j].Hour {
+			return list[i].Hour < list[j].Hour
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// percentOfHour переводит время в эфире за час в процент
+func percentOfHour(d time.Duration) float64 {
+	return d.Seconds() / 3600 * 100
+}
+
+// airtimeNode - итог по узлу
+type airtimeNode struct {
+	Node        string
+	Region      string
+	Preset      string
+	Packets     int
+	Airtime     time.Duration
+	PeakHour    string
+	PeakAirtime time.Duration
+	DutyLimit   float64
+	OverLimit   int
+}
+
+// WriteReport пишет итоги по узлам в path, почасовые данные по узлам в <path>_hourly,
+// по каналам - в <path>_channels и каждую передачу - в <path>_packets
+func (t *airtimeTracker) WriteReport(path string) error {
+	nodeHours := make(map[string]*airtimeBucket)
+	channelHours := make(map[string]*airtimeBucket)
+	nodes := make(map[string]*airtimeNode)
+
+	packets := [][]string{{"Timestamp", "Node", "PacketID", "Channel", "Portnum", "HopLimit", "Origin",
+		"Bytes", "Preset", "AirtimeMs"}}
+	for _, tx := range t.transmissions {
+		regionName, region, presetName, modem := t.modem(tx.Node)
+		airtime := modem.Airtime(tx.Bytes)
+		hour := tx.Time.Truncate(time.Hour).Format(airtimeHourLayout)
+		packets = append(packets, []string{tx.Timestamp, tx.Node, tx.PacketID, tx.Channel, tx.Portnum,
+			tx.HopLimit, boolToString(tx.Origin), fmt.Sprintf("%d", tx.Bytes), presetName,
+			fmt.Sprintf("%.1f", float64(airtime.Microseconds())/1000)})
+
+		addToBucket(channelHours, hour, tx.Channel, tx, airtime)
+		if !tx.Origin {
+			continue
+		}
+		addToBucket(nodeHours, hour, tx.Node, tx, airtime)
+		n, ok := nodes[tx.Node]
+		if !ok {
+			n = &airtimeNode{Node: tx.Node, Region: regionName, Preset: presetName, DutyLimit: region.DutyCycle}
+			nodes[tx.Node] = n
+		}
+		n.Packets++
+		n.Airtime += airtime
+	}
+
+	hourly := [][]string{{"Hour", "Node", "Name", "Packets", "AirtimeS", "TxPercent", "DutyCycleLimit",
+		"OverLimit", "ReportedAirUtilTx", "ReportedChannelUtilization"}}
+	for _, b := range sortedBuckets(nodeHours) {
+		n := nodes[b.Key]
+		percent := percentOfHour(b.Airtime)
+		over := percent > n.DutyLimit
+		if over {
+			n.OverLimit++
+		}
+		if b.Airtime > n.PeakAirtime {
+			n.PeakHour, n.PeakAirtime = b.Hour, b.Airtime
+		}
+
+		// air_util_tx - доля передачи узла за последний час, channel_utilization - занятость канала
+		reportedTx, reportedCh := "", ""
+		var txValues, chValues []float64
+		for _, r := range t.reports[b.Key] {
+			if r.Time.Truncate(time.Hour).Format(airtimeHourLayout) == b.Hour {
+				txValues = append(txValues, r.AirUtilTx)
+				chValues = append(chValues, r.ChannelUtilization)
+			}
+		}
+		if len(txValues) > 0 {
+			reportedTx, reportedCh = fmt.Sprintf("%.2f", mean(txValues)), fmt.Sprintf("%.2f", mean(chValues))
+		}
+		hourly = append(hourly, []string{b.Hour, b.Key, t.names[b.Key], fmt.Sprintf("%d", b.Packets),
+			fmt.Sprintf("%.2f", b.Airtime.Seconds()), fmt.Sprintf("%.3f", percent),
+			fmt.Sprintf("%.0f", n.DutyLimit), boolToString(over), reportedTx, reportedCh})
+	}
+
+	channels := [][]string{{"Hour", "Channel", "Transmissions", "Origin", "Relayed", "AirtimeS", "Percent"}}
+	for _, b := range sortedBuckets(channelHours) {
+		channels = append(channels, []string{b.Hour, b.Key, fmt.Sprintf("%d", b.Packets),
+			fmt.Sprintf("%d", b.Origin), fmt.Sprintf("%d", b.Relayed),
+			fmt.Sprintf("%.2f", b.Airtime.Seconds()), fmt.Sprintf("%.3f", percentOfHour(b.Airtime))})
+	}
+
+	summary := [][]string{{"Node", "Name", "Region", "Preset", "Packets", "AirtimeS", "PeakHour",
+		"PeakHourPercent", "DutyCycleLimit", "HoursOverLimit", "ReportedAirUtilTxAvg",
+		"ReportedChannelUtilizationAvg"}}
+	for _, n := range t.nodes(nodes) {
+		reportedTx, reportedCh := "", ""
+		if reports := t.reports[n.Node]; len(reports) > 0 {
+			var txValues, chValues []float64
+			for _, r := range reports {
+				txValues = append(txValues, r.AirUtilTx)
+				chValues = append(chValues, r.ChannelUtilization)
+			}
+			reportedTx, reportedCh = fmt.Sprintf("%.2f", mean(txValues)), fmt.Sprintf("%.2f", mean(chValues))
+		}
+		summary = append(summary, []string{n.Node, t.names[n.Node], n.Region, n.Preset,
+			fmt.Sprintf("%d", n.Packets), fmt.Sprintf("%.2f", n.Airtime.Seconds()), n.PeakHour,
+			fmt.Sprintf("%.3f", percentOfHour(n.PeakAirtime)), fmt.Sprintf("%.0f", n.DutyLimit),
+			fmt.Sprintf("%d", n.OverLimit), reportedTx, reportedCh})
+	}
+
+	for _, file := range []struct {
+		path string
+		rows [][]string
+	}{
+		{path, summary},
+		{withSuffix(path, "_hourly"), hourly},
+		{withSuffix(path, "_channels"), channels},
+		{withSuffix(path, "_packets"), packets},
+	} {
+		if err := writeCSVFile(file.path, file.rows); err != nil {
+			return err
+		}
+	}
+
+	t.totals = nodes
+	return nil
+}
+
+// nodes возвращает узлы по убыванию времени в эфире
+func (t *airtimeTracker) nodes(byNode map[string]*airtimeNode) []*airtimeNode {
+	list := make([]*airtimeNode, 0, len(byNode))
+	for _, n := range byNode {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Airtime != list[j].Airtime {
+			return list[i].Airtime > list[j].Airtime
+		}
+		return list[i].Node < list[j].Node
+	})
+	return list
+}
+
+// PrintSummary выводит узлы с наибольшим временем в эфире (после WriteReport)
+func (t *airtimeTracker) PrintSummary() {
+	var total time.Duration
+	for _, n := range t.totals {
+		total += n.Airtime
+	}
+	fmt.Printf("Время в эфире: %d передач, %.1f с собственных передач узлов\n", len(t.transmissions), total.Seconds())
+	for i, n := range t.nodes(t.totals) {
+		if i == 10 {
+			break
+		}
+		fmt.Printf("  %s %s: %.1f с, пик %.2f%% в %s (предел %s %.0f%%)", n.Node, t.names[n.Node],
+			n.Airtime.Seconds(), percentOfHour(n.PeakAirtime), n.PeakHour, n.Region, n.DutyLimit)
+		if n.OverLimit > 0 {
+			fmt.Printf(", превышение в %d ч", n.OverLimit)
+		}
+		fmt.Println()
+	}
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,66 @@
+package decoder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoraAirtime(t *testing.T) {
+	longFast, _ := lookupPreset("LONG_FAST")
+	longSlow, _ := lookupPreset("LONG_SLOW")
+	tests := []struct {
+		name  string
+		modem loraModem
+		bytes int
+		want  time.Duration
+	}{
+		{name: "SF7 125 kHz", modem: loraModem{SpreadingFactor: 7, Bandwidth: 125, CodingRate: 5}, bytes: 10, want: 49408 * time.Microsecond},
+		{name: "LongFast", modem: longFast, bytes: 50, want: 641024 * time.Microsecond},
+		// SF12/125 кГц: символ длиннее 16 мс, включается оптимизация низкой скорости
+		{name: "LongSlow", modem: longSlow, bytes: 20, want: 1974272 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.modem.Airtime(tt.bytes)
+			if diff := got - tt.want; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("Airtime(%d) = %v, want %v", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAirtimeTrackerCountsRelays(t *testing.T) {
+	tracker, err := newAirtimeTracker(time.Minute, "RU", "LONG_FAST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies := []struct {
+		at       string
+		hopLimit string
+		hops     string
+	}{
+		{"11.17.2025 12:00:00", "3", "0"},
+		// Та же передача через другой шлюз
+		{"11.17.2025 12:00:01", "3", "0"},
+		// Ретрансляция и ее повторная копия
+		{"11.17.2025 12:00:02", "2", "1"},
+		{"11.17.2025 12:00:03", "2", "1"},
+		// Номер пакета повторился после окна - новая передача
+		{"11.17.2025 12:05:00", "3", "0"},
+	}
+	for _, c := range copies {
+		tracker.Observe(&CSVRecord{
+			Timestamp: c.at, From: "287454020", PacketID: "42",
+			HopLimit: c.hopLimit, HopsAway: c.hops, airBytes: 40,
+		})
+	}
+	var origins int
+	for _, tx := range tracker.transmissions {
+		if tx.Origin {
+			origins++
+		}
+	}
+	if len(tracker.transmissions) != 3 || origins != 2 {
+		t.Errorf("transmissions = %d (origins %d), want 3 (2)", len(tracker.transmissions), origins)
+	}
+}
@@ -0,0 +1,648 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы правил оповещений
+const (
+	ruleKeyword      = "keyword"       // ключевое слово в тексте сообщения
+	ruleBatteryBelow = "battery_below" // заряд батареи ниже threshold, %
+	ruleVoltageDrop  = "voltage_drop"  // падение напряжения на threshold В за window
+	ruleOffline      = "offline"       // узел молчит дольше after
+	ruleNewNode      = "new_node"      // узел, которого нет в known
+	ruleAlertBell    = "alert_app"     // тревога ALERT_APP или колокольчик в тексте
+	ruleGeofence     = "geofence"      // вход или выход из геозоны (on: enter/exit, по умолчанию оба)
+)
+
+// Состояния оповещения
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// Повторные копии одного пакета через разные шлюзы в течение этого окна дают одно оповещение
+const alertDedupWindow = 10 * time.Minute
+
+// alertConfig - файл правил оповещений:
+//
+//	{
+//	  "sinks": {
+//	    "ops": {"type": "webhook", "url": "http://127.0.0.1:8089/alert", "headers": {"Authorization": "Bearer ..."}},
+//	    "sms": {"type": "command", "command": ["/usr/local/bin/notify", "--urgent"]},
+//	    "log": {"type": "stdout"}
+//	  },
+//	  "rules": [
+//	    {"name": "sos", "type": "keyword", "keywords": ["sos", "помогите"], "cooldown": "1m"},
+//	    {"name": "battery", "type": "battery_below", "threshold": 20, "sinks": ["ops"]},
+//	    {"name": "voltage", "type": "voltage_drop", "threshold": 0.3, "window": "1h"},
+//	    {"name": "offline", "type": "offline", "after": "2h", "nodes": ["!a1b2c3d4"]},
+//	    {"name": "new", "type": "new_node", "known": ["!a1b2c3d4"]},
+//	    {"name": "bell", "type": "alert_app"},
+//	    {"name": "base", "type": "geofence", "fences": ["база"], "on": "exit"}
+//	  ]
+//	}
+//
+// Правило без sinks доставляется во все получатели, без получателей - в stdout.
+type alertConfig struct {
+	Sinks map[string]alertSinkConfig `json:"sinks"`
+	Rules []*alertRule               `json:"rules"`
+}
+
+type alertSinkConfig struct {
+	Type    string            `json:"type"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Command []string          `json:"command,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+}
+
+type alertRule struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Nodes      []string `json:"nodes,omitempty"`
+	Channels   []string `json:"channels,omitempty"`
+	Keywords   []string `json:"keywords,omitempty"`
+	Threshold  float64  `json:"threshold,omitempty"`
+	Hysteresis float64  `json:"hysteresis,omitempty"`
+	Window     string   `json:"window,omitempty"`
+	After      string   `json:"after,omitempty"`
+	Known      []string `json:"known,omitempty"`
+	Fences     []string `json:"fences,omitempty"`
+	On         string   `json:"on,omitempty"`
+	Cooldown   string   `json:"cooldown,omitempty"`
+	// Recovery - слать ли уведомление о восстановлении (по умолчанию да)
+	Recovery *bool    `json:"recovery,omitempty"`
+	Sinks    []string `json:"sinks,omitempty"`
+
+	nodes    map[string]bool
+	known    map[string]bool
+	window   time.Duration
+	after    time.Duration
+	cooldown time.Duration
+}
+
+// alert - одно оповещение или уведомление о восстановлении
+type alert struct {
+	Rule     string    `json:"rule"`
+	Type     string    `json:"type"`
+	State    string    `json:"state"`
+	Time     time.Time `json:"time"`
+	Node     string    `json:"node"`
+	Name     string    `json:"name,omitempty"`
+	Message  string    `json:"message"`
+	Channel  string    `json:"channel,omitempty"`
+	Fence    string    `json:"fence,omitempty"`
+	PacketID string    `json:"packet_id,omitempty"`
+}
+
+func (a alert) String() string {
+	text := fmt.Sprintf("%s [%s %s] %s", a.Time.Format(time.DateTime), a.Rule, a.State, a.Node)
+	if a.Name != "" {
+		text += " (" + a.Name + ")"
+	}
+	return text + ": " + a.Message
+}
+
+// alertSink доставляет оповещения получателю
+type alertSink interface {
+	Send(a alert) error
+}
+
+type stdoutSink struct{}
+
+func (stdoutSink) Send(a alert) error {
+	fmt.Printf("ALERT %s\n", a)
+	return nil
+}
+
+// webhookSink отправляет оповещение JSON-ом методом POST
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *webhookSink) Send(a alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s ответил %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// commandSink запускает локальную команду: оповещение в JSON передается на stdin,
+// основные поля - в переменных окружения ALERT_*
+type commandSink struct {
+	argv    []string
+	timeout time.Duration
+}
+
+func (s *commandSink) Send(a alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(s.argv[0], s.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"ALERT_RULE="+a.Rule, "ALERT_TYPE="+a.Type, "ALERT_STATE="+a.State,
+		"ALERT_NODE="+a.Node, "ALERT_NAME="+a.Name, "ALERT_MESSAGE="+a.Message,
+	)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("команда %s: %w", s.argv[0], err)
+		}
+		return nil
+	case <-time.After(s.timeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("команда %s не завершилась за %s", s.argv[0], s.timeout)
+	}
+}
+
+func newAlertSink(name string, cfg alertSinkConfig) (alertSink, error) {
+	timeout := 10 * time.Second
+	if cfg.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, fmt.Errorf("получатель %q: неверный timeout: %w", name, err)
+		}
+	}
+	switch cfg.Type {
+	case "stdout":
+		return stdoutSink{}, nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("получатель %q: не указан url", name)
+		}
+		return &webhookSink{url: cfg.URL, headers: cfg.Headers, client: &http.Client{Timeout: timeout}}, nil
+	case "command":
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("получатель %q: не указана command", name)
+		}
+		return &commandSink{argv: cfg.Command, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("получатель %q: неизвестный тип %q", name, cfg.Type)
+	}
+}
+
+// parseDurationField разбирает необязательную длительность из файла правил
+func parseDurationField(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// prepare проверяет правило и заполняет разобранные поля
+func (r *alertRule) prepare(sinks map[string]alertSink) error {
+	if r.Name == "" {
+		r.Name = r.Type
+	}
+	var err error
+	if r.nodes, err = parseNodeList(strings.Join(r.Nodes, ",")); err != nil {
+		return err
+	}
+	if r.known, err = parseNodeList(strings.Join(r.Known, ",")); err != nil {
+		return err
+	}
+	if r.cooldown, err = parseDurationField(r.Cooldown, 10*time.Minute); err != nil {
+		return fmt.Errorf("неверный cooldown: %w", err)
+	}
+	if r.window, err = parseDurationField(r.Window, time.Hour); err != nil {
+		return fmt.Errorf("неверный window: %w", err)
+	}
+	if r.after, err = parseDurationField(r.After, time.Hour); err != nil {
+		return fmt.Errorf("неверный after: %w", err)
+	}
+	for _, name := range r.Sinks {
+		if _, ok := sinks[name]; !ok {
+			return fmt.Errorf("неизвестный получатель %q", name)
+		}
+	}
+
+	switch r.Type {
+	case ruleKeyword:
+		if len(r.Keywords) == 0 {
+			return fmt.Errorf("не указаны keywords")
+		}
+		for i, k := range r.Keywords {
+			r.Keywords[i] = strings.ToLower(k)
+		}
+	case ruleBatteryBelow:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("не указан threshold, %%")
+		}
+		if r.Hysteresis == 0 {
+			r.Hysteresis = 5
+		}
+	case ruleVoltageDrop:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("не указан threshold, В")
+		}
+		if r.Hysteresis == 0 {
+			r.Hysteresis = r.Threshold / 2
+		}
+	case ruleGeofence:
+		if r.On != "" && r.On != GeofenceEnter && r.On != GeofenceExit {
+			return fmt.Errorf("on должно быть %q или %q", GeofenceEnter, GeofenceExit)
+		}
+	case ruleOffline, ruleNewNode, ruleAlertBell:
+	default:
+		return fmt.Errorf("неизвестный тип %q", r.Type)
+	}
+	return nil
+}
+
+// matchNode проверяет фильтр узлов правила
+func (r *alertRule) matchNode(node string) bool {
+	return len(r.nodes) == 0 || r.nodes[node]
+}
+
+// recovery возвращает, нужно ли уведомление о восстановлении
+func (r *alertRule) recovery() bool {
+	return r.Recovery == nil || *r.Recovery
+}
+
+type voltageSample struct {
+	Time  time.Time
+	Value float64
+}
+
+// AlertEngine применяет правила к записям и событиям присутствия. Правила-события
+// (keyword, new_node, alert_app) срабатывают на каждый подходящий пакет, правила-состояния
+// (battery_below, voltage_drop, offline) - один раз при входе в состояние и присылают
+// восстановление при выходе из него. Повтор по тому же правилу и узлу сдерживается cooldown.
+// Используется из одной горутины: DecodeCapture или Store живого сборщика.
+type AlertEngine struct {
+	rules    []*alertRule
+	sinks    map[string]alertSink
+	presence *presenceTracker
+
+	active    map[string]bool
+	lastFired map[string]time.Time
+	seen      map[string]time.Time
+	voltages  map[string][]voltageSample
+
+	counts     map[string]int
+	resolved   int
+	suppressed int
+	failed     int
+}
+
+// LoadAlertEngine читает файл правил. Правилам offline и new_node нужно присутствие узлов:
+// его подключают DecodeCapture и Store.SetAlerts.
+func LoadAlertEngine(path string) (*AlertEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %w", path, err)
+	}
+	var cfg alertConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %w", path, err)
+	}
+
+	e := &AlertEngine{
+		sinks:     make(map[string]alertSink),
+		active:    make(map[string]bool),
+		lastFired: make(map[string]time.Time),
+		seen:      make(map[string]time.Time),
+		voltages:  make(map[string][]voltageSample),
+		counts:    make(map[string]int),
+	}
+	for name, sinkCfg := range cfg.Sinks {
+		sink, err := newAlertSink(name, sinkCfg)
+		if err != nil {
+			return nil, err
+		}
+		e.sinks[name] = sink
+	}
+	if len(e.sinks) == 0 {
+		e.sinks["stdout"] = stdoutSink{}
+	}
+	for i, rule := range cfg.Rules {
+		if err := rule.prepare(e.sinks); err != nil {
+			return nil, fmt.Errorf("правило %d (%s): %w", i+1, rule.Name, err)
+		}
+	}
+	e.rules = cfg.Rules
+	return e, nil
+}
+
+// Observe обрабатывает запись вместе с переходами присутствия, которые она вызвала
+func (e *AlertEngine) Observe(record *CSVRecord, events []PresenceEvent) {
+	e.HandlePresence(events)
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil || record.From == "" {
+		return
+	}
+	e.HandleRecord(record, at)
+	e.Check(at)
+}
+
+// HandlePresence применяет правила new_node к переходам присутствия
+func (e *AlertEngine) HandlePresence(events []PresenceEvent) {
+	for _, ev := range events {
+		if ev.From != PresenceUnknown {
+			continue
+		}
+		for _, r := range e.rules {
+			if r.Type != ruleNewNode || !r.matchNode(ev.Node) || r.known[ev.Node] {
+				continue
+			}
+			e.fire(r, alert{Time: ev.Time, Node: ev.Node, Name: ev.Name, Message: "новый узел в сети"})
+		}
+	}
+}
+
+// HandleGeofence применяет правила geofence к событиям входа и выхода из зон
+func (e *AlertEngine) HandleGeofence(events []GeofenceEvent) {
+	for _, ev := range events {
+		for _, r := range e.rules {
+			if r.Type != ruleGeofence || !r.matchNode(ev.Node) ||
+				(r.On != "" && r.On != ev.Kind) ||
+				(len(r.Fences) > 0 && !slices.Contains(r.Fences, ev.Fence)) {
+				continue
+			}
+			message := fmt.Sprintf("вход в зону %s", ev.Fence)
+			if ev.Kind == GeofenceExit {
+				message = fmt.Sprintf("выход из зоны %s", ev.Fence)
+			}
+			e.fire(r, alert{
+				Time: ev.Time, Node: ev.Node, Name: ev.Name, Fence: ev.Fence,
+				Message: fmt.Sprintf("%s: %.5f, %.5f ±%.0f м", message, ev.Lat, ev.Lon, ev.Uncertainty),
+			})
+		}
+	}
+}
+
+// HandleRecord применяет правила к содержимому пакета
+func (e *AlertEngine) HandleRecord(record *CSVRecord, at time.Time) {
+	node := NodeIDFromString(record.From)
+	base := alert{Time: at, Node: node, Name: e.nodeName(node), Channel: record.ChannelID, PacketID: record.PacketID}
+
+	for _, r := range e.rules {
+		if !r.matchNode(node) {
+			continue
+		}
+		switch r.Type {
+		case ruleKeyword:
+			text := strings.ToLower(record.TextMessage)
+			if text == "" || (len(r.Channels) > 0 && !slices.Contains(r.Channels, record.ChannelID)) {
+				continue
+			}
+			for _, k := range r.Keywords {
+				if strings.Contains(text, k) {
+					a := base
+					a.Message = fmt.Sprintf("%q: %s", k, strings.TrimSpace(record.TextMessage))
+					e.fireOnce(r, a)
+					break
+				}
+			}
+
+		case ruleAlertBell:
+			if record.IsAlert != "true" && !strings.Contains(record.TextMessage, "\a") {
+				continue
+			}
+			a := base
+			a.Message = "тревога: " + strings.TrimSpace(strings.ReplaceAll(record.TextMessage, "\a", ""))
+			e.fireOnce(r, a)
+
+		case ruleBatteryBelow:
+			level, err := strconv.ParseFloat(record.BatteryLevel, 64)
+			// 101 - питание от внешнего источника
+			if err != nil || level > 100 {
+				continue
+			}
+			a := base
+			if level < r.Threshold {
+				a.Message = fmt.Sprintf("заряд батареи %.0f%% (порог %.0f%%)", level, r.Threshold)
+				e.raise(r, a)
+			} else if level >= r.Threshold+r.Hysteresis {
+				a.Message = fmt.Sprintf("заряд батареи %.0f%%", level)
+				e.resolve(r, a)
+			}
+
+		case ruleVoltageDrop:
+			voltage, err := strconv.ParseFloat(record.Voltage, 64)
+			if err != nil || voltage <= 0 {
+				continue
+			}
+			samples := append(e.voltages[node], voltageSample{Time: at, Value: voltage})
+			for len(samples) > 0 && at.Sub(samples[0].Time) > r.window {
+				samples = samples[1:]
+			}
+			e.voltages[node] = samples
+			peak := voltage
+			for _, s := range samples {
+				peak = max(peak, s.Value)
+			}
+			a := base
+			if drop := peak - voltage; drop >= r.Threshold {
+				a.Message = fmt.Sprintf("напряжение упало на %.2f В за %s: %.2f -> %.2f В", drop, r.window, peak, voltage)
+				e.raise(r, a)
+			} else if drop <= r.Threshold-r.Hysteresis {
+				a.Message = fmt.Sprintf("напряжение %.2f В", voltage)
+				e.resolve(r, a)
+			}
+
+		case ruleOffline:
+			a := base
+			a.Message = "узел снова в сети"
+			e.resolve(r, a)
+		}
+	}
+}
+
+// Check применяет правила offline к узлам, молчащим на момент now
+func (e *AlertEngine) Check(now time.Time) {
+	if e.presence == nil {
+		return
+	}
+	for _, r := range e.rules {
+		if r.Type != ruleOffline {
+			continue
+		}
+		for _, n := range e.presence.Nodes() {
+			if !r.matchNode(n.Node) || now.Sub(n.LastHeard) <= r.after {
+				continue
+			}
+			e.raise(r, alert{
+				Time: n.LastHeard.Add(r.after), Node: n.Node, Name: n.Name,
+				Message: fmt.Sprintf("нет пакетов дольше %s, последний в %s", r.after, n.LastHeard.Format(time.DateTime)),
+			})
+		}
+	}
+}
+
+func (e *AlertEngine) nodeName(node string) string {
+	if e.presence != nil {
+		if n := e.presence.nodes[node]; n != nil {
+			return n.Name
+		}
+	}
+	return ""
+}
+
+// alertKey - ключ состояния и cooldown: правило, узел и зона (для geofence)
+func alertKey(r *alertRule, a alert) string {
+	return r.Name + "|" + a.Node + "|" + a.Fence
+}
+
+// fireOnce отправляет оповещение-событие один раз на пакет, сколько бы шлюзов его ни приняли
+func (e *AlertEngine) fireOnce(r *alertRule, a alert) {
+	key := alertKey(r, a) + "|" + a.PacketID
+	if seen, ok := e.seen[key]; ok && a.Time.Sub(seen) < alertDedupWindow {
+		return
+	}
+	e.seen[key] = a.Time
+	for k, seen := range e.seen {
+		if a.Time.Sub(seen) >= alertDedupWindow {
+			delete(e.seen, k)
+		}
+	}
+	e.fire(r, a)
+}
+
+// raise переводит правило-состояние узла в firing. Пока состояние активно, повторов нет.
+func (e *AlertEngine) raise(r *alertRule, a alert) {
+	key := alertKey(r, a)
+	if e.active[key] {
+		return
+	}
+	if e.fire(r, a) {
+		e.active[key] = true
+	}
+}
+
+// resolve снимает активное состояние и присылает уведомление о восстановлении
+func (e *AlertEngine) resolve(r *alertRule, a alert) {
+	key := alertKey(r, a)
+	if !e.active[key] {
+		return
+	}
+	delete(e.active, key)
+	if r.recovery() {
+		a.State = alertResolved
+		e.deliver(r, a)
+	}
+}
+
+// fire отправляет оповещение, если не истек cooldown правила для узла
+func (e *AlertEngine) fire(r *alertRule, a alert) bool {
+	key := alertKey(r, a)
+	if last, ok := e.lastFired[key]; ok && a.Time.Sub(last) < r.cooldown {
+		e.suppressed++
+		return false
+	}
+	e.lastFired[key] = a.Time
+	a.State = alertFiring
+	e.deliver(r, a)
+	return true
+}
+
+func (e *AlertEngine) deliver(r *alertRule, a alert) {
+	a.Rule = r.Name
+	a.Type = r.Type
+	if a.State == alertResolved {
+		e.resolved++
+	} else {
+		e.counts[r.Name]++
+	}
+
+	names := r.Sinks
+	if len(names) == 0 {
+		for name := range e.sinks {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	}
+	for _, name := range names {
+		if err := e.sinks[name].Send(a); err != nil {
+			e.failed++
+			fmt.Printf("Ошибка доставки оповещения %s в %s: %v\n", r.Name, name, err)
+		}
+	}
+}
+
+func (e *AlertEngine) PrintSummary() {
+	fired := 0
+	for _, count := range e.counts {
+		fired += count
+	}
+	fmt.Printf("Оповещения: %d срабатываний, %d восстановлений, подавлено cooldown %d, ошибок доставки %d\n",
+		fired, e.resolved, e.suppressed, e.failed)
+	for _, r := range e.rules {
+		if e.counts[r.Name] > 0 {
+			fmt.Printf("  %s (%s): %d\n", r.Name, r.Type, e.counts[r.Name])
+		}
+	}
+}
+
+// ServeAlertSink запускает локальный приемник webhook для проверки правил оповещений:
+// печатает каждый полученный запрос, отвечает кодом status и, если output задан,
+// дописывает тело в этот файл
+func ServeAlertSink(listen, output string, status int) error {
+	var out *os.File
+	if output != "" {
+		var err error
+		out, err = os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("ошибка открытия файла: %w", err)
+		}
+		defer out.Close()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Printf("%s %s %s %s\n", time.Now().Format(time.DateTime), r.Method, r.URL.Path, bytes.TrimSpace(body))
+		if out != nil {
+			out.Write(append(bytes.TrimSpace(body), '\n'))
+		}
+		w.WriteHeader(status)
+	})
+
+	fmt.Printf("Приемник оповещений слушает http://%s/\n", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		return fmt.Errorf("ошибка HTTP сервера: %w", err)
+	}
+	return nil
+}
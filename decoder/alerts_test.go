@@ -0,0 +1,207 @@
+package decoder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordingSink запоминает доставленные оповещения
+type recordingSink struct {
+	alerts []alert
+}
+
+func (s *recordingSink) Send(a alert) error {
+	s.alerts = append(s.alerts, a)
+	return nil
+}
+
+func loadTestAlertEngine(t *testing.T, rules string) (*AlertEngine, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	if err := os.WriteFile(path, []byte(`{"rules": [`+rules+`]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadAlertEngine(path)
+}
+
+// alertStep - пакет в момент at или, если check, проверка молчащих узлов
+type alertStep struct {
+	at     time.Duration
+	record CSVRecord
+	check  bool
+}
+
+func TestAlertRules(t *testing.T) {
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.Local)
+	battery := func(at time.Duration, id int, level string) alertStep {
+		return alertStep{at: at, record: CSVRecord{From: "1", PacketID: fmt.Sprint(id), BatteryLevel: level}}
+	}
+	voltage := func(at time.Duration, id int, value string) alertStep {
+		return alertStep{at: at, record: CSVRecord{From: "1", PacketID: fmt.Sprint(id), Voltage: value}}
+	}
+	text := func(at time.Duration, id int, message string) alertStep {
+		return alertStep{at: at, record: CSVRecord{From: "1", PacketID: fmt.Sprint(id), TextMessage: message}}
+	}
+	check := func(at time.Duration) alertStep {
+		return alertStep{at: at, check: true}
+	}
+
+	tests := []struct {
+		name       string
+		rules      string
+		steps      []alertStep
+		want       []string
+		suppressed int
+	}{
+		{
+			name:  "battery hysteresis and cooldown",
+			rules: `{"name": "battery", "type": "battery_below", "threshold": 20, "cooldown": "1h"}`,
+			steps: []alertStep{
+				battery(0, 1, "30"),
+				battery(time.Minute, 2, "15"),
+				battery(2*time.Minute, 3, "10"),
+				battery(3*time.Minute, 4, "101"),
+				// Внутри гистерезиса состояние не снимается
+				battery(4*time.Minute, 5, "22"),
+				battery(5*time.Minute, 6, "26"),
+				battery(10*time.Minute, 7, "12"),
+				battery(2*time.Hour, 8, "12"),
+			},
+			want:       []string{"battery firing 1m0s", "battery resolved 5m0s", "battery firing 2h0m0s"},
+			suppressed: 1,
+		},
+		{
+			name:  "recovery disabled",
+			rules: `{"name": "battery", "type": "battery_below", "threshold": 20, "recovery": false}`,
+			steps: []alertStep{battery(0, 1, "15"), battery(time.Minute, 2, "30")},
+			want:  []string{"battery firing 0s"},
+		},
+		{
+			name:  "voltage drop",
+			rules: `{"name": "voltage", "type": "voltage_drop", "threshold": 0.3, "window": "1h"}`,
+			steps: []alertStep{
+				voltage(0, 1, "4.10"),
+				voltage(10*time.Minute, 2, "3.95"),
+				voltage(20*time.Minute, 3, "3.75"),
+				voltage(30*time.Minute, 4, "3.70"),
+				voltage(40*time.Minute, 5, "4.05"),
+			},
+			want: []string{"voltage firing 20m0s", "voltage resolved 40m0s"},
+		},
+		{
+			name:  "offline and back",
+			rules: `{"name": "offline", "type": "offline", "after": "30m"}`,
+			steps: []alertStep{
+				text(0, 1, "hello"),
+				check(20 * time.Minute),
+				check(31 * time.Minute),
+				check(40 * time.Minute),
+				text(45*time.Minute, 2, "back"),
+			},
+			want: []string{"offline firing 30m0s", "offline resolved 45m0s"},
+		},
+		{
+			name:  "keyword once per packet",
+			rules: `{"name": "sos", "type": "keyword", "keywords": ["SOS"], "cooldown": "0s"}`,
+			steps: []alertStep{
+				text(0, 1, "sos, need help"),
+				// Тот же пакет через другой шлюз
+				text(time.Second, 1, "sos, need help"),
+				text(time.Minute, 2, "all good"),
+				text(2*time.Minute, 3, "SOS again"),
+			},
+			want: []string{"sos firing 0s", "sos firing 2m0s"},
+		},
+		{
+			name:  "keyword cooldown",
+			rules: `{"name": "sos", "type": "keyword", "keywords": ["sos"]}`,
+			steps: []alertStep{
+				text(0, 1, "sos"),
+				text(5*time.Minute, 2, "sos"),
+				text(11*time.Minute, 3, "sos"),
+			},
+			want:       []string{"sos firing 0s", "sos firing 11m0s"},
+			suppressed: 1,
+		},
+		{
+			name:  "alert app",
+			rules: `{"name": "bell", "type": "alert_app", "cooldown": "0s"}`,
+			steps: []alertStep{
+				{record: CSVRecord{From: "1", PacketID: "1", TextMessage: "fire", IsAlert: "true"}},
+				text(time.Minute, 2, "plain"),
+				text(2*time.Minute, 3, "\aflood"),
+			},
+			want: []string{"bell firing 0s", "bell firing 2m0s"},
+		},
+		{
+			name:  "new node",
+			rules: `{"name": "new", "type": "new_node", "known": ["!00000001"]}`,
+			steps: []alertStep{
+				text(0, 1, "known"),
+				{at: time.Minute, record: CSVRecord{From: "2", PacketID: "2"}},
+				{at: 2 * time.Minute, record: CSVRecord{From: "2", PacketID: "3"}},
+			},
+			want: []string{"new firing 1m0s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := loadTestAlertEngine(t, tt.rules)
+			if err != nil {
+				t.Fatalf("LoadAlertEngine: %v", err)
+			}
+			sink := &recordingSink{}
+			e.sinks = map[string]alertSink{"test": sink}
+			presence := newPresenceTracker(defaultPresenceConfig)
+			e.presence = presence
+
+			for _, step := range tt.steps {
+				at := start.Add(step.at)
+				if step.check {
+					e.Check(at)
+					continue
+				}
+				record := step.record
+				record.Timestamp = CaptureTimestamp(at)
+				e.Observe(&record, presence.Observe(&record))
+			}
+
+			var got []string
+			for _, a := range sink.alerts {
+				got = append(got, fmt.Sprintf("%s %s %v", a.Rule, a.State, a.Time.Sub(start)))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("alerts = %q, want %q", got, tt.want)
+			}
+			if e.suppressed != tt.suppressed {
+				t.Errorf("suppressed = %d, want %d", e.suppressed, tt.suppressed)
+			}
+		})
+	}
+}
+
+func TestLoadAlertEngineErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "unknown type", rules: `{"type": "weather"}`},
+		{name: "no keywords", rules: `{"type": "keyword"}`},
+		{name: "no threshold", rules: `{"type": "battery_below"}`},
+		{name: "bad cooldown", rules: `{"type": "offline", "cooldown": "soon"}`},
+		{name: "unknown sink", rules: `{"type": "offline", "sinks": ["pager"]}`},
+		{name: "bad node", rules: `{"type": "offline", "nodes": ["!zz"]}`},
+		{name: "bad geofence kind", rules: `{"type": "geofence", "on": "inside"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadTestAlertEngine(t, tt.rules); err == nil {
+				t.Error("LoadAlertEngine: want error")
+			}
+		})
+	}
+}
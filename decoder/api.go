@@ -0,0 +1,724 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Пределы хранилища API по умолчанию
+const (
+	DefaultStorePackets  = 50000
+	storeMessages        = 10000
+	storeGeofenceEvents  = 10000
+	storeHistoryPerNode  = 2000
+	storeRecentMessages  = 50
+	apiDefaultLimit      = 100
+	apiMaxLimit          = 1000
+	apiTimeFormatExample = "2006-01-02 15:04:05"
+)
+
+// apiPosition - позиция узла
+type apiPosition struct {
+	Time        time.Time `json:"time"`
+	Lat         float64   `json:"lat"`
+	Lon         float64   `json:"lon"`
+	Altitude    *float64  `json:"altitude,omitempty"`
+	Uncertainty float64   `json:"uncertainty_m"`
+}
+
+// apiHistoryEntry - точка истории узла: позиция или показания телеметрии
+type apiHistoryEntry struct {
+	Time      time.Time          `json:"time"`
+	Kind      string             `json:"kind"`
+	PacketID  string             `json:"packet_id,omitempty"`
+	Position  *apiPosition       `json:"position,omitempty"`
+	Telemetry map[string]float64 `json:"telemetry,omitempty"`
+}
+
+// apiMessage - текстовое сообщение канала. Alert - тревога ALERT_APP.
+type apiMessage struct {
+	Time     time.Time `json:"time"`
+	Channel  string    `json:"channel"`
+	From     string    `json:"from"`
+	FromName string    `json:"from_name,omitempty"`
+	To       string    `json:"to"`
+	PacketID string    `json:"packet_id"`
+	ReplyID  string    `json:"reply_id,omitempty"`
+	Text     string    `json:"text"`
+	Alert    bool      `json:"alert,omitempty"`
+	Gateways []string  `json:"gateways"`
+}
+
+// apiPacket - одна копия пакета, принятая шлюзом
+type apiPacket struct {
+	Time      time.Time          `json:"time"`
+	Topic     string             `json:"topic"`
+	Gateway   string             `json:"gateway,omitempty"`
+	Channel   string             `json:"channel,omitempty"`
+	From      string             `json:"from,omitempty"`
+	To        string             `json:"to,omitempty"`
+	ID        string             `json:"id"`
+	Portnum   string             `json:"portnum,omitempty"`
+	HopLimit  *int               `json:"hop_limit,omitempty"`
+	HopStart  *int               `json:"hop_start,omitempty"`
+	HopsAway  *int               `json:"hops_away,omitempty"`
+	RelayNode string             `json:"relay_node,omitempty"`
+	SNR       *float64           `json:"snr,omitempty"`
+	RSSI      *int               `json:"rssi,omitempty"`
+	ViaMQTT   bool               `json:"via_mqtt,omitempty"`
+	Encrypted bool               `json:"encrypted,omitempty"`
+	EventType string             `json:"event_type,omitempty"`
+	Alert     bool               `json:"alert,omitempty"`
+	Text      string             `json:"text,omitempty"`
+	ReplyID   string             `json:"reply_id,omitempty"`
+	Position  *apiPosition       `json:"position,omitempty"`
+	Telemetry map[string]float64 `json:"telemetry,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// apiGeofenceEvent - вход узла в геозону или выход из нее
+type apiGeofenceEvent struct {
+	Time        time.Time `json:"time"`
+	Node        string    `json:"node"`
+	Name        string    `json:"name,omitempty"`
+	Fence       string    `json:"fence"`
+	Kind        string    `json:"kind"`
+	Lat         float64   `json:"lat"`
+	Lon         float64   `json:"lon"`
+	Uncertainty float64   `json:"uncertainty_m"`
+	Distance    float64   `json:"distance_m"`
+}
+
+func newAPIGeofenceEvent(e GeofenceEvent) *apiGeofenceEvent {
+	return &apiGeofenceEvent{
+		Time: e.Time, Node: e.Node, Name: e.Name, Fence: e.Fence, Kind: e.Kind,
+		Lat: e.Lat, Lon: e.Lon, Uncertainty: e.Uncertainty, Distance: e.Distance,
+	}
+}
+
+// apiNode - последнее состояние узла
+type apiNode struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name,omitempty"`
+	ShortName   string             `json:"short_name,omitempty"`
+	HwModel     string             `json:"hw_model,omitempty"`
+	Role        string             `json:"role,omitempty"`
+	State       string             `json:"state"`
+	FirstHeard  time.Time          `json:"first_heard"`
+	LastHeard   time.Time          `json:"last_heard"`
+	LastDirect  *time.Time         `json:"last_direct,omitempty"`
+	LastGateway string             `json:"last_gateway,omitempty"`
+	HopsAway    *int               `json:"hops_away,omitempty"`
+	SNR         *float64           `json:"snr,omitempty"`
+	Packets     int                `json:"packets"`
+	Interval    float64            `json:"beacon_interval_s,omitempty"`
+	Position    *apiPosition       `json:"position,omitempty"`
+	Telemetry   map[string]float64 `json:"telemetry,omitempty"`
+	TelemetryAt *time.Time         `json:"telemetry_time,omitempty"`
+}
+
+// apiPage - ответ со страницей списка
+type apiPage struct {
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Items  any `json:"items"`
+}
+
+// storeNode - сведения об узле, которых нет в presenceTracker
+type storeNode struct {
+	ShortName   string
+	HwModel     string
+	Role        string
+	HopsAway    *int
+	SNR         *float64
+	Telemetry   map[string]float64
+	TelemetryAt time.Time
+	history     []apiHistoryEntry
+}
+
+// Store хранит в памяти последние декодированные пакеты, историю узлов и текстовые
+// сообщения и отдает их через HTTP API. Наполняется из файла захвата (подкоманда
+// serve) или живым сборщиком cmd/parser. Старые пакеты вытесняются по лимиту.
+type Store struct {
+	mu         sync.RWMutex
+	maxPackets int
+	// Now возвращает текущее время для состояния узлов; nil - время последнего пакета
+	Now func() time.Time
+	// OnPresence вызывается на каждый переход состояния узла (под блокировкой хранилища)
+	OnPresence func(event PresenceEvent)
+	// OnGeofence вызывается на каждое событие геозоны (под блокировкой хранилища)
+	OnGeofence func(event GeofenceEvent)
+
+	presence *presenceTracker
+	alerts   *AlertEngine
+	geofence []*apiGeofenceEvent
+	nodes    map[string]*storeNode
+	packets  []*CSVRecord
+	byPacket map[string][]*CSVRecord
+	messages []*apiMessage
+	last     time.Time
+}
+
+// NewStore создает хранилище на maxPackets пакетов (0 - значение по умолчанию)
+func NewStore(maxPackets int) *Store {
+	if maxPackets <= 0 {
+		maxPackets = DefaultStorePackets
+	}
+	return &Store{
+		maxPackets: maxPackets,
+		presence:   newPresenceTracker(defaultPresenceConfig),
+		nodes:      make(map[string]*storeNode),
+		byPacket:   make(map[string][]*CSVRecord),
+	}
+}
+
+// Add добавляет декодированную запись (каждую копию пакета через разные шлюзы)
+func (s *Store) Add(record CSVRecord) {
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.After(s.last) {
+		s.last = at
+	}
+	r := &record
+	s.packets = append(s.packets, r)
+	if r.PacketID != "" && r.PacketID != "0" {
+		s.byPacket[r.PacketID] = append(s.byPacket[r.PacketID], r)
+	}
+	if len(s.packets) > s.maxPackets {
+		s.evict(len(s.packets) - s.maxPackets*3/4)
+	}
+
+	if r.From == "" {
+		return
+	}
+	events := s.presence.Observe(r)
+	s.notify(events)
+	if s.alerts != nil {
+		s.alerts.Observe(r, events)
+	}
+	node := NodeIDFromString(r.From)
+	n := s.nodes[node]
+	if n == nil {
+		n = &storeNode{}
+		s.nodes[node] = n
+	}
+	s.updateNode(n, r, at)
+	if r.TextMessage != "" && (r.EventType == "" || r.IsAlert == "true") {
+		s.addMessage(r, node, at)
+	}
+}
+
+// Advance переводит замолчавшие узлы в stale и offline на момент now.
+// Живой сборщик вызывает его по таймеру, чтобы переходы не ждали следующего пакета.
+func (s *Store) Advance(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify(s.presence.Advance(now))
+	if s.alerts != nil {
+		s.alerts.Check(now)
+	}
+}
+
+// SetAlerts подключает правила оповещений к пакетам и присутствию узлов хранилища.
+// Правила offline проверяются в Advance, оповещения доставляются под блокировкой хранилища.
+func (s *Store) SetAlerts(e *AlertEngine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.presence = s.presence
+	s.alerts = e
+}
+
+// HandleGeofence сохраняет события входа и выхода из геозон для /api/geofence
+// и передает их подписчику OnGeofence и правилам оповещений
+func (s *Store) HandleGeofence(events []GeofenceEvent) {
+	if len(events) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		s.geofence = append(s.geofence, newAPIGeofenceEvent(e))
+		if s.OnGeofence != nil {
+			s.OnGeofence(e)
+		}
+	}
+	if len(s.geofence) > storeGeofenceEvents {
+		s.geofence = append([]*apiGeofenceEvent(nil), s.geofence[len(s.geofence)-storeGeofenceEvents:]...)
+	}
+	if s.alerts != nil {
+		s.alerts.HandleGeofence(events)
+	}
+}
+
+// notify передает переходы состояния узлов подписчику OnPresence
+func (s *Store) notify(events []PresenceEvent) {
+	if s.OnPresence == nil {
+		return
+	}
+	for _, e := range events {
+		s.OnPresence(e)
+	}
+}
+
+// evict удаляет count самых старых пакетов
+func (s *Store) evict(count int) {
+	for _, r := range s.packets[:count] {
+		copies := s.byPacket[r.PacketID]
+		for i, c := range copies {
+			if c == r {
+				copies = append(copies[:i], copies[i+1:]...)
+				break
+			}
+		}
+		if len(copies) == 0 {
+			delete(s.byPacket, r.PacketID)
+		} else {
+			s.byPacket[r.PacketID] = copies
+		}
+	}
+	s.packets = append([]*CSVRecord(nil), s.packets[count:]...)
+}
+
+func (s *Store) updateNode(n *storeNode, r *CSVRecord, at time.Time) {
+	n.ShortName = firstNonEmpty(r.UserShortName, r.MapShortName, n.ShortName)
+	n.HwModel = firstNonEmpty(r.UserHwModel, r.MapHwModel, n.HwModel)
+	n.Role = firstNonEmpty(r.MapRole, n.Role)
+	if hops, err := strconv.Atoi(r.HopsAway); err == nil {
+		n.HopsAway = &hops
+		if snr, err := strconv.ParseFloat(r.RxSNR, 64); err == nil && hops == 0 {
+			n.SNR = &snr
+		}
+	}
+
+	// Повторные копии пакета в историю не попадают
+	if len(n.history) > 0 && r.PacketID != "" && n.history[len(n.history)-1].PacketID == r.PacketID {
+		return
+	}
+	if pos, ok := recordPosition(r); ok {
+		n.history = append(n.history, apiHistoryEntry{
+			Time: at, Kind: "position", PacketID: r.PacketID, Position: newAPIPosition(pos, r, at),
+		})
+	}
+	if len(r.metrics) > 0 {
+		values := make(map[string]float64, len(r.metrics))
+		for _, m := range r.metrics {
+			values[m.Name] = m.Value
+		}
+		n.history = append(n.history, apiHistoryEntry{Time: at, Kind: "telemetry", PacketID: r.PacketID, Telemetry: values})
+		if !at.Before(n.TelemetryAt) {
+			n.Telemetry = values
+			n.TelemetryAt = at
+		}
+	}
+	if len(n.history) > storeHistoryPerNode {
+		n.history = append([]apiHistoryEntry(nil), n.history[len(n.history)-storeHistoryPerNode:]...)
+	}
+}
+
+func newAPIPosition(pos geoPosition, r *CSVRecord, at time.Time) *apiPosition {
+	p := &apiPosition{Time: at, Lat: pos.Lat, Lon: pos.Lon, Uncertainty: pos.Uncertainty}
+	if alt, err := strconv.ParseFloat(r.Altitude, 64); err == nil && alt != 0 {
+		p.Altitude = &alt
+	}
+	return p
+}
+
+func newAPIPacket(r *CSVRecord) apiPacket {
+	at, _ := parseTimestamp(r.Timestamp)
+	p := apiPacket{
+		Time: at, Topic: r.Topic, Gateway: r.GatewayID, Channel: r.ChannelID, ID: r.PacketID,
+		Portnum: r.PortnumName, RelayNode: r.RelayNode, ViaMQTT: r.ViaMQTT == "true",
+		Encrypted: r.EncryptedData != "", EventType: r.EventType, Alert: r.IsAlert == "true",
+		Text: r.TextMessage, ReplyID: r.ReplyID, Error: r.Error,
+	}
+	if r.From != "" {
+		p.From = NodeIDFromString(r.From)
+	}
+	if r.To != "" {
+		p.To = NodeIDFromString(r.To)
+	}
+	p.HopLimit = optionalInt(r.HopLimit)
+	p.HopStart = optionalInt(r.HopStart)
+	p.HopsAway = optionalInt(r.HopsAway)
+	p.RSSI = optionalInt(r.RxRSSI)
+	if snr, err := strconv.ParseFloat(r.RxSNR, 64); err == nil {
+		p.SNR = &snr
+	}
+	if pos, ok := recordPosition(r); ok {
+		p.Position = newAPIPosition(pos, r, at)
+	}
+	if len(r.metrics) > 0 {
+		p.Telemetry = make(map[string]float64, len(r.metrics))
+		for _, m := range r.metrics {
+			p.Telemetry[m.Name] = m.Value
+		}
+	}
+	return p
+}
+
+// optionalInt разбирает необязательное целое поле записи, nil - поле пустое
+func optionalInt(value string) *int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func (s *Store) addMessage(r *CSVRecord, node string, at time.Time) {
+	// Копия уже сохраненного сообщения добавляет только шлюз
+	for i := len(s.messages) - 1; i >= max(len(s.messages)-storeRecentMessages, 0); i-- {
+		m := s.messages[i]
+		if m.From == node && m.PacketID == r.PacketID {
+			m.Gateways = append(m.Gateways, r.GatewayID)
+			return
+		}
+	}
+	s.messages = append(s.messages, &apiMessage{
+		Time: at, Channel: r.ChannelID, From: node, FromName: s.presence.nodes[node].Name,
+		To: NodeIDFromString(r.To), PacketID: r.PacketID, ReplyID: r.ReplyID,
+		Text: r.TextMessage, Alert: r.IsAlert == "true", Gateways: []string{r.GatewayID},
+	})
+	if len(s.messages) > storeMessages {
+		s.messages = append([]*apiMessage(nil), s.messages[len(s.messages)-storeMessages:]...)
+	}
+}
+
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return s.last
+}
+
+// Handler возвращает обработчик HTTP API:
+//
+//	GET /api/nodes                    узлы с последним состоянием (?state=online&since=&until=)
+//	GET /api/nodes/{id}               один узел
+//	GET /api/nodes/{id}/history       позиции и телеметрия узла (?kind=position|telemetry&since=&until=)
+//	GET /api/channels                 каналы с числом сообщений
+//	GET /api/messages                 текстовые сообщения, новые первыми (?channel=&node=&since=&until=)
+//	GET /api/geofence                 входы и выходы из геозон, новые первыми (?fence=&node=&kind=enter|exit&since=&until=)
+//	GET /api/packets/{id}             все копии пакета по его id
+//
+// Списки постраничные: ?limit= (по умолчанию 100, не больше 1000) и ?offset=.
+func (s *Store) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/nodes", s.handleNodes)
+	mux.HandleFunc("GET /api/nodes/{id}", s.handleNode)
+	mux.HandleFunc("GET /api/nodes/{id}/history", s.handleHistory)
+	mux.HandleFunc("GET /api/channels", s.handleChannels)
+	mux.HandleFunc("GET /api/messages", s.handleMessages)
+	mux.HandleFunc("GET /api/geofence", s.handleGeofence)
+	mux.HandleFunc("GET /api/packets/{id}", s.handlePacket)
+	return mux
+}
+
+// apiQuery - общие параметры списков
+type apiQuery struct {
+	Limit, Offset int
+	Since, Until  time.Time
+}
+
+func parseAPIQuery(r *http.Request) (apiQuery, error) {
+	q := apiQuery{Limit: apiDefaultLimit}
+	values := r.URL.Query()
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("неверный limit %q", v)
+		}
+		q.Limit = min(n, apiMaxLimit)
+	}
+	if v := values.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("неверный offset %q", v)
+		}
+		q.Offset = n
+	}
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := values.Get(p.name); v != "" {
+			t, err := parseTimeFlag(v)
+			if err != nil {
+				return q, fmt.Errorf("неверное время %s=%q, ожидается RFC3339 или %s", p.name, v, apiTimeFormatExample)
+			}
+			*p.target = t
+		}
+	}
+	return q, nil
+}
+
+// InRange проверяет попадание времени в интервал запроса
+func (q apiQuery) InRange(at time.Time) bool {
+	return (q.Since.IsZero() || !at.Before(q.Since)) && (q.Until.IsZero() || !at.After(q.Until))
+}
+
+// page вырезает страницу из списка
+func page[T any](items []T, q apiQuery) apiPage {
+	if items == nil {
+		items = []T{}
+	}
+	start := min(q.Offset, len(items))
+	end := min(start+q.Limit, len(items))
+	return apiPage{Total: len(items), Offset: q.Offset, Limit: q.Limit, Items: items[start:end]}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// parseNodeID разбирает ID узла из пути: !xxxxxxxx или десятичный номер
+func parseNodeID(value string) (string, error) {
+	nodes, err := parseNodeList(value)
+	if err != nil {
+		return "", err
+	}
+	for node := range nodes {
+		return node, nil
+	}
+	return "", fmt.Errorf("не указан ID узла")
+}
+
+func (s *Store) node(id string) apiNode {
+	p := s.presence.nodes[id]
+	n := s.nodes[id]
+	node := apiNode{
+		ID: id, Name: p.Name, ShortName: n.ShortName, HwModel: n.HwModel, Role: n.Role,
+		State: string(p.State), FirstHeard: p.FirstHeard, LastHeard: p.LastHeard,
+		LastGateway: p.LastGateway, HopsAway: n.HopsAway, SNR: n.SNR, Packets: p.Packets,
+		Interval: p.Interval(s.presence.config.MinSamples).Seconds(), Telemetry: n.Telemetry,
+	}
+	if !p.LastDirect.IsZero() {
+		node.LastDirect = &p.LastDirect
+	}
+	if !n.TelemetryAt.IsZero() {
+		node.TelemetryAt = &n.TelemetryAt
+	}
+	for i := len(n.history) - 1; i >= 0; i-- {
+		if n.history[i].Position != nil {
+			node.Position = n.history[i].Position
+			break
+		}
+	}
+	return node
+}
+
+func (s *Store) handleNodes(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAPIQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	state := r.URL.Query().Get("state")
+
+	// Advance меняет состояние узлов, поэтому нужна блокировка на запись
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify(s.presence.Advance(s.now()))
+
+	var nodes []apiNode
+	for _, p := range s.presence.Nodes() {
+		if !q.InRange(p.LastHeard) || (state != "" && string(p.State) != state) {
+			continue
+		}
+		nodes = append(nodes, s.node(p.Node))
+	}
+	// Недавно слышанные первыми
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].LastHeard.After(nodes[j].LastHeard) })
+	writeJSON(w, http.StatusOK, page(nodes, q))
+}
+
+func (s *Store) handleNode(w http.ResponseWriter, r *http.Request) {
+	id, err := parseNodeID(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes[id] == nil {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("узел %s не найден", id))
+		return
+	}
+	s.notify(s.presence.Advance(s.now()))
+	writeJSON(w, http.StatusOK, s.node(id))
+}
+
+func (s *Store) handleHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := parseNodeID(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	q, err := parseAPIQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := s.nodes[id]
+	if n == nil {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("узел %s не найден", id))
+		return
+	}
+	var entries []apiHistoryEntry
+	for i := len(n.history) - 1; i >= 0; i-- {
+		e := n.history[i]
+		if q.InRange(e.Time) && (kind == "" || e.Kind == kind) {
+			entries = append(entries, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, page(entries, q))
+}
+
+func (s *Store) handleChannels(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type channel struct {
+		Name     string    `json:"name"`
+		Messages int       `json:"messages"`
+		Last     time.Time `json:"last_message"`
+	}
+	byName := make(map[string]*channel)
+	channels := []*channel{}
+	for _, m := range s.messages {
+		c := byName[m.Channel]
+		if c == nil {
+			c = &channel{Name: m.Channel}
+			byName[m.Channel] = c
+			channels = append(channels, c)
+		}
+		c.Messages++
+		c.Last = m.Time
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func (s *Store) handleMessages(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAPIQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	channel := r.URL.Query().Get("channel")
+	var node string
+	if v := r.URL.Query().Get("node"); v != "" {
+		if node, err = parseNodeID(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var messages []*apiMessage
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		m := s.messages[i]
+		if q.InRange(m.Time) && (channel == "" || m.Channel == channel) && (node == "" || m.From == node || m.To == node) {
+			messages = append(messages, m)
+		}
+	}
+	writeJSON(w, http.StatusOK, page(messages, q))
+}
+
+func (s *Store) handleGeofence(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAPIQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	fence := r.URL.Query().Get("fence")
+	kind := r.URL.Query().Get("kind")
+	var node string
+	if v := r.URL.Query().Get("node"); v != "" {
+		if node, err = parseNodeID(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []*apiGeofenceEvent
+	for i := len(s.geofence) - 1; i >= 0; i-- {
+		e := s.geofence[i]
+		if q.InRange(e.Time) && (fence == "" || e.Fence == fence) && (kind == "" || e.Kind == kind) && (node == "" || e.Node == node) {
+			events = append(events, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, page(events, q))
+}
+
+func (s *Store) handlePacket(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	// id можно передать в шестнадцатеричном виде, как его показывает прошивка: 0x1a2b3c4d
+	if hexID, ok := strings.CutPrefix(strings.ToLower(id), "0x"); ok {
+		n, err := strconv.ParseUint(hexID, 16, 32)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("неверный id пакета %q", id))
+			return
+		}
+		id = strconv.FormatUint(n, 10)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	copies := s.byPacket[id]
+	if len(copies) == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("пакет %s не найден", id))
+		return
+	}
+	packets := make([]apiPacket, len(copies))
+	for i, c := range copies {
+		packets[i] = newAPIPacket(c)
+	}
+	writeJSON(w, http.StatusOK, packets)
+}
+
+// ServeCapture загружает файл захвата в Store (не больше maxPackets последних пакетов)
+// и отдает HTTP API на адресе listen. Возвращает только ошибку сервера.
+func ServeCapture(capturePath, listen string, maxPackets int) error {
+	store := NewStore(maxPackets)
+	count := 0
+	if err := forEachCaptureRecord(capturePath, func(record *CSVRecord) {
+		store.Add(*record)
+		count++
+	}); err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	fmt.Printf("Загружено %d сообщений, %d узлов, %d текстовых сообщений\n", count, len(store.nodes), len(store.messages))
+	fmt.Printf("HTTP API: http://%s/api/nodes\n", listen)
+	if err := http.ListenAndServe(listen, store.Handler()); err != nil {
+		return fmt.Errorf("ошибка HTTP сервера: %w", err)
+	}
+	return nil
+}
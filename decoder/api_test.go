@@ -0,0 +1,251 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, time.Time) {
+	t.Helper()
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.Local)
+	at := func(d time.Duration) string { return CaptureTimestamp(start.Add(d)) }
+	text := func(gateway string) CSVRecord {
+		return CSVRecord{
+			Timestamp: at(time.Second), Topic: "msh/EU_868/2/e/LongFast/" + gateway, GatewayID: gateway,
+			ChannelID: "LongFast", From: "1", To: "4294967295", PacketID: "100", PortnumName: "TEXT_MESSAGE_APP",
+			HopLimit: "3", HopStart: "3", HopsAway: "0", RxSNR: "6.50", RxRSSI: "-90", TextMessage: "hello",
+		}
+	}
+
+	store := NewStore(0)
+	for _, r := range []CSVRecord{
+		{Timestamp: at(0), GatewayID: "!00000010", From: "1", PacketID: "99", UserLongName: "Alpha", UserShortName: "ALP"},
+		text("!00000010"),
+		text("!00000011"),
+		{
+			Timestamp: at(30 * time.Second), GatewayID: "!00000010", ChannelID: "Ops", From: "2", To: "1",
+			PacketID: "101", PortnumName: "ALERT_APP", EventType: eventAlert, IsAlert: "true", TextMessage: "fire",
+		},
+		{
+			Timestamp: at(40 * time.Second), GatewayID: "!00000010", ChannelID: "Ops", From: "2", To: "4294967295",
+			PacketID: "102", PortnumName: "DETECTION_SENSOR_APP", EventType: eventDetection, TextMessage: "motion",
+		},
+		{
+			Timestamp: at(time.Minute), GatewayID: "!00000010", From: "1", PacketID: "103", PortnumName: "POSITION_APP",
+			Latitude: "64.5000000", Longitude: "40.5000000", Altitude: "120",
+		},
+	} {
+		store.Add(r)
+	}
+
+	var notified []string
+	store.OnGeofence = func(e GeofenceEvent) { notified = append(notified, e.Node+" "+e.Kind) }
+	store.HandleGeofence([]GeofenceEvent{
+		{Time: start.Add(2 * time.Minute), Node: "!00000001", Fence: "base", Kind: GeofenceEnter},
+		{Time: start.Add(3 * time.Minute), Node: "!00000002", Fence: "base", Kind: GeofenceExit},
+		{Time: start.Add(4 * time.Minute), Node: "!00000001", Fence: "lake", Kind: GeofenceEnter},
+	})
+	if want := []string{"!00000001 enter", "!00000002 exit", "!00000001 enter"}; !slices.Equal(notified, want) {
+		t.Fatalf("OnGeofence = %q, want %q", notified, want)
+	}
+	return store, start
+}
+
+// apiList - страница списка с элементами нужного типа
+type apiList[T any] struct {
+	Total int `json:"total"`
+	Items []T `json:"items"`
+}
+
+func TestStoreAPI(t *testing.T) {
+	store, start := newTestStore(t)
+	server := httptest.NewServer(store.Handler())
+	defer server.Close()
+
+	get := func(t *testing.T, path string, status int, v any) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("GET %s = %d, want %d", path, resp.StatusCode, status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		check  func(t *testing.T, path string, status int)
+	}{
+		{name: "nodes", path: "/api/nodes", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiNode]
+			get(t, path, status, &page)
+			var ids []string
+			for _, n := range page.Items {
+				ids = append(ids, n.ID)
+			}
+			// Недавно слышанные первыми
+			if want := []string{"!00000001", "!00000002"}; page.Total != 2 || !slices.Equal(ids, want) {
+				t.Errorf("nodes = %d %q, want %q", page.Total, ids, want)
+			}
+		}},
+		{name: "nodes paged", path: "/api/nodes?limit=1&offset=1", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiNode]
+			get(t, path, status, &page)
+			if page.Total != 2 || len(page.Items) != 1 || page.Items[0].ID != "!00000002" {
+				t.Errorf("page = %+v", page)
+			}
+		}},
+		{name: "node", path: "/api/nodes/1", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var node apiNode
+			get(t, path, status, &node)
+			if node.ID != "!00000001" || node.Name != "Alpha" || node.ShortName != "ALP" || node.State != string(PresenceOnline) {
+				t.Errorf("node = %+v", node)
+			}
+			if node.SNR == nil || *node.SNR != 6.5 || node.HopsAway == nil || *node.HopsAway != 0 {
+				t.Errorf("node snr/hops = %v/%v", node.SNR, node.HopsAway)
+			}
+			if p := node.Position; p == nil || p.Lat != 64.5 || p.Altitude == nil || *p.Altitude != 120 {
+				t.Errorf("node position = %+v", p)
+			}
+		}},
+		{name: "node not found", path: "/api/nodes/!0000abcd", status: http.StatusNotFound, check: func(t *testing.T, path string, status int) {
+			var body map[string]string
+			get(t, path, status, &body)
+			if body["error"] == "" {
+				t.Error("want error message")
+			}
+		}},
+		{name: "bad node id", path: "/api/nodes/!zz", status: http.StatusBadRequest, check: func(t *testing.T, path string, status int) {
+			get(t, path, status, &map[string]string{})
+		}},
+		{name: "history", path: "/api/nodes/!00000001/history?kind=position", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiHistoryEntry]
+			get(t, path, status, &page)
+			if page.Total != 1 || page.Items[0].PacketID != "103" {
+				t.Errorf("history = %+v", page)
+			}
+		}},
+		{name: "messages", path: "/api/messages", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiMessage]
+			get(t, path, status, &page)
+			// Detection Sensor не чат, тревога ALERT_APP - чат с флагом alert
+			if page.Total != 2 {
+				t.Fatalf("messages = %+v", page.Items)
+			}
+			alert, text := page.Items[0], page.Items[1]
+			if alert.Text != "fire" || !alert.Alert || alert.To != "!00000001" {
+				t.Errorf("alert message = %+v", alert)
+			}
+			if text.Text != "hello" || text.Alert || text.FromName != "Alpha" || len(text.Gateways) != 2 {
+				t.Errorf("text message = %+v", text)
+			}
+		}},
+		{name: "messages by channel", path: "/api/messages?channel=LongFast", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiMessage]
+			get(t, path, status, &page)
+			if page.Total != 1 || page.Items[0].PacketID != "100" {
+				t.Errorf("messages = %+v", page.Items)
+			}
+		}},
+		{name: "messages by time", path: "/api/messages?since=" + url.QueryEscape(start.Add(20*time.Second).Format(time.RFC3339)), status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiMessage]
+			get(t, path, status, &page)
+			if page.Total != 1 || page.Items[0].PacketID != "101" {
+				t.Errorf("messages = %+v", page.Items)
+			}
+		}},
+		{name: "bad limit", path: "/api/messages?limit=0", status: http.StatusBadRequest, check: func(t *testing.T, path string, status int) {
+			get(t, path, status, &map[string]string{})
+		}},
+		{name: "channels", path: "/api/channels", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var channels []struct {
+				Name     string `json:"name"`
+				Messages int    `json:"messages"`
+			}
+			get(t, path, status, &channels)
+			if len(channels) != 2 || channels[0].Name != "LongFast" || channels[1].Name != "Ops" || channels[1].Messages != 1 {
+				t.Errorf("channels = %+v", channels)
+			}
+		}},
+		{name: "geofence", path: "/api/geofence", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiGeofenceEvent]
+			get(t, path, status, &page)
+			if page.Total != 3 || page.Items[0].Fence != "lake" {
+				t.Errorf("geofence = %+v", page.Items)
+			}
+		}},
+		{name: "geofence filtered", path: "/api/geofence?fence=base&kind=exit&node=2", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var page apiList[apiGeofenceEvent]
+			get(t, path, status, &page)
+			if page.Total != 1 || page.Items[0].Node != "!00000002" {
+				t.Errorf("geofence = %+v", page.Items)
+			}
+		}},
+		{name: "packet", path: "/api/packets/100", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var packets []map[string]any
+			get(t, path, status, &packets)
+			if len(packets) != 2 {
+				t.Fatalf("packets = %v", packets)
+			}
+			// Поля в snake_case, пустые необязательные поля опущены
+			p := packets[1]
+			want := map[string]any{
+				"gateway": "!00000011", "from": "!00000001", "to": "!ffffffff", "hop_limit": 3.0,
+				"hops_away": 0.0, "snr": 6.5, "rssi": -90.0, "portnum": "TEXT_MESSAGE_APP", "text": "hello",
+			}
+			for key, value := range want {
+				if p[key] != value {
+					t.Errorf("packet[%s] = %v, want %v", key, p[key], value)
+				}
+			}
+			for _, key := range []string{"alert", "position", "error", "HopLimit"} {
+				if _, ok := p[key]; ok {
+					t.Errorf("packet has %s", key)
+				}
+			}
+		}},
+		{name: "packet hex id", path: "/api/packets/0x65", status: http.StatusOK, check: func(t *testing.T, path string, status int) {
+			var packets []apiPacket
+			get(t, path, status, &packets)
+			if len(packets) != 1 || packets[0].ID != "101" || !packets[0].Alert || packets[0].EventType != eventAlert {
+				t.Errorf("packets = %+v", packets)
+			}
+		}},
+		{name: "packet not found", path: "/api/packets/12345", status: http.StatusNotFound, check: func(t *testing.T, path string, status int) {
+			get(t, path, status, &map[string]string{})
+		}},
+		{name: "bad packet id", path: "/api/packets/0xzz", status: http.StatusBadRequest, check: func(t *testing.T, path string, status int) {
+			get(t, path, status, &map[string]string{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, tt.path, tt.status)
+		})
+	}
+}
+
+func TestStoreEviction(t *testing.T) {
+	store := NewStore(4)
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.Local)
+	for i := range 5 {
+		store.Add(CSVRecord{Timestamp: CaptureTimestamp(start.Add(time.Duration(i) * time.Minute)), From: "1", PacketID: fmt.Sprint(i + 1)})
+	}
+	// Переполнение вытесняет пакеты до трех четвертей лимита
+	if len(store.packets) != 3 || store.byPacket["1"] != nil || store.byPacket["2"] != nil || store.byPacket["5"] == nil {
+		t.Errorf("packets = %d, byPacket = %v", len(store.packets), store.byPacket)
+	}
+}
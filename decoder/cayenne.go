@@ -0,0 +1,147 @@
+package decoder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Типы данных Cayenne Low Power Payload (IPSO Smart Objects)
+const (
+	lppDigitalInput  = 0
+	lppDigitalOutput = 1
+	lppAnalogInput   = 2
+	lppAnalogOutput  = 3
+	lppIlluminance   = 101
+	lppPresence      = 102
+	lppTemperature   = 103
+	lppHumidity      = 104
+	lppAccelerometer = 113
+	lppBarometer     = 115
+	lppGyrometer     = 134
+	lppGPS           = 136
+)
+
+// Размер данных каждого типа в байтах (без канала и типа)
+var lppSizes = map[byte]int{
+	lppDigitalInput:  1,
+	lppDigitalOutput: 1,
+	lppAnalogInput:   2,
+	lppAnalogOutput:  2,
+	lppIlluminance:   2,
+	lppPresence:      1,
+	lppTemperature:   2,
+	lppHumidity:      1,
+	lppAccelerometer: 6,
+	lppBarometer:     2,
+	lppGyrometer:     6,
+	lppGPS:           9,
+}
+
+var lppDigitalNames = map[byte]string{
+	lppDigitalInput:  "digital_in",
+	lppDigitalOutput: "digital_out",
+	lppPresence:      "presence",
+}
+
+// decodeCayenne разбирает payload CAYENNE_APP: последовательность [канал][тип][данные].
+// Температура, влажность, давление, освещенность и GPS попадают в те же колонки,
+// что и у Telemetry/Position, остальные значения - в колонку CayenneValues.
+func decodeCayenne(payload []byte, record *CSVRecord) {
+	var values []string
+
+	for i := 0; i < len(payload); {
+		if i+2 > len(payload) {
+			record.Error = fmt.Sprintf("Обрезанный Cayenne LPP на смещении %d", i)
+			break
+		}
+		channel, typ := payload[i], payload[i+1]
+		size, ok := lppSizes[typ]
+		if !ok {
+			record.Error = fmt.Sprintf("Неизвестный тип Cayenne LPP %d на смещении %d", typ, i)
+			break
+		}
+		if i+2+size > len(payload) {
+			record.Error = fmt.Sprintf("Обрезанный Cayenne LPP на смещении %d", i)
+			break
+		}
+		data := payload[i+2 : i+2+size]
+		i += 2 + size
+
+		switch typ {
+		case lppDigitalInput, lppDigitalOutput, lppPresence:
+			name := fmt.Sprintf("%s_%d", lppDigitalNames[typ], channel)
+			record.addMetric(name, float64(data[0]))
+			values = append(values, fmt.Sprintf("%s=%d", name, data[0]))
+
+		case lppAnalogInput, lppAnalogOutput:
+			name := "analog_in"
+			if typ == lppAnalogOutput {
+				name = "analog_out"
+			}
+			name = fmt.Sprintf("%s_%d", name, channel)
+			v := float64(lppInt(data)) / 100
+			record.addMetric(name, v)
+			values = append(values, fmt.Sprintf("%s=%.2f", name, v))
+
+		case lppIlluminance:
+			v := float64(lppUint(data))
+			record.Lux = fmt.Sprintf("%.1f", v)
+			record.addMetric("lux", v)
+
+		case lppTemperature:
+			v := float64(lppInt(data)) / 10
+			record.Temperature = fmt.Sprintf("%.1f", v)
+			record.addMetric("temperature", v)
+
+		case lppHumidity:
+			v := float64(data[0]) / 2
+			record.RelativeHumidity = fmt.Sprintf("%.1f", v)
+			record.addMetric("relative_humidity", v)
+
+		case lppBarometer:
+			v := float64(lppUint(data)) / 10
+			record.BarometricPressure = fmt.Sprintf("%.1f", v)
+			record.addMetric("barometric_pressure", v)
+
+		case lppAccelerometer, lppGyrometer:
+			name, scale := "accel", 1000.0
+			if typ == lppGyrometer {
+				name, scale = "gyro", 100.0
+			}
+			name = fmt.Sprintf("%s_%d", name, channel)
+			x := float64(lppInt(data[0:2])) / scale
+			y := float64(lppInt(data[2:4])) / scale
+			z := float64(lppInt(data[4:6])) / scale
+			record.addMetric(name+"_x", x)
+			record.addMetric(name+"_y", y)
+			record.addMetric(name+"_z", z)
+			values = append(values, fmt.Sprintf("%s=%.3f/%.3f/%.3f", name, x, y, z))
+
+		case lppGPS:
+			lat := float64(lppInt(data[0:3])) / 1e4
+			lon := float64(lppInt(data[3:6])) / 1e4
+			alt := float64(lppInt(data[6:9])) / 100
+			record.Latitude = fmt.Sprintf("%.7f", lat)
+			record.Longitude = fmt.Sprintf("%.7f", lon)
+			record.Altitude = fmt.Sprintf("%.0f", alt)
+		}
+	}
+
+	record.CayenneValues = strings.Join(values, " ")
+}
+
+// lppInt читает знаковое big-endian число длиной 1-3 байта
+func lppInt(data []byte) int32 {
+	v := int32(lppUint(data))
+	shift := 32 - 8*len(data)
+	return v << shift >> shift
+}
+
+// lppUint читает беззнаковое big-endian число
+func lppUint(data []byte) uint32 {
+	var v uint32
+	for _, b := range data {
+		v = v<<8 | uint32(b)
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package decoder
+
+import "testing"
+
+func TestDecodeCayenne(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		check   func(r *CSVRecord) bool
+		values  string
+		err     bool
+	}{
+		{
+			name:    "temperature and humidity",
+			payload: []byte{1, lppTemperature, 0x00, 0xfd, 2, lppHumidity, 0x61},
+			check:   func(r *CSVRecord) bool { return r.Temperature == "25.3" && r.RelativeHumidity == "48.5" },
+		},
+		{
+			name:    "negative temperature",
+			payload: []byte{1, lppTemperature, 0xff, 0xd7},
+			check:   func(r *CSVRecord) bool { return r.Temperature == "-4.1" },
+		},
+		{
+			name:    "barometer and illuminance",
+			payload: []byte{3, lppBarometer, 0x27, 0x7f, 4, lppIlluminance, 0x01, 0x2c},
+			check:   func(r *CSVRecord) bool { return r.BarometricPressure == "1011.1" && r.Lux == "300.0" },
+		},
+		{
+			name:    "gps",
+			payload: []byte{1, lppGPS, 0x06, 0x76, 0x5f, 0xf2, 0x96, 0x0a, 0x00, 0x03, 0xe8},
+			check: func(r *CSVRecord) bool {
+				return r.Latitude == "42.3519000" && r.Longitude == "-87.9094000" && r.Altitude == "10"
+			},
+		},
+		{
+			name:    "digital, analog and accelerometer",
+			payload: []byte{5, lppDigitalInput, 1, 6, lppAnalogInput, 0xff, 0x9c, 7, lppAccelerometer, 0x04, 0xd2, 0xfb, 0x2e, 0x00, 0x00},
+			check:   func(r *CSVRecord) bool { return len(r.metrics) == 5 },
+			values:  "digital_in_5=1 analog_in_6=-1.00 accel_7=1.234/-1.234/0.000",
+		},
+		{
+			name:    "unknown type",
+			payload: []byte{1, 200, 0},
+			err:     true,
+		},
+		{
+			name:    "truncated",
+			payload: []byte{1, lppTemperature, 0x00},
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record CSVRecord
+			decodeCayenne(tt.payload, &record)
+			if (record.Error != "") != tt.err {
+				t.Fatalf("error = %q, want error %v", record.Error, tt.err)
+			}
+			if tt.check != nil && !tt.check(&record) {
+				t.Errorf("unexpected record: %+v", record)
+			}
+			if record.CayenneValues != tt.values {
+				t.Errorf("values = %q, want %q", record.CayenneValues, tt.values)
+			}
+		})
+	}
+}
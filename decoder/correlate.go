@@ -0,0 +1,168 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// packetCopy - одна копия пакета, принятая конкретным шлюзом
+type packetCopy struct {
+	GatewayID string  `json:"gateway_id"`
+	Timestamp string  `json:"timestamp"`
+	Offset    float64 `json:"offset_seconds"`
+	HopStart  string  `json:"hop_start,omitempty"`
+	HopLimit  string  `json:"hop_limit,omitempty"`
+	HopsAway  string  `json:"hops_away,omitempty"`
+	RelayNode string  `json:"relay_node,omitempty"`
+	RxSNR     string  `json:"rx_snr,omitempty"`
+	RxRSSI    string  `json:"rx_rssi,omitempty"`
+}
+
+// logicalPacket - все копии одного пакета (from, id), пришедшие через разные шлюзы
+type logicalPacket struct {
+	FirstSeen   string       `json:"first_seen"`
+	From        string       `json:"from"`
+	FromID      string       `json:"from_id"`
+	PacketID    string       `json:"packet_id"`
+	PortnumName string       `json:"portnum,omitempty"`
+	PayloadType string       `json:"payload_type"`
+	Copies      []packetCopy `json:"copies"`
+
+	first time.Time
+}
+
+// Gateways возвращает список уникальных шлюзов в порядке прихода копий
+func (p *logicalPacket) Gateways() []string {
+	seen := make(map[string]bool)
+	var gateways []string
+	for _, c := range p.Copies {
+		if !seen[c.GatewayID] {
+			seen[c.GatewayID] = true
+			gateways = append(gateways, c.GatewayID)
+		}
+	}
+	return gateways
+}
+
+// packetCorrelator группирует копии пакетов по (from, id) в пределах временного окна
+type packetCorrelator struct {
+	window  time.Duration
+	latest  map[string]*logicalPacket
+	packets []*logicalPacket
+}
+
+func newPacketCorrelator(window time.Duration) *packetCorrelator {
+	return &packetCorrelator{
+		window: window,
+		latest: make(map[string]*logicalPacket),
+	}
+}
+
+// Observe добавляет запись в группу и возвращает true, если это повторная копия
+// уже виденного пакета. Записи без from/id (MapReport, ошибки) не группируются.
+func (c *packetCorrelator) Observe(record *CSVRecord) bool {
+	if record.MessageType != "ServiceEnvelope" || record.PacketID == "" || record.PacketID == "0" {
+		return false
+	}
+
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		return false
+	}
+
+	arrival := packetCopy{
+		GatewayID: record.GatewayID,
+		Timestamp: record.Timestamp,
+		HopStart:  record.HopStart,
+		HopLimit:  record.HopLimit,
+		HopsAway:  record.HopsAway,
+		RelayNode: record.RelayNode,
+		RxSNR:     record.RxSNR,
+		RxRSSI:    record.RxRSSI,
+	}
+
+	key := record.From + "|" + record.PacketID
+	packet, ok := c.latest[key]
+	// Тот же id за пределами окна - это уже другой пакет (id повторяются после перезагрузки)
+	if ok && at.Sub(packet.first) <= c.window && at.Sub(packet.first) >= -c.window {
+		arrival.Offset = at.Sub(packet.first).Seconds()
+		packet.Copies = append(packet.Copies, arrival)
+		// Предпочитаем расшифрованную копию для описания пакета
+		if packet.PortnumName == "" && record.PortnumName != "" {
+			packet.PortnumName = record.PortnumName
+			packet.PayloadType = record.PayloadType
+		}
+		return true
+	}
+
+	packet = &logicalPacket{
+		FirstSeen:   record.Timestamp,
+		From:        record.From,
+		FromID:      NodeIDFromString(record.From),
+		PacketID:    record.PacketID,
+		PortnumName: record.PortnumName,
+		PayloadType: record.PayloadType,
+		Copies:      []packetCopy{arrival},
+		first:       at,
+	}
+	c.latest[key] = packet
+	c.packets = append(c.packets, packet)
+	return false
+}
+
+// WriteReport пишет логические пакеты в JSON (расширение .json) или CSV
+func (c *packetCorrelator) WriteReport(path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := json.MarshalIndent(c.packets, "", "  ")
+		if err != nil {
+			return fmt.Errorf("ошибка формирования JSON: %w", err)
+		}
+		return os.WriteFile(path, data, 0644)
+	}
+
+	rows := [][]string{{"FirstSeen", "From", "FromID", "PacketID", "PortnumName", "PayloadType",
+		"Copies", "GatewayCount", "Gateways"}}
+	for _, p := range c.packets {
+		var copies []string
+		for _, cp := range p.Copies {
+			copies = append(copies, formatPacketCopy(cp))
+		}
+		rows = append(rows, []string{
+			p.FirstSeen, p.From, p.FromID, p.PacketID, p.PortnumName, p.PayloadType,
+			fmt.Sprintf("%d", len(p.Copies)), fmt.Sprintf("%d", len(p.Gateways())),
+			strings.Join(copies, "; "),
+		})
+	}
+	return writeCSVFile(path, rows)
+}
+
+// formatPacketCopy выводит копию как "!gateway hops=1 snr=6.25 rssi=-45 +1s"
+func formatPacketCopy(c packetCopy) string {
+	parts := []string{c.GatewayID}
+	if c.HopsAway != "" {
+		parts = append(parts, "hops="+c.HopsAway)
+	}
+	if c.RxSNR != "" {
+		parts = append(parts, "snr="+c.RxSNR, "rssi="+c.RxRSSI)
+	}
+	parts = append(parts, fmt.Sprintf("%+.0fs", c.Offset))
+	return strings.Join(parts, " ")
+}
+
+// PrintSummary выводит в консоль, сколько копий пришло на один логический пакет
+func (c *packetCorrelator) PrintSummary() {
+	copies := 0
+	multi := 0
+	for _, p := range c.packets {
+		copies += len(p.Copies)
+		if len(p.Gateways()) > 1 {
+			multi++
+		}
+	}
+	fmt.Printf("Логических пакетов: %d из %d копий, принятых несколькими шлюзами: %d\n",
+		len(c.packets), copies, multi)
+}
@@ -0,0 +1,308 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverageCell - сколько и как шлюз слышал один узел
+type coverageCell struct {
+	Gateway   string
+	Node      string
+	FirstSeen string
+	LastSeen  string
+	Packets   int
+	// Direct - принято без ретрансляции (hop_start == hop_limit)
+	Direct  int
+	Relayed int
+	// UnknownHops - старая прошивка без hop_start
+	UnknownHops int
+
+	snr  []float64
+	rssi []float64
+}
+
+// gatewayCoverage - сводка по шлюзу с оценкой радиуса покрытия
+type gatewayCoverage struct {
+	Gateway     string
+	Nodes       int
+	DirectNodes int
+	Packets     int
+	// Узлы, услышанные напрямую, у которых известна позиция
+	Positioned     int
+	MedianDistance float64
+	MaxDistance    float64
+	// MaxUncertainty - погрешность самого дальнего расстояния из-за округления позиций
+	MaxUncertainty float64
+}
+
+// coverageTracker собирает матрицу приема "шлюз x узел"
+type coverageTracker struct {
+	cells     map[string]*coverageCell
+	positions map[string]geoPosition
+	names     map[string]string
+}
+
+func newCoverageTracker() *coverageTracker {
+	return &coverageTracker{
+		cells:     make(map[string]*coverageCell),
+		positions: make(map[string]geoPosition),
+		names:     make(map[string]string),
+	}
+}
+
+// Observe учитывает копию пакета. Вызывать нужно для всех копий, в том числе
+// повторных, иначе шлюзы, услышавшие пакет вторыми, пропадут из отчета.
+func (t *coverageTracker) Observe(record *CSVRecord) {
+	if record.From == "" {
+		return
+	}
+	node := NodeIDFromString(record.From)
+
+	if pos, ok := recordPosition(record); ok {
+		t.positions[node] = pos
+	}
+	if record.UserLongName != "" {
+		t.names[node] = record.UserLongName
+	} else if record.MapLongName != "" && t.names[node] == "" {
+		t.names[node] = record.MapLongName
+	}
+
+	// Собственные пакеты шлюза о покрытии ничего не говорят
+	if record.MessageType != "ServiceEnvelope" || record.GatewayID == "" || record.GatewayID == node {
+		return
+	}
+
+	key := record.GatewayID + "|" + node
+	cell, ok := t.cells[key]
+	if !ok {
+		cell = &coverageCell{Gateway: record.GatewayID, Node: node, FirstSeen: record.Timestamp}
+		t.cells[key] = cell
+	}
+	cell.LastSeen = record.Timestamp
+	cell.Packets++
+
+	switch record.HopsAway {
+	case "":
+		cell.UnknownHops++
+	case "0":
+		cell.Direct++
+	default:
+		cell.Relayed++
+	}
+
+	if snr, err := strconv.ParseFloat(record.RxSNR, 64); err == nil {
+		cell.snr = append(cell.snr, snr)
+	}
+	if rssi, err := strconv.ParseFloat(record.RxRSSI, 64); err == nil {
+		cell.rssi = append(cell.rssi, rssi)
+	}
+}
+
+func (t *coverageTracker) sortedCells() []*coverageCell {
+	cells := make([]*coverageCell, 0, len(t.cells))
+	for _, c := range t.cells {
+		cells = append(cells, c)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Gateway != cells[j].Gateway {
+			return cells[i].Gateway < cells[j].Gateway
+		}
+		return cells[i].Node < cells[j].Node
+	})
+	return cells
+}
+
+// distance возвращает расстояние между узлами и его погрешность, если позиции обоих известны
+func (t *coverageTracker) distance(a, b string) (distance, uncertainty float64, ok bool) {
+	pa, okA := t.positions[a]
+	pb, okB := t.positions[b]
+	if !okA || !okB {
+		return 0, 0, false
+	}
+	distance, uncertainty = pa.DistanceTo(pb)
+	return distance, uncertainty, true
+}
+
+// Gateways считает сводку по шлюзам. Радиус покрытия оценивается по узлам,
+// услышанным напрямую: медиана - типичная дальность, максимум - граница зоны.
+func (t *coverageTracker) Gateways() []*gatewayCoverage {
+	byGateway := make(map[string]*gatewayCoverage)
+	distances := make(map[string][]float64)
+	uncertainties := make(map[string][]float64)
+	for _, c := range t.sortedCells() {
+		g, ok := byGateway[c.Gateway]
+		if !ok {
+			g = &gatewayCoverage{Gateway: c.Gateway}
+			byGateway[c.Gateway] = g
+		}
+		g.Nodes++
+		g.Packets += c.Packets
+		if c.Direct == 0 {
+			continue
+		}
+		g.DirectNodes++
+		if d, u, ok := t.distance(c.Gateway, c.Node); ok {
+			distances[c.Gateway] = append(distances[c.Gateway], d)
+			uncertainties[c.Gateway] = append(uncertainties[c.Gateway], u)
+		}
+	}
+
+	gateways := make([]*gatewayCoverage, 0, len(byGateway))
+	for id, g := range byGateway {
+		if d := distances[id]; len(d) > 0 {
+			g.Positioned = len(d)
+			g.MedianDistance = median(d)
+			i := slices.Index(d, slices.Max(d))
+			g.MaxDistance, g.MaxUncertainty = d[i], uncertainties[id][i]
+		}
+		gateways = append(gateways, g)
+	}
+	sort.Slice(gateways, func(i, j int) bool {
+		return gateways[i].Gateway < gateways[j].Gateway
+	})
+	return gateways
+}
+
+// WriteReport пишет матрицу приема в path, сводку по шлюзам в <path>_gateways.csv
+// и слой для карты в <path без расширения>.geojson
+func (t *coverageTracker) WriteReport(path string) error {
+	rows := [][]string{{"GatewayID", "GatewayName", "Node", "NodeName", "FirstSeen", "LastSeen",
+		"Packets", "Direct", "Relayed", "UnknownHops", "SNRMin", "SNRMedian", "SNRMax",
+		"RSSIMin", "RSSIMedian", "RSSIMax", "DistanceKm", "DistanceUncertaintyKm"}}
+	for _, c := range t.sortedCells() {
+		row := []string{c.Gateway, t.names[c.Gateway], c.Node, t.names[c.Node], c.FirstSeen, c.LastSeen,
+			fmt.Sprintf("%d", c.Packets), fmt.Sprintf("%d", c.Direct), fmt.Sprintf("%d", c.Relayed),
+			fmt.Sprintf("%d", c.UnknownHops)}
+		row = append(row, distribution(c.snr, "%.2f")...)
+		row = append(row, distribution(c.rssi, "%.0f")...)
+		distance, uncertainty := "", ""
+		if d, u, ok := t.distance(c.Gateway, c.Node); ok {
+			distance, uncertainty = fmt.Sprintf("%.2f", d/1000), fmt.Sprintf("%.2f", u/1000)
+		}
+		rows = append(rows, append(row, distance, uncertainty))
+	}
+	if err := writeCSVFile(path, rows); err != nil {
+		return err
+	}
+
+	gateways := t.Gateways()
+	summary := [][]string{{"GatewayID", "GatewayName", "Latitude", "Longitude", "PositionUncertainty",
+		"Nodes", "DirectNodes", "Packets", "PositionedDirectNodes", "MedianRadiusKm", "MaxRadiusKm",
+		"MaxRadiusUncertaintyKm"}}
+	for _, g := range gateways {
+		lat, lon, accuracy := "", "", ""
+		if pos, ok := t.positions[g.Gateway]; ok {
+			lat, lon = fmt.Sprintf("%.7f", pos.Lat), fmt.Sprintf("%.7f", pos.Lon)
+			accuracy = fmt.Sprintf("%.0f", pos.Uncertainty)
+		}
+		median, radius, radiusUncertainty := "", "", ""
+		if g.Positioned > 0 {
+			median, radius = fmt.Sprintf("%.2f", g.MedianDistance/1000), fmt.Sprintf("%.2f", g.MaxDistance/1000)
+			radiusUncertainty = fmt.Sprintf("%.2f", g.MaxUncertainty/1000)
+		}
+		summary = append(summary, []string{g.Gateway, t.names[g.Gateway], lat, lon, accuracy,
+			fmt.Sprintf("%d", g.Nodes), fmt.Sprintf("%d", g.DirectNodes), fmt.Sprintf("%d", g.Packets),
+			fmt.Sprintf("%d", g.Positioned), median, radius, radiusUncertainty})
+	}
+	if err := writeCSVFile(withSuffix(path, "_gateways"), summary); err != nil {
+		return err
+	}
+
+	return t.geoJSON(gateways).WriteFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".geojson")
+}
+
+// geoJSON выводит шлюзы точками, оценку покрытия кругом и прямые приемы линиями
+func (t *coverageTracker) geoJSON(gateways []*gatewayCoverage) *geoFeatureCollection {
+	collection := newFeatureCollection()
+	for _, g := range gateways {
+		pos, ok := t.positions[g.Gateway]
+		if !ok {
+			continue
+		}
+		properties := map[string]any{
+			"gateway":       g.Gateway,
+			"name":          t.names[g.Gateway],
+			"nodes":         g.Nodes,
+			"direct_nodes":  g.DirectNodes,
+			"packets":       g.Packets,
+			"uncertainty_m": math.Round(pos.Uncertainty),
+		}
+		if g.Positioned > 0 {
+			properties["median_radius_m"] = math.Round(g.MedianDistance)
+			properties["max_radius_m"] = math.Round(g.MaxDistance)
+			properties["max_radius_uncertainty_m"] = math.Round(g.MaxUncertainty)
+		}
+		collection.Add("Point", []float64{pos.Lon, pos.Lat}, properties)
+
+		if g.Positioned > 0 && g.MaxDistance > 0 {
+			collection.Add("Polygon", circlePolygon(pos.Lat, pos.Lon, g.MaxDistance, 64), map[string]any{
+				"gateway":       g.Gateway,
+				"kind":          "coverage",
+				"radius_m":      math.Round(g.MaxDistance),
+				"uncertainty_m": math.Round(g.MaxUncertainty),
+			})
+		}
+	}
+
+	for _, c := range t.sortedCells() {
+		if c.Direct == 0 {
+			continue
+		}
+		gw, okG := t.positions[c.Gateway]
+		node, okN := t.positions[c.Node]
+		if !okG || !okN {
+			continue
+		}
+		properties := map[string]any{
+			"gateway": c.Gateway,
+			"node":    c.Node,
+			"kind":    "direct",
+			"packets": c.Direct,
+		}
+		if len(c.snr) > 0 {
+			properties["snr_median"] = median(c.snr)
+		}
+		collection.Add("LineString", [][]float64{{gw.Lon, gw.Lat}, {node.Lon, node.Lat}}, properties)
+	}
+	return collection
+}
+
+// PrintSummary выводит оценку покрытия шлюзов
+func (t *coverageTracker) PrintSummary() {
+	for _, g := range t.Gateways() {
+		fmt.Printf("Шлюз %s %s: узлов %d (напрямую %d), пакетов %d", g.Gateway, t.names[g.Gateway],
+			g.Nodes, g.DirectNodes, g.Packets)
+		if g.Positioned > 0 {
+			fmt.Printf(", радиус %.1f ± %.1f км (медиана %.1f км по %d узлам)", g.MaxDistance/1000,
+				g.MaxUncertainty/1000, g.MedianDistance/1000, g.Positioned)
+		}
+		fmt.Println()
+	}
+}
+
+// distribution возвращает минимум, медиану и максимум выборки или пустые строки
+func distribution(values []float64, format string) []string {
+	if len(values) == 0 {
+		return []string{"", "", ""}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return []string{fmt.Sprintf(format, sorted[0]), fmt.Sprintf(format, median(sorted)),
+		fmt.Sprintf(format, sorted[len(sorted)-1])}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
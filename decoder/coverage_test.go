@@ -0,0 +1,84 @@
+package decoder
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoverageTracker(t *testing.T) {
+	const gateway = "!00000010"
+	envelope := func(from, hops, snr, lat string) CSVRecord {
+		r := CSVRecord{
+			Timestamp: "11.17.2025 12:00:00", MessageType: "ServiceEnvelope", GatewayID: gateway,
+			From: from, HopsAway: hops, RxSNR: snr, RxRSSI: "-100",
+		}
+		if lat != "" {
+			r.Latitude, r.Longitude = lat, "40.5000000"
+		}
+		return r
+	}
+	records := []CSVRecord{
+		// Собственная позиция шлюза не дает ячейки
+		envelope("16", "0", "", "64.5000000"),
+		envelope("1", "0", "5.00", "64.5090000"),
+		envelope("1", "0", "7.00", ""),
+		envelope("2", "0", "-2.00", "64.5270000"),
+		envelope("3", "2", "1.00", "64.6000000"),
+		envelope("4", "", "", ""),
+		{Timestamp: "11.17.2025 12:00:00", MessageType: "MapReport", GatewayID: gateway, From: "5"},
+	}
+	tracker := newCoverageTracker()
+	for i := range records {
+		tracker.Observe(&records[i])
+	}
+
+	tests := []struct {
+		node                           string
+		packets, direct, relayed, hops int
+		snr                            []string
+	}{
+		{node: "!00000001", packets: 2, direct: 2, snr: []string{"5.00", "6.00", "7.00"}},
+		{node: "!00000002", packets: 1, direct: 1, snr: []string{"-2.00", "-2.00", "-2.00"}},
+		{node: "!00000003", packets: 1, relayed: 1, snr: []string{"1.00", "1.00", "1.00"}},
+		{node: "!00000004", packets: 1, hops: 1, snr: []string{"", "", ""}},
+	}
+	cells := tracker.sortedCells()
+	if len(cells) != len(tests) {
+		t.Fatalf("cells = %d, want %d", len(cells), len(tests))
+	}
+	for i, tt := range tests {
+		c := cells[i]
+		if c.Node != tt.node || c.Packets != tt.packets || c.Direct != tt.direct || c.Relayed != tt.relayed || c.UnknownHops != tt.hops {
+			t.Errorf("cell %d = %+v, want %+v", i, c, tt)
+		}
+		if snr := distribution(c.snr, "%.2f"); strings.Join(snr, " ") != strings.Join(tt.snr, " ") {
+			t.Errorf("%s snr = %v, want %v", tt.node, snr, tt.snr)
+		}
+	}
+
+	gateways := tracker.Gateways()
+	if len(gateways) != 1 {
+		t.Fatalf("gateways = %d, want 1", len(gateways))
+	}
+	g := gateways[0]
+	if g.Nodes != 4 || g.DirectNodes != 2 || g.Packets != 5 || g.Positioned != 2 {
+		t.Errorf("gateway = %+v", g)
+	}
+	// 0.009 и 0.027 градуса широты - около 1 и 3 км
+	if math.Abs(g.MedianDistance-2001) > 5 || math.Abs(g.MaxDistance-3002) > 5 {
+		t.Errorf("median %.0f m, max %.0f m, want about 2001 and 3002", g.MedianDistance, g.MaxDistance)
+	}
+
+	path := filepath.Join(t.TempDir(), "coverage.csv")
+	if err := tracker.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"coverage.csv", "coverage_gateways.csv", "coverage.geojson"} {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,1106 @@
+// Package decoder разбирает сообщения Meshtastic, захваченные с MQTT (ServiceEnvelope,
+// MapReport), в плоские записи CSVRecord и строит по ним отчеты. Командная строка
+// cmd/decoder разбирает флаги и вызывает DecodeCapture и функции подкоманд, живой сборщик
+// cmd/parser декодирует сообщения через DecodeMessage.
+package decoder
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// CSVRecord представляет одну строку CSV файла
+type CSVRecord struct {
+	Timestamp    string
+	Topic        string
+	MessageType  string
+	ChannelID    string
+	GatewayID    string
+	From         string
+	To           string
+	PacketID     string
+	Channel      string
+	HopLimit     string
+	WantAck      string
+	Priority     string
+	ViaMQTT      string
+	Transport    string
+	HopStart     string
+	HopsAway     string
+	RelayNode    string
+	NextHop      string
+	RxTime       string
+	RxSNR        string
+	RxRSSI       string
+	Delayed      string
+	PkiEncrypted string
+	PublicKey    string
+	// Задержка от приема пакета шлюзом (rx_time) до записи в захват, секунды
+	GatewayLatency string
+	PayloadType    string
+	Portnum        string
+	PortnumName    string
+	PayloadSize    string
+	EncryptedData  string
+	ReplyID        string
+	Emoji          string
+	RequestID      string
+
+	// Position fields
+	Latitude       string
+	Longitude      string
+	Altitude       string
+	PositionTime   string
+	LocationSource string
+	PrecisionBits  string
+	// PositionUncertainty - радиус ячейки округления координат в метрах.
+	// При округлении Latitude/Longitude содержат центр ячейки.
+	PositionUncertainty string
+	GroundTrack         string
+	GroundSpeed         string
+	// GeofenceEvents - входы и выходы из геозон по этой позиции: "enter:база;exit:озеро"
+	GeofenceEvents string
+
+	// Text message
+	TextMessage string
+
+	// User info
+	UserID         string
+	UserLongName   string
+	UserShortName  string
+	UserMacaddr    string
+	UserHwModel    string
+	UserIsLicensed string
+
+	// Telemetry
+	BatteryLevel       string
+	Voltage            string
+	ChannelUtilization string
+	AirUtilTx          string
+	Temperature        string
+	RelativeHumidity   string
+	BarometricPressure string
+	GasResistance      string
+	Lux                string
+
+	// Map Report
+	MapLongName            string
+	MapShortName           string
+	MapRole                string
+	MapHwModel             string
+	MapFirmwareVersion     string
+	MapRegion              string
+	MapModemPreset         string
+	MapHasDefaultChannel   string
+	MapPositionPrecision   string
+	MapOnlineLocalNodes    string
+	MapOptedReportLocation string
+
+	// Waypoint
+	WaypointID          string
+	WaypointName        string
+	WaypointDescription string
+
+	// Routing
+	RoutingVariant     string
+	RoutingErrorReason string
+
+	// Remote Hardware
+	HwType      string
+	HwGpioMask  string
+	HwGpioValue string
+
+	// ATAK Plugin
+	TakVariant        string
+	TakCompressed     string
+	TakCallsign       string
+	TakDeviceCallsign string
+	TakTeam           string
+	TakRole           string
+	TakBattery        string
+	TakSpeed          string
+	TakCourse         string
+	TakChatTo         string
+	TakChatToCallsign string
+
+	// События: Paxcount, Detection Sensor, Alert
+	EventType     string
+	IsAlert       string
+	PaxWifi       string
+	PaxBle        string
+	PaxUptime     string
+	DetectionText string
+
+	// Администрирование и проверка ключей
+	AdminVariant string
+	AdminSummary string
+
+	// Соседи и трассировка маршрута
+	Neighbors      string
+	TraceRoute     string
+	TraceRouteBack string
+
+	// Range Test
+	RangeTestSeq string
+
+	// Cayenne LPP: значения без отдельной колонки (аналоговые, цифровые входы, акселерометр)
+	CayenneValues string
+
+	// Декодеры собственных модулей (PRIVATE_APP и выше)
+	CustomDecoder string
+	CustomValues  string
+
+	// Error
+	Error string
+
+	// Числовые показания для временного ряда телеметрии
+	metrics []metricSample
+
+	// Наблюдаемые радиосвязи между узлами для построения топологии
+	links []nodeLink
+
+	// Размер радиокадра в байтах (заголовок + зашифрованный Data) для расчета времени в эфире
+	airBytes int
+
+	// Исходный TAKPacket для экспорта в CoT
+	tak *generated.TAKPacket
+}
+
+// DecodeOptions - дополнительные выгрузки и отчеты DecodeCapture. Пустое имя файла отключает отчет.
+type DecodeOptions struct {
+	// CoTUDP и CoTFile - UDP/multicast адрес и файл для CoT событий ATAK
+	CoTUDP  string
+	CoTFile string
+	// PaxFile и TelemetryFile - временные ряды Paxcount и телеметрии (Telemetry и Cayenne LPP)
+	PaxFile       string
+	TelemetryFile string
+	// DecodersFile - JSON файл декодеров для собственных portnum
+	DecodersFile string
+	// CorrelateFile - отчет о копиях пакетов через разные шлюзы (.csv или .json)
+	CorrelateFile string
+	// Dedup оставляет только первую копию пакета, DedupWindow - окно группировки копий (from, id),
+	// 0 - 30 секунд
+	Dedup       bool
+	DedupWindow time.Duration
+	// FloodFile - деревья ретрансляции (.dot или .json)
+	FloodFile string
+	// CoverageFile - матрица приема шлюз x узел
+	CoverageFile string
+	// AirtimeFile - время в эфире; регион и пресет - для узлов без MapReport, по умолчанию RU и LONG_FAST
+	AirtimeFile   string
+	AirtimeRegion string
+	AirtimePreset string
+	// PresenceFile - хронология переходов online/stale/offline
+	PresenceFile string
+	// GeofenceFile - GeoJSON геозон, GeofenceHysteresis - запас от границы в метрах
+	GeofenceFile       string
+	GeofenceHysteresis float64
+	// AlertsFile - JSON правил оповещений
+	AlertsFile string
+	// RangeTestFile - отчет Range Test
+	RangeTestFile string
+}
+
+// SetCaptureTimezone задает часовой пояс, в котором записаны метки времени захвата
+// (например Europe/Moscow). По умолчанию используется локальный.
+func SetCaptureTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("неизвестный часовой пояс: %w", err)
+	}
+	captureLocation = loc
+	return nil
+}
+
+// DecodeCapture декодирует файл захвата inputFile в CSV outputFile и пишет
+// включенные в opts отчеты. Ход обработки и сводки печатаются в stdout.
+func DecodeCapture(inputFile, outputFile string, opts DecodeOptions) error {
+	if opts.DedupWindow == 0 {
+		opts.DedupWindow = 30 * time.Second
+	}
+	opts.AirtimeRegion = firstNonEmpty(opts.AirtimeRegion, "RU")
+	opts.AirtimePreset = firstNonEmpty(opts.AirtimePreset, "LONG_FAST")
+
+	if opts.DecodersFile != "" {
+		if err := loadDecoderConfig(opts.DecodersFile); err != nil {
+			return fmt.Errorf("ошибка загрузки декодеров: %w", err)
+		}
+	}
+
+	var cot *cotExporter
+	if opts.CoTUDP != "" || opts.CoTFile != "" {
+		var err error
+		cot, err = newCoTExporter(opts.CoTUDP, opts.CoTFile)
+		if err != nil {
+			return fmt.Errorf("ошибка настройки CoT экспорта: %w", err)
+		}
+		defer cot.Close()
+	}
+
+	var pax *paxSeriesWriter
+	if opts.PaxFile != "" {
+		var err error
+		pax, err = newPaxSeriesWriter(opts.PaxFile)
+		if err != nil {
+			return fmt.Errorf("ошибка настройки экспорта Paxcount: %w", err)
+		}
+		defer pax.Close()
+	}
+
+	var telemetry *telemetrySeriesWriter
+	if opts.TelemetryFile != "" {
+		var err error
+		telemetry, err = newTelemetrySeriesWriter(opts.TelemetryFile)
+		if err != nil {
+			return fmt.Errorf("ошибка настройки экспорта телеметрии: %w", err)
+		}
+		defer telemetry.Close()
+	}
+
+	var correlator *packetCorrelator
+	if opts.CorrelateFile != "" || opts.Dedup || opts.FloodFile != "" {
+		correlator = newPacketCorrelator(opts.DedupWindow)
+	}
+
+	var coverage *coverageTracker
+	if opts.CoverageFile != "" {
+		coverage = newCoverageTracker()
+	}
+
+	var airtime *airtimeTracker
+	if opts.AirtimeFile != "" {
+		var err error
+		airtime, err = newAirtimeTracker(opts.DedupWindow, opts.AirtimeRegion, opts.AirtimePreset)
+		if err != nil {
+			return fmt.Errorf("ошибка настройки расчета времени в эфире: %w", err)
+		}
+	}
+
+	var presence *presenceTracker
+	if opts.PresenceFile != "" || opts.AlertsFile != "" {
+		presence = newPresenceTracker(defaultPresenceConfig)
+		presence.history = opts.PresenceFile != ""
+	}
+
+	var fences *GeofenceTracker
+	if opts.GeofenceFile != "" {
+		var err error
+		fences, err = LoadGeofences(opts.GeofenceFile, opts.GeofenceHysteresis)
+		if err != nil {
+			return fmt.Errorf("ошибка загрузки геозон: %w", err)
+		}
+	}
+
+	var alerts *AlertEngine
+	if opts.AlertsFile != "" {
+		var err error
+		alerts, err = LoadAlertEngine(opts.AlertsFile)
+		if err != nil {
+			return fmt.Errorf("ошибка загрузки правил оповещений: %w", err)
+		}
+		alerts.presence = presence
+	}
+
+	var rangeTest *rangeTestTracker
+	if opts.RangeTestFile != "" {
+		rangeTest = newRangeTestTracker()
+	}
+
+	// Открываем входной файл
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла: %w", err)
+	}
+	defer file.Close()
+
+	// Создаем CSV файл
+	csvFile, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("ошибка создания CSV файла: %w", err)
+	}
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	// Записываем заголовки
+	headers := []string{
+		"Timestamp", "Topic", "MessageType", "ChannelID", "GatewayID",
+		"From", "To", "PacketID", "Channel", "HopLimit", "WantAck", "Priority",
+		"ViaMQTT", "Transport", "HopStart", "HopsAway", "RelayNode", "NextHop", "RxTime",
+		"RxSNR", "RxRSSI", "Delayed", "PkiEncrypted", "PublicKey", "GatewayLatency",
+		"PayloadType", "Portnum", "PortnumName", "PayloadSize",
+		"EncryptedData", "ReplyID", "Emoji", "RequestID", "Latitude", "Longitude", "Altitude", "PositionTime",
+		"LocationSource", "PrecisionBits", "PositionUncertainty", "GroundTrack", "GroundSpeed", "GeofenceEvents",
+		"TextMessage", "UserID", "UserLongName", "UserShortName", "UserMacaddr",
+		"UserHwModel", "UserIsLicensed", "BatteryLevel", "Voltage", "ChannelUtilization",
+		"AirUtilTx", "Temperature", "RelativeHumidity", "BarometricPressure", "GasResistance", "Lux",
+		"MapLongName", "MapShortName", "MapRole", "MapHwModel", "MapFirmwareVersion",
+		"MapRegion", "MapModemPreset", "MapHasDefaultChannel", "MapPositionPrecision",
+		"MapOnlineLocalNodes", "MapOptedReportLocation", "WaypointID", "WaypointName",
+		"WaypointDescription", "RoutingVariant", "RoutingErrorReason", "HwType",
+		"HwGpioMask", "HwGpioValue", "TakVariant", "TakCompressed", "TakCallsign",
+		"TakDeviceCallsign", "TakTeam", "TakRole", "TakBattery", "TakSpeed", "TakCourse",
+		"TakChatTo", "TakChatToCallsign", "EventType", "IsAlert", "PaxWifi", "PaxBle",
+		"PaxUptime", "DetectionText", "AdminVariant", "AdminSummary",
+		"Neighbors", "TraceRoute", "TraceRouteBack", "RangeTestSeq", "CayenneValues", "CustomDecoder", "CustomValues", "Error",
+	}
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("ошибка записи заголовков: %w", err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	processed := 0
+	duplicates := 0
+
+	fmt.Printf("Обработка файла %s...\n", inputFile)
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		record, ok := decodeCaptureLine(line, lineNum)
+		if !ok {
+			writeRecord(writer, record)
+			continue
+		}
+
+		// Покрытие, время в эфире и Range Test считаются по каждому шлюзу, поэтому
+		// получают все копии пакета до отбрасывания повторов
+		if coverage != nil {
+			coverage.Observe(&record)
+		}
+		if rangeTest != nil {
+			rangeTest.Observe(&record)
+		}
+		if airtime != nil {
+			airtime.Observe(&record)
+		}
+		var fenceEvents []GeofenceEvent
+		if fences != nil {
+			fenceEvents = fences.Observe(&record)
+		}
+		if presence != nil {
+			events := presence.Observe(&record)
+			if alerts != nil {
+				alerts.Observe(&record, events)
+				alerts.HandleGeofence(fenceEvents)
+			}
+		}
+		if correlator != nil && correlator.Observe(&record) && opts.Dedup {
+			duplicates++
+			continue
+		}
+
+		writeRecord(writer, record)
+		processed++
+
+		if cot != nil {
+			if err := cot.Export(&record); err != nil {
+				fmt.Printf("Ошибка экспорта CoT: %v\n", err)
+			}
+		}
+		if pax != nil {
+			if err := pax.Write(&record); err != nil {
+				fmt.Printf("Ошибка записи Paxcount: %v\n", err)
+			}
+		}
+		if telemetry != nil {
+			if err := telemetry.Write(&record); err != nil {
+				fmt.Printf("Ошибка записи телеметрии: %v\n", err)
+			}
+		}
+		if processed%100 == 0 {
+			fmt.Printf("Обработано %d сообщений...\n", processed)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Ошибка чтения файла: %v\n", err)
+	}
+
+	fmt.Printf("Готово! Обработано %d сообщений. Результаты сохранены в %s\n", processed, outputFile)
+	if opts.Dedup {
+		fmt.Printf("Пропущено повторных копий: %d\n", duplicates)
+	}
+
+	if correlator != nil {
+		correlator.PrintSummary()
+		if opts.CorrelateFile != "" {
+			if err := correlator.WriteReport(opts.CorrelateFile); err != nil {
+				fmt.Printf("Ошибка записи отчета о копиях: %v\n", err)
+			}
+		}
+		if opts.FloodFile != "" {
+			flood := analyzeFlood(correlator.packets)
+			if err := flood.Write(opts.FloodFile); err != nil {
+				fmt.Printf("Ошибка записи деревьев ретрансляции: %v\n", err)
+			} else {
+				flood.PrintSummary()
+			}
+		}
+	}
+
+	if coverage != nil {
+		if err := coverage.WriteReport(opts.CoverageFile); err != nil {
+			fmt.Printf("Ошибка записи отчета о покрытии: %v\n", err)
+		} else {
+			coverage.PrintSummary()
+		}
+	}
+
+	if airtime != nil {
+		if err := airtime.WriteReport(opts.AirtimeFile); err != nil {
+			fmt.Printf("Ошибка записи отчета о времени в эфире: %v\n", err)
+		} else {
+			airtime.PrintSummary()
+		}
+	}
+
+	if fences != nil {
+		fences.PrintSummary()
+	}
+
+	if alerts != nil {
+		// Узлы, замолчавшие к концу захвата, проверяются на момент последнего пакета
+		alerts.Check(presence.now)
+		alerts.PrintSummary()
+	}
+
+	if opts.PresenceFile != "" {
+		if err := presence.WriteReport(opts.PresenceFile); err != nil {
+			fmt.Printf("Ошибка записи хронологии присутствия: %v\n", err)
+		} else {
+			presence.PrintSummary()
+		}
+	}
+
+	if rangeTest != nil {
+		if err := rangeTest.WriteReport(opts.RangeTestFile); err != nil {
+			fmt.Printf("Ошибка записи отчета Range Test: %v\n", err)
+		} else {
+			rangeTest.PrintSummary()
+		}
+	}
+	return nil
+}
+
+// decodeCaptureLine декодирует строку захвата "timestamp | topic | hex".
+// Для строки неверного формата возвращает запись с описанием ошибки и false.
+func decodeCaptureLine(line string, lineNum int) (CSVRecord, bool) {
+	parts := strings.Split(line, " | ")
+	if len(parts) != 3 {
+		record := CSVRecord{
+			Timestamp: parts[0],
+			Error:     fmt.Sprintf("Неверный формат строки %d", lineNum),
+		}
+		if len(parts) > 1 {
+			record.Topic = parts[1]
+		}
+		return record, false
+	}
+
+	timestamp := parts[0]
+	topic := parts[1]
+	hexData := parts[2]
+
+	// Декодируем hex в байты
+	data, err := hex.DecodeString(hexData)
+	if err != nil {
+		record := CSVRecord{
+			Timestamp: timestamp,
+			Topic:     topic,
+			Error:     fmt.Sprintf("Ошибка декодирования hex: %v", err),
+		}
+		return record, false
+	}
+
+	return DecodeMessage(timestamp, topic, data), true
+}
+
+// DecodeMessage разбирает одно MQTT сообщение. Метка времени - в формате захвата
+// (CaptureTimestamp), ошибки разбора попадают в поле Error записи.
+func DecodeMessage(timestamp, topic string, data []byte) CSVRecord {
+	var record CSVRecord
+	record.Timestamp = timestamp
+	record.Topic = topic
+
+	// Определяем тип сообщения по топику
+	if strings.Contains(topic, "/map/") {
+		if !decodeMapReport(data, &record) {
+			// Если не получилось декодировать как MapReport, пробуем ServiceEnvelope
+			decodeServiceEnvelope(data, &record)
+		}
+	} else if strings.Contains(topic, "/e/") {
+		decodeServiceEnvelope(data, &record)
+	} else {
+		decodeServiceEnvelope(data, &record)
+	}
+
+	return record
+}
+
+// CaptureTimestamp форматирует время так же, как cmd/parser пишет его в raw_messages.txt
+func CaptureTimestamp(at time.Time) string {
+	return at.In(captureLocation).Format(timestampLayouts[0])
+}
+
+// forEachCaptureRecord декодирует файл захвата и вызывает fn для каждой записи
+// в порядке строк. Строки неверного формата пропускаются.
+func forEachCaptureRecord(path string, fn func(record *CSVRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if record, ok := decodeCaptureLine(line, lineNum); ok {
+			fn(&record)
+		}
+	}
+	return scanner.Err()
+}
+
+func decodeMapReport(data []byte, record *CSVRecord) bool {
+	var mapReport generated.MapReport
+	if err := proto.Unmarshal(data, &mapReport); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования MapReport: %v", err)
+		return false
+	}
+
+	record.MessageType = "MapReport"
+	record.MapLongName = mapReport.GetLongName()
+	record.MapShortName = mapReport.GetShortName()
+	record.MapRole = mapReport.GetRole().String()
+	record.MapHwModel = mapReport.GetHwModel().String()
+	record.MapFirmwareVersion = mapReport.GetFirmwareVersion()
+	record.MapRegion = mapReport.GetRegion().String()
+	record.MapModemPreset = mapReport.GetModemPreset().String()
+	record.MapHasDefaultChannel = boolToString(mapReport.GetHasDefaultChannel())
+
+	if setPosition(record, mapReport.GetLatitudeI(), mapReport.GetLongitudeI(), mapReport.GetPositionPrecision()) {
+		record.Altitude = fmt.Sprintf("%d", mapReport.GetAltitude())
+	}
+
+	record.MapPositionPrecision = fmt.Sprintf("%d", mapReport.GetPositionPrecision())
+	record.MapOnlineLocalNodes = fmt.Sprintf("%d", mapReport.GetNumOnlineLocalNodes())
+	record.MapOptedReportLocation = boolToString(mapReport.GetHasOptedReportLocation())
+	return true
+}
+
+func decodeServiceEnvelope(data []byte, record *CSVRecord) {
+	var envelope generated.ServiceEnvelope
+	if err := proto.Unmarshal(data, &envelope); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования ServiceEnvelope: %v", err)
+		return
+	}
+
+	record.MessageType = "ServiceEnvelope"
+	record.ChannelID = envelope.GetChannelId()
+	record.GatewayID = envelope.GetGatewayId()
+
+	packet := envelope.GetPacket()
+	if packet == nil {
+		record.Error = "Packet отсутствует"
+		return
+	}
+
+	record.From = fmt.Sprintf("%d", packet.GetFrom())
+	record.To = fmt.Sprintf("%d", packet.GetTo())
+	record.Channel = fmt.Sprintf("%d", packet.GetChannel())
+	record.PacketID = fmt.Sprintf("%d", packet.GetId())
+	record.HopLimit = fmt.Sprintf("%d", packet.GetHopLimit())
+	record.WantAck = boolToString(packet.GetWantAck())
+	record.Priority = packet.GetPriority().String()
+	record.ViaMQTT = boolToString(packet.GetViaMqtt())
+	record.Transport = packet.GetTransportMechanism().String()
+	record.Delayed = packet.GetDelayed().String()
+	record.PkiEncrypted = boolToString(packet.GetPkiEncrypted())
+	if len(packet.GetPublicKey()) > 0 {
+		record.PublicKey = hex.EncodeToString(packet.GetPublicKey())
+	}
+
+	// hop_start появился в прошивке 2.3, у старых узлов он равен 0
+	if hopStart := packet.GetHopStart(); hopStart > 0 {
+		record.HopStart = fmt.Sprintf("%d", hopStart)
+		if hopStart >= packet.GetHopLimit() {
+			record.HopsAway = fmt.Sprintf("%d", hopStart-packet.GetHopLimit())
+		}
+	}
+	// relay_node и next_hop содержат только последний байт номера узла
+	if packet.GetRelayNode() != 0 {
+		record.RelayNode = fmt.Sprintf("%02x", packet.GetRelayNode())
+	}
+	if packet.GetNextHop() != 0 {
+		record.NextHop = fmt.Sprintf("%02x", packet.GetNextHop())
+	}
+
+	if rxTime := packet.GetRxTime(); rxTime != 0 {
+		received := time.Unix(int64(rxTime), 0)
+		record.RxTime = received.Format(time.RFC3339)
+		if captured, err := parseTimestamp(record.Timestamp); err == nil {
+			record.GatewayLatency = fmt.Sprintf("%.0f", captured.Sub(received).Seconds())
+		}
+	}
+	if packet.GetRxSnr() != 0 || packet.GetRxRssi() != 0 {
+		record.RxSNR = fmt.Sprintf("%.2f", packet.GetRxSnr())
+		record.RxRSSI = fmt.Sprintf("%d", packet.GetRxRssi())
+	}
+
+	// Шлюз услышал пакет напрямую от отправителя (hop_start == hop_limit)
+	if record.HopsAway == "0" && strings.HasPrefix(record.GatewayID, "!") {
+		if gateway, err := strconv.ParseUint(record.GatewayID[1:], 16, 32); err == nil {
+			record.addLink(packet.GetFrom(), uint32(gateway), record.RxSNR, linkDirect)
+		}
+	}
+
+	// Проверяем тип payload
+	if decoded := packet.GetDecoded(); decoded != nil {
+		record.PayloadType = "Decoded"
+		// AES-CTR не меняет длину, поэтому в эфире Data занимал столько же
+		record.airBytes = meshHeaderSize + proto.Size(decoded)
+		decodeData(decoded, record)
+	} else if encrypted := packet.GetEncrypted(); encrypted != nil {
+		record.PayloadType = "Encrypted"
+		record.airBytes = meshHeaderSize + len(encrypted)
+		record.EncryptedData = hex.EncodeToString(encrypted)
+		record.PayloadSize = fmt.Sprintf("%d", len(encrypted))
+
+		// Пытаемся расшифровать (если функция расшифровки реализована)
+		// Для полной поддержки расшифровки установите библиотеку github.com/meshtastic/go
+		if decryptedData := tryDecrypt(packet, encrypted); decryptedData != nil {
+			var data generated.Data
+			if err := proto.Unmarshal(decryptedData, &data); err == nil {
+				// Успешно расшифровано!
+				record.PayloadType = "Decrypted"
+				decodeData(&data, record)
+			}
+		}
+	} else {
+		record.PayloadType = "Отсутствует"
+	}
+}
+
+func decodeData(data *generated.Data, record *CSVRecord) {
+	record.Portnum = fmt.Sprintf("%d", data.GetPortnum())
+	record.PortnumName = data.GetPortnum().String()
+	record.PayloadSize = fmt.Sprintf("%d", len(data.GetPayload()))
+	if data.GetReplyId() != 0 {
+		record.ReplyID = fmt.Sprintf("%d", data.GetReplyId())
+	}
+	if data.GetEmoji() != 0 {
+		record.Emoji = fmt.Sprintf("%d", data.GetEmoji())
+	}
+	if data.GetRequestId() != 0 {
+		record.RequestID = fmt.Sprintf("%d", data.GetRequestId())
+	}
+
+	payload := data.GetPayload()
+	if len(payload) == 0 {
+		return
+	}
+
+	// Зарегистрированный декодер заменяет встроенный: так можно разобрать portnum,
+	// который собственная прошивка использует по-своему
+	if decodeRegistered(data.GetPortnum(), payload, record) {
+		return
+	}
+
+	// Декодируем payload в зависимости от portnum
+	switch data.GetPortnum() {
+	case generated.PortNum_TEXT_MESSAGE_APP, generated.PortNum_TEXT_MESSAGE_COMPRESSED_APP:
+		record.TextMessage = string(payload)
+
+	case generated.PortNum_POSITION_APP:
+		var position generated.Position
+		if err := proto.Unmarshal(payload, &position); err == nil {
+			setPosition(record, position.GetLatitudeI(), position.GetLongitudeI(), position.GetPrecisionBits())
+			if position.GetAltitude() != 0 {
+				record.Altitude = fmt.Sprintf("%d", position.GetAltitude())
+			}
+			record.PositionTime = fmt.Sprintf("%d", position.GetTime())
+			record.LocationSource = position.GetLocationSource().String()
+			record.PrecisionBits = fmt.Sprintf("%d", position.GetPrecisionBits())
+			if position.GetGroundTrack() != 0 {
+				record.GroundTrack = fmt.Sprintf("%d", position.GetGroundTrack())
+			}
+			if position.GetGroundSpeed() != 0 {
+				record.GroundSpeed = fmt.Sprintf("%d", position.GetGroundSpeed())
+			}
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования Position: %v", err)
+		}
+
+	case generated.PortNum_NODEINFO_APP:
+		var user generated.User
+		if err := proto.Unmarshal(payload, &user); err == nil {
+			record.UserID = user.GetId()
+			record.UserLongName = user.GetLongName()
+			record.UserShortName = user.GetShortName()
+			if len(user.GetMacaddr()) > 0 {
+				record.UserMacaddr = hex.EncodeToString(user.GetMacaddr())
+			}
+			record.UserHwModel = user.GetHwModel().String()
+			record.UserIsLicensed = boolToString(user.GetIsLicensed())
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования User: %v", err)
+		}
+
+	case generated.PortNum_TELEMETRY_APP:
+		var telemetry generated.Telemetry
+		if err := proto.Unmarshal(payload, &telemetry); err == nil {
+			if deviceMetrics := telemetry.GetDeviceMetrics(); deviceMetrics != nil {
+				record.BatteryLevel = fmt.Sprintf("%d", deviceMetrics.GetBatteryLevel())
+				record.Voltage = fmt.Sprintf("%.2f", deviceMetrics.GetVoltage())
+				record.ChannelUtilization = fmt.Sprintf("%.2f", deviceMetrics.GetChannelUtilization())
+				record.AirUtilTx = fmt.Sprintf("%.2f", deviceMetrics.GetAirUtilTx())
+				record.addMetric("battery_level", float64(deviceMetrics.GetBatteryLevel()))
+				record.addMetric("voltage", float64(deviceMetrics.GetVoltage()))
+				record.addMetric("channel_utilization", float64(deviceMetrics.GetChannelUtilization()))
+				record.addMetric("air_util_tx", float64(deviceMetrics.GetAirUtilTx()))
+			}
+			if envMetrics := telemetry.GetEnvironmentMetrics(); envMetrics != nil {
+				record.Temperature = fmt.Sprintf("%.1f", envMetrics.GetTemperature())
+				record.RelativeHumidity = fmt.Sprintf("%.1f", envMetrics.GetRelativeHumidity())
+				record.BarometricPressure = fmt.Sprintf("%.1f", envMetrics.GetBarometricPressure())
+				record.GasResistance = fmt.Sprintf("%.1f", envMetrics.GetGasResistance())
+				record.addMetric("temperature", float64(envMetrics.GetTemperature()))
+				record.addMetric("relative_humidity", float64(envMetrics.GetRelativeHumidity()))
+				record.addMetric("barometric_pressure", float64(envMetrics.GetBarometricPressure()))
+				record.addMetric("gas_resistance", float64(envMetrics.GetGasResistance()))
+				if envMetrics.Lux != nil {
+					record.Lux = fmt.Sprintf("%.1f", envMetrics.GetLux())
+					record.addMetric("lux", float64(envMetrics.GetLux()))
+				}
+			}
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования Telemetry: %v", err)
+		}
+
+	case generated.PortNum_WAYPOINT_APP:
+		var waypoint generated.Waypoint
+		if err := proto.Unmarshal(payload, &waypoint); err == nil {
+			record.WaypointID = fmt.Sprintf("%d", waypoint.GetId())
+			record.WaypointName = waypoint.GetName()
+			record.WaypointDescription = waypoint.GetDescription()
+			lat := float64(waypoint.GetLatitudeI()) / 1e7
+			lon := float64(waypoint.GetLongitudeI()) / 1e7
+			if lat != 0 || lon != 0 {
+				record.Latitude = fmt.Sprintf("%.7f", lat)
+				record.Longitude = fmt.Sprintf("%.7f", lon)
+			}
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования Waypoint: %v", err)
+		}
+
+	case generated.PortNum_ROUTING_APP:
+		var routing generated.Routing
+		if err := proto.Unmarshal(payload, &routing); err == nil {
+			record.RoutingVariant = fmt.Sprintf("%v", routing.GetVariant())
+			if errRoute := routing.GetErrorReason(); errRoute != generated.Routing_NONE {
+				record.RoutingErrorReason = errRoute.String()
+			}
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования Routing: %v", err)
+		}
+
+	case generated.PortNum_REMOTE_HARDWARE_APP:
+		var hw generated.HardwareMessage
+		if err := proto.Unmarshal(payload, &hw); err == nil {
+			record.HwType = hw.GetType().String()
+			record.HwGpioMask = fmt.Sprintf("%d", hw.GetGpioMask())
+			record.HwGpioValue = fmt.Sprintf("%d", hw.GetGpioValue())
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования HardwareMessage: %v", err)
+		}
+
+	case generated.PortNum_MAP_REPORT_APP:
+		var mapReport generated.MapReport
+		if err := proto.Unmarshal(payload, &mapReport); err == nil {
+			record.MapLongName = mapReport.GetLongName()
+			record.MapShortName = mapReport.GetShortName()
+			record.MapRole = mapReport.GetRole().String()
+			record.MapHwModel = mapReport.GetHwModel().String()
+			record.MapFirmwareVersion = mapReport.GetFirmwareVersion()
+			record.MapRegion = mapReport.GetRegion().String()
+			record.MapModemPreset = mapReport.GetModemPreset().String()
+			record.MapHasDefaultChannel = boolToString(mapReport.GetHasDefaultChannel())
+			if setPosition(record, mapReport.GetLatitudeI(), mapReport.GetLongitudeI(), mapReport.GetPositionPrecision()) {
+				record.Altitude = fmt.Sprintf("%d", mapReport.GetAltitude())
+			}
+			record.MapPositionPrecision = fmt.Sprintf("%d", mapReport.GetPositionPrecision())
+			record.MapOnlineLocalNodes = fmt.Sprintf("%d", mapReport.GetNumOnlineLocalNodes())
+			record.MapOptedReportLocation = boolToString(mapReport.GetHasOptedReportLocation())
+		} else {
+			record.Error = fmt.Sprintf("Ошибка декодирования MapReport: %v", err)
+		}
+
+	case generated.PortNum_ATAK_PLUGIN:
+		decodeTAK(payload, record)
+
+	case generated.PortNum_PAXCOUNTER_APP:
+		decodePaxcount(payload, record)
+
+	case generated.PortNum_DETECTION_SENSOR_APP:
+		decodeDetectionSensor(payload, record)
+
+	case generated.PortNum_ALERT_APP:
+		decodeAlert(payload, record)
+
+	case generated.PortNum_ADMIN_APP:
+		decodeAdmin(payload, record)
+
+	case generated.PortNum_KEY_VERIFICATION_APP:
+		decodeKeyVerification(payload, record)
+
+	case generated.PortNum_RANGE_TEST_APP:
+		decodeRangeTest(payload, record)
+
+	case generated.PortNum_NEIGHBORINFO_APP:
+		decodeNeighborInfo(payload, record)
+
+	case generated.PortNum_TRACEROUTE_APP:
+		decodeTraceroute(payload, record)
+
+	case generated.PortNum_CAYENNE_APP:
+		decodeCayenne(payload, record)
+	}
+}
+
+func writeRecord(writer *csv.Writer, record CSVRecord) {
+	row := []string{
+		record.Timestamp, record.Topic, record.MessageType, record.ChannelID, record.GatewayID,
+		record.From, record.To, record.PacketID, record.Channel, record.HopLimit, record.WantAck,
+		record.Priority, record.ViaMQTT, record.Transport, record.HopStart, record.HopsAway,
+		record.RelayNode, record.NextHop, record.RxTime, record.RxSNR, record.RxRSSI, record.Delayed,
+		record.PkiEncrypted, record.PublicKey, record.GatewayLatency, record.PayloadType, record.Portnum,
+		record.PortnumName, record.PayloadSize, record.EncryptedData, record.ReplyID, record.Emoji,
+		record.RequestID, record.Latitude, record.Longitude,
+		record.Altitude, record.PositionTime, record.LocationSource, record.PrecisionBits,
+		record.PositionUncertainty, record.GroundTrack, record.GroundSpeed, record.GeofenceEvents, record.TextMessage, record.UserID,
+		record.UserLongName, record.UserShortName, record.UserMacaddr, record.UserHwModel, record.UserIsLicensed,
+		record.BatteryLevel, record.Voltage, record.ChannelUtilization, record.AirUtilTx,
+		record.Temperature, record.RelativeHumidity, record.BarometricPressure, record.GasResistance, record.Lux,
+		record.MapLongName, record.MapShortName, record.MapRole, record.MapHwModel,
+		record.MapFirmwareVersion, record.MapRegion, record.MapModemPreset, record.MapHasDefaultChannel,
+		record.MapPositionPrecision, record.MapOnlineLocalNodes, record.MapOptedReportLocation,
+		record.WaypointID, record.WaypointName, record.WaypointDescription, record.RoutingVariant,
+		record.RoutingErrorReason, record.HwType, record.HwGpioMask, record.HwGpioValue,
+		record.TakVariant, record.TakCompressed, record.TakCallsign, record.TakDeviceCallsign,
+		record.TakTeam, record.TakRole, record.TakBattery, record.TakSpeed, record.TakCourse,
+		record.TakChatTo, record.TakChatToCallsign, record.EventType, record.IsAlert,
+		record.PaxWifi, record.PaxBle, record.PaxUptime, record.DetectionText,
+		record.AdminVariant, record.AdminSummary, record.Neighbors,
+		record.TraceRoute, record.TraceRouteBack, record.RangeTestSeq,
+		record.CayenneValues, record.CustomDecoder, record.CustomValues, record.Error,
+	}
+	if err := writer.Write(row); err != nil {
+		fmt.Printf("Ошибка записи в CSV: %v\n", err)
+	}
+}
+
+// setPosition записывает координаты с учетом округления precision_bits: прошивка оставляет
+// старшие биты latitude_i/longitude_i, поэтому вместо угла ячейки пишем ее центр и радиус.
+// Возвращает false для нулевой позиции.
+func setPosition(record *CSVRecord, latI, lonI int32, precisionBits uint32) bool {
+	if latI == 0 && lonI == 0 {
+		return false
+	}
+	lat, lon, radius := precisionCell(latI, lonI, precisionBits)
+	record.Latitude = fmt.Sprintf("%.7f", lat)
+	record.Longitude = fmt.Sprintf("%.7f", lon)
+	if radius > 0 {
+		record.PositionUncertainty = fmt.Sprintf("%.0f", radius)
+	}
+	return true
+}
+
+func boolToString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// Форматы времени в raw_messages.txt: текущий формат parser и формат старых выгрузок
+var timestampLayouts = []string{"01.02.2006 15:04:05", "01.02.2006 15:04:05:000", "20060102_150405"}
+
+// captureLocation - часовой пояс, в котором parser записывал метки времени
+var captureLocation = time.Local
+
+// parseTimestamp разбирает метку времени строки захвата
+func parseTimestamp(timestamp string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, timestamp, captureLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неизвестный формат времени: %q", timestamp)
+}
+
+// NodeIDFromString переводит десятичный номер узла из CSV в формат Meshtastic "!xxxxxxxx"
+func NodeIDFromString(num string) string {
+	n, err := strconv.ParseUint(num, 10, 32)
+	if err != nil {
+		return num
+	}
+	return fmt.Sprintf("!%08x", n)
+}
+
+// nodeIDFromNum форматирует номер узла как "!xxxxxxxx"
+func nodeIDFromNum(num uint32) string {
+	return fmt.Sprintf("!%08x", num)
+}
+
+// tryDecrypt пытается расшифровать зашифрованные данные используя стандартные ключи Meshtastic
+//
+// Реализация основана на алгоритме Meshtastic:
+// - AES-256-CTR для PSK шифрования каналов
+// - Nonce формируется из ID пакета (8 байт) и From узла (4 байта) + padding
+// - Поддерживаются стандартные ключи: default и simple1-10
+//
+// ВАЖНО: PKI шифрование (для прямых сообщений) не поддерживается в этой реализации,
+// так как требует приватных ключей устройств.
+func tryDecrypt(packet *generated.MeshPacket, encrypted []byte) []byte {
+	if len(encrypted) == 0 {
+		return nil
+	}
+
+	// Если используется PKI шифрование, нужен приватный ключ (не реализовано здесь)
+	if packet.GetPkiEncrypted() {
+		// Для PKI нужен приватный ключ получателя - это требует библиотеки Meshtastic Go
+		return nil
+	}
+
+	nonce := packetNonce(packet)
+
+	// Пробуем расшифровать с каждым ключом
+	for _, candidate := range channelKeyCandidates() {
+		if decrypted := decryptAESCTR(encrypted, candidate.Key, nonce); len(decrypted) > 0 {
+			// Проверяем, что расшифрованные данные валидны (попытка распарсить как Data)
+			var testData generated.Data
+			if err := proto.Unmarshal(decrypted, &testData); err == nil {
+				// Успешно расшифровано!
+				return decrypted
+			}
+		}
+	}
+
+	return nil
+}
+
+// channelKey - ключ канала, который пробуем при расшифровке
+type channelKey struct {
+	Name string
+	Key  []byte
+}
+
+// defaultPSK - стандартный ключ по умолчанию для каналов Meshtastic
+// Из channel.proto: {0xd4, 0xf1, 0xbb, 0x3a, 0x20, 0x29, 0x07, 0x59, 0xf0, 0xbc, 0xff, 0xab, 0xcf, 0x4e, 0x69, 0x01}
+var defaultPSK = []byte{0xd4, 0xf1, 0xbb, 0x3a, 0x20, 0x29, 0x07, 0x59, 0xf0, 0xbc, 0xff, 0xab, 0xcf, 0x4e, 0x69, 0x01}
+
+// channelKeyCandidates возвращает ключи в порядке перебора: стандартный ключ и simple1-10,
+// каждый сначала как AES-256, затем как AES-128
+func channelKeyCandidates() []channelKey {
+	// Пробуем стандартный ключ и варианты (simple1-10)
+	var candidates []channelKey
+	for i := 0; i <= 10; i++ {
+		psk := make([]byte, 16)
+		copy(psk, defaultPSK)
+		psk[15] = defaultPSK[15] + byte(i)
+
+		name := "default"
+		if i > 0 {
+			name = fmt.Sprintf("simple%d", i)
+		}
+
+		// Meshtastic использует AES-256, поэтому расширяем 16-байтный PSK до 32 байт
+		// Путем дублирования (стандартный подход Meshtastic)
+		key := make([]byte, 32)
+		copy(key[:16], psk)
+		copy(key[16:], psk)
+
+		candidates = append(candidates,
+			channelKey{Name: name + " AES-256", Key: key},
+			// Также пробуем с оригинальным 16-байтным ключом для AES-128
+			channelKey{Name: name + " AES-128", Key: psk},
+		)
+	}
+	return candidates
+}
+
+// packetNonce формирует nonce для AES-CTR из ID пакета и From узла
+func packetNonce(packet *generated.MeshPacket) []byte {
+	packetID := packet.GetId()
+	fromNode := packet.GetFrom()
+
+	// Для AES-CTR нужен 16-байтный nonce
+	// Meshtastic использует ID пакета (8 байт) и From узла (4 байта) + padding
+	nonce := make([]byte, 16)
+	// Первые 8 байт - ID пакета (little-endian)
+	nonce[0] = byte(packetID)
+	nonce[1] = byte(packetID >> 8)
+	nonce[2] = byte(packetID >> 16)
+	nonce[3] = byte(packetID >> 24)
+	// Следующие 4 байта - From узла (little-endian)
+	nonce[8] = byte(fromNode)
+	nonce[9] = byte(fromNode >> 8)
+	nonce[10] = byte(fromNode >> 16)
+	nonce[11] = byte(fromNode >> 24)
+	return nonce
+}
+
+// decryptAESCTR расшифровывает данные используя AES-CTR
+func decryptAESCTR(ciphertext []byte, key []byte, nonce []byte) []byte {
+	if len(ciphertext) == 0 || len(nonce) != 16 {
+		return nil
+	}
+
+	var block cipher.Block
+	var err error
+
+	// Поддерживаем только AES-128 (16 байт) и AES-256 (32 байта)
+	if len(key) == 16 {
+		block, err = aes.NewCipher(key)
+	} else if len(key) == 32 {
+		block, err = aes.NewCipher(key)
+	} else {
+		return nil
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	// Создаем CTR stream
+	stream := cipher.NewCTR(block, nonce)
+	plaintext := make([]byte, len(ciphertext))
+	stream.XORKeyStream(plaintext, ciphertext)
+
+	return plaintext
+}
@@ -0,0 +1,93 @@
+package decoder
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// marshalEnvelope упаковывает пакет в ServiceEnvelope так, как его публикует шлюз
+func marshalEnvelope(t *testing.T, gateway string, packet *generated.MeshPacket) []byte {
+	t.Helper()
+	data, err := proto.Marshal(&generated.ServiceEnvelope{Packet: packet, ChannelId: "LongFast", GatewayId: gateway})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// packetMetadata - колонки метаданных MeshPacket
+type packetMetadata struct {
+	HopLimit, HopStart, HopsAway, RelayNode, NextHop string
+	RxTime, RxSNR, RxRSSI, GatewayLatency            string
+	ViaMQTT, Transport, Priority, PkiEncrypted       string
+	PublicKey                                        string
+}
+
+func TestDecodeMeshPacketMetadata(t *testing.T) {
+	received := time.Date(2025, 11, 17, 12, 0, 0, 0, time.UTC)
+	text := &generated.MeshPacket_Decoded{Decoded: &generated.Data{Portnum: generated.PortNum_TEXT_MESSAGE_APP, Payload: []byte("hi")}}
+	tests := []struct {
+		name   string
+		packet *generated.MeshPacket
+		want   packetMetadata
+	}{
+		{
+			name: "direct",
+			packet: &generated.MeshPacket{
+				HopStart: 3, HopLimit: 3, RelayNode: 0x08, NextHop: 0x44,
+				RxTime: uint32(received.Unix()), RxSnr: 6.25, RxRssi: -97,
+				Priority: generated.MeshPacket_RELIABLE, TransportMechanism: generated.MeshPacket_TRANSPORT_LORA,
+			},
+			want: packetMetadata{
+				HopLimit: "3", HopStart: "3", HopsAway: "0", RelayNode: "08", NextHop: "44",
+				RxTime: received.Local().Format(time.RFC3339), RxSNR: "6.25", RxRSSI: "-97", GatewayLatency: "4",
+				ViaMQTT: "false", Transport: "TRANSPORT_LORA", Priority: "RELIABLE", PkiEncrypted: "false",
+			},
+		},
+		{
+			name:   "relayed via mqtt",
+			packet: &generated.MeshPacket{HopStart: 7, HopLimit: 4, ViaMqtt: true, TransportMechanism: generated.MeshPacket_TRANSPORT_MQTT},
+			want: packetMetadata{
+				HopLimit: "4", HopStart: "7", HopsAway: "3",
+				ViaMQTT: "true", Transport: "TRANSPORT_MQTT", Priority: "UNSET", PkiEncrypted: "false",
+			},
+		},
+		{
+			name:   "firmware before 2.3",
+			packet: &generated.MeshPacket{HopLimit: 3},
+			want:   packetMetadata{HopLimit: "3", ViaMQTT: "false", Transport: "TRANSPORT_INTERNAL", Priority: "UNSET", PkiEncrypted: "false"},
+		},
+		{
+			name:   "pki",
+			packet: &generated.MeshPacket{HopStart: 3, HopLimit: 5, PkiEncrypted: true, PublicKey: []byte{0x01, 0x02}},
+			want: packetMetadata{
+				HopLimit: "5", HopStart: "3", ViaMQTT: "false", Transport: "TRANSPORT_INTERNAL", Priority: "UNSET",
+				PkiEncrypted: "true", PublicKey: "0102",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.packet.From, tt.packet.To, tt.packet.Id = 0x11223344, BroadcastAddr, 42
+			tt.packet.PayloadVariant = text
+			r := DecodeMessage(CaptureTimestamp(received.Add(4*time.Second)), "msh/RU/ARKH/2/e/LongFast/!9028d008",
+				marshalEnvelope(t, "!9028d008", tt.packet))
+			if r.Error != "" || r.TextMessage != "hi" {
+				t.Fatalf("error %q text %q", r.Error, r.TextMessage)
+			}
+			got := packetMetadata{
+				HopLimit: r.HopLimit, HopStart: r.HopStart, HopsAway: r.HopsAway, RelayNode: r.RelayNode, NextHop: r.NextHop,
+				RxTime: r.RxTime, RxSNR: r.RxSNR, RxRSSI: r.RxRSSI, GatewayLatency: r.GatewayLatency,
+				ViaMQTT: r.ViaMQTT, Transport: r.Transport, Priority: r.Priority, PkiEncrypted: r.PkiEncrypted,
+				PublicKey: r.PublicKey,
+			}
+			if got != tt.want {
+				t.Errorf("metadata = %+v\nwant       %+v", got, tt.want)
+			}
+		})
+	}
+}
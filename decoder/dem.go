@@ -0,0 +1,111 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Значение "нет данных" в тайлах SRTM
+const hgtVoid = -32768
+
+// hgtTile - тайл SRTM 1x1 градус: квадратная сетка высот big-endian int16,
+// первая строка - северный край, 1201 (3") или 3601 (1") отсчетов на сторону
+type hgtTile struct {
+	size    int
+	heights []int16
+}
+
+// demTiles читает тайлы .hgt из каталога по мере надобности
+type demTiles struct {
+	dir   string
+	tiles map[string]*hgtTile
+}
+
+func newDEMTiles(dir string) *demTiles {
+	return &demTiles{dir: dir, tiles: make(map[string]*hgtTile)}
+}
+
+// hgtTileName возвращает имя тайла, содержащего точку: N64E040
+func hgtTileName(lat, lon float64) string {
+	latBase, lonBase := int(math.Floor(lat)), int(math.Floor(lon))
+	ns, ew := 'N', 'E'
+	if latBase < 0 {
+		ns, latBase = 'S', -latBase
+	}
+	if lonBase < 0 {
+		ew, lonBase = 'W', -lonBase
+	}
+	return fmt.Sprintf("%c%02d%c%03d", ns, latBase, ew, lonBase)
+}
+
+func (d *demTiles) tile(name string) (*hgtTile, error) {
+	if t, ok := d.tiles[name]; ok {
+		if t == nil {
+			return nil, fmt.Errorf("нет тайла %s.hgt в %s", name, d.dir)
+		}
+		return t, nil
+	}
+
+	var data []byte
+	var err error
+	for _, candidate := range []string{name + ".hgt", strings.ToLower(name) + ".hgt"} {
+		if data, err = os.ReadFile(filepath.Join(d.dir, candidate)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		d.tiles[name] = nil
+		return nil, fmt.Errorf("нет тайла %s.hgt в %s", name, d.dir)
+	}
+
+	size := int(math.Sqrt(float64(len(data) / 2)))
+	if size < 2 || size*size*2 != len(data) {
+		return nil, fmt.Errorf("тайл %s.hgt: неожиданный размер %d байт", name, len(data))
+	}
+	t := &hgtTile{size: size, heights: make([]int16, size*size)}
+	for i := range t.heights {
+		t.heights[i] = int16(binary.BigEndian.Uint16(data[i*2:]))
+	}
+	d.tiles[name] = t
+	return t, nil
+}
+
+// Elevation возвращает высоту рельефа над уровнем моря в метрах (билинейная интерполяция)
+func (d *demTiles) Elevation(lat, lon float64) (float64, error) {
+	t, err := d.tile(hgtTileName(lat, lon))
+	if err != nil {
+		return 0, err
+	}
+
+	cells := float64(t.size - 1)
+	y := (math.Floor(lat) + 1 - lat) * cells
+	x := (lon - math.Floor(lon)) * cells
+	row, col := min(int(y), t.size-2), min(int(x), t.size-2)
+	fy, fx := y-float64(row), x-float64(col)
+
+	corners := [4]struct {
+		h, w float64
+	}{
+		{float64(t.heights[row*t.size+col]), (1 - fx) * (1 - fy)},
+		{float64(t.heights[row*t.size+col+1]), fx * (1 - fy)},
+		{float64(t.heights[(row+1)*t.size+col]), (1 - fx) * fy},
+		{float64(t.heights[(row+1)*t.size+col+1]), fx * fy},
+	}
+	// Пропуски в данных исключаем и перенормируем веса оставшихся отсчетов
+	sum, weight := 0.0, 0.0
+	for _, c := range corners {
+		if c.h == hgtVoid {
+			continue
+		}
+		sum += c.h * c.w
+		weight += c.w
+	}
+	if weight == 0 {
+		return 0, fmt.Errorf("нет данных о высоте в точке %.5f, %.5f", lat, lon)
+	}
+	return sum / weight, nil
+}
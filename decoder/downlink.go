@@ -0,0 +1,216 @@
+package decoder
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// BroadcastAddr - адрес "всем узлам"
+const BroadcastAddr uint32 = 0xffffffff
+
+// Наибольшее число ретрансляций, которое принимает прошивка
+const maxHopLimit = 7
+
+// Число ретрансляций по умолчанию, как в настройках LoRa прошивки
+const defaultHopLimit = 3
+
+// TextMessage - исходящее текстовое сообщение в сеть через MQTT
+type TextMessage struct {
+	// From - номер узла-отправителя, обычно совпадает со шлюзом, от имени которого публикуется пакет
+	From uint32
+	// To - получатель личного сообщения, 0 или BroadcastAddr - всем в канале
+	To uint32
+	// Channel - имя канала, входит в хеш канала и в топик
+	Channel string
+	// PSK - ключ канала (см. ParsePSK), пустой - без шифрования
+	PSK     []byte
+	Text    string
+	ReplyID uint32
+	// ID - номер пакета, 0 - случайный
+	ID uint32
+	// HopLimit - число ретрансляций, 0 - по умолчанию 3. Пакет с нулем
+	// ретрансляций не передал бы дальше ни один узел, поэтому отдельно не задается.
+	HopLimit uint32
+	WantAck  bool
+}
+
+// EncodeTextMessage собирает сообщение так же, как прошивка: Data{TEXT_MESSAGE_APP}
+// шифруется ключом канала (AES-CTR, nonce из id пакета и отправителя) и кладется
+// в MeshPacket с хешем канала, затем в ServiceEnvelope. Возвращает сериализованный
+// конверт и номер пакета. PKI шифрование личных сообщений не поддерживается -
+// они шифруются ключом канала, как в прошивках до 2.5.
+func EncodeTextMessage(msg TextMessage) ([]byte, uint32, error) {
+	if msg.From == 0 || msg.From == BroadcastAddr {
+		return nil, 0, fmt.Errorf("неверный узел-отправитель %s", nodeIDFromNum(msg.From))
+	}
+	if msg.Channel == "" {
+		return nil, 0, fmt.Errorf("не указан канал")
+	}
+	if msg.Text == "" {
+		return nil, 0, fmt.Errorf("пустое сообщение")
+	}
+	if msg.HopLimit > maxHopLimit {
+		return nil, 0, fmt.Errorf("hop_limit %d больше %d", msg.HopLimit, maxHopLimit)
+	}
+	switch len(msg.PSK) {
+	case 0, 16, 32:
+	default:
+		return nil, 0, fmt.Errorf("ключ канала должен быть 16 или 32 байта, а не %d", len(msg.PSK))
+	}
+	if msg.To == 0 {
+		msg.To = BroadcastAddr
+	}
+	if msg.HopLimit == 0 {
+		msg.HopLimit = defaultHopLimit
+	}
+	if msg.ID == 0 {
+		id, err := randomPacketID()
+		if err != nil {
+			return nil, 0, err
+		}
+		msg.ID = id
+	}
+
+	data := &generated.Data{
+		Portnum: generated.PortNum_TEXT_MESSAGE_APP,
+		Payload: []byte(msg.Text),
+		ReplyId: msg.ReplyID,
+	}
+	plain, err := proto.Marshal(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(plain) > int(generated.Constants_DATA_PAYLOAD_LEN) {
+		return nil, 0, fmt.Errorf("сообщение длиннее %d байт", generated.Constants_DATA_PAYLOAD_LEN)
+	}
+
+	packet := &generated.MeshPacket{
+		From:     msg.From,
+		To:       msg.To,
+		Id:       msg.ID,
+		Channel:  channelPacketHash(msg.Channel, msg.PSK),
+		HopLimit: msg.HopLimit,
+		HopStart: msg.HopLimit,
+		WantAck:  msg.WantAck,
+	}
+	if len(msg.PSK) == 0 {
+		packet.PayloadVariant = &generated.MeshPacket_Decoded{Decoded: data}
+	} else {
+		// AES-CTR симметричен: шифрование совпадает с расшифровкой
+		encrypted := decryptAESCTR(plain, msg.PSK, packetNonce(packet))
+		if encrypted == nil {
+			return nil, 0, fmt.Errorf("ошибка шифрования")
+		}
+		packet.PayloadVariant = &generated.MeshPacket_Encrypted{Encrypted: encrypted}
+	}
+
+	envelope, err := proto.Marshal(&generated.ServiceEnvelope{
+		Packet:    packet,
+		ChannelId: msg.Channel,
+		GatewayId: nodeIDFromNum(msg.From),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return envelope, msg.ID, nil
+}
+
+// DownlinkTopic возвращает топик публикации: msh/<region>/2/e/<channel>/<gateway>
+func DownlinkTopic(region, channel string, gateway uint32) string {
+	return fmt.Sprintf("msh/%s/2/e/%s/%s", strings.Trim(region, "/"), channel, nodeIDFromNum(gateway))
+}
+
+// randomPacketID возвращает случайный ненулевой номер пакета
+func randomPacketID() (uint32, error) {
+	var buf [4]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return 0, fmt.Errorf("ошибка генерации id пакета: %w", err)
+		}
+		if id := binary.LittleEndian.Uint32(buf[:]); id != 0 {
+			return id, nil
+		}
+	}
+}
+
+// channelPacketHash - байт хеша канала в MeshPacket.channel: XOR байтов имени
+// канала, сложенный XOR с байтами ключа. По нему прошивка выбирает ключ при приеме.
+func channelPacketHash(name string, psk []byte) uint32 {
+	var hash byte
+	for i := 0; i < len(name); i++ {
+		hash ^= name[i]
+	}
+	for _, b := range psk {
+		hash ^= b
+	}
+	return uint32(hash)
+}
+
+// ParsePSK разбирает ключ канала в форматах настроек Meshtastic: "default",
+// "none", "simpleN", base64 ("AQ==") или hex с префиксом 0x. Однобайтовый ключ -
+// номер стандартного ключа: 0 - без шифрования, 1 - default, N - default с
+// последним байтом, увеличенным на N-1.
+func ParsePSK(value string) ([]byte, error) {
+	var key []byte
+	switch lower := strings.ToLower(strings.TrimSpace(value)); {
+	case lower == "" || lower == "default":
+		key = []byte{1}
+	case lower == "none":
+		key = []byte{0}
+	case strings.HasPrefix(lower, "simple"):
+		n, err := strconv.ParseUint(lower[len("simple"):], 10, 8)
+		if err != nil || n > 254 {
+			return nil, fmt.Errorf("неверный ключ %q", value)
+		}
+		key = []byte{byte(n + 1)}
+	case strings.HasPrefix(lower, "0x"):
+		var err error
+		if key, err = hex.DecodeString(lower[2:]); err != nil {
+			return nil, fmt.Errorf("неверный ключ %q: %w", value, err)
+		}
+	default:
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("неверный ключ %q: %w", value, err)
+		}
+	}
+
+	switch len(key) {
+	case 0:
+		return nil, nil
+	case 1:
+		if key[0] == 0 {
+			return nil, nil
+		}
+		psk := make([]byte, len(defaultPSK))
+		copy(psk, defaultPSK)
+		psk[len(psk)-1] += key[0] - 1
+		return psk, nil
+	case 16, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("ключ %q: длина %d байт, нужно 1, 16 или 32", value, len(key))
+}
+
+// ParseNodeID разбирает номер узла: !xxxxxxxx, 0x..., десятичный или ^all для всех
+func ParseNodeID(value string) (uint32, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "^all", "all", "!ffffffff":
+		return BroadcastAddr, nil
+	}
+	n, err := parsePacketID(value)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("неверный ID узла %q", value)
+	}
+	return uint32(n), nil
+}
@@ -0,0 +1,142 @@
+package decoder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePSK(t *testing.T) {
+	simple3 := append([]byte(nil), defaultPSK...)
+	simple3[len(simple3)-1] += 3
+	key32 := bytes.Repeat([]byte{0x11}, 32)
+	tests := []struct {
+		value   string
+		want    []byte
+		wantErr bool
+	}{
+		{value: "", want: defaultPSK},
+		{value: "default", want: defaultPSK},
+		{value: " Default ", want: defaultPSK},
+		{value: "AQ==", want: defaultPSK},
+		{value: "none", want: nil},
+		{value: "AA==", want: nil},
+		{value: "simple3", want: simple3},
+		{value: "0x" + "11111111111111111111111111111111" + "11111111111111111111111111111111", want: key32},
+		{value: "1PG7OiApB1nwvP+rz05pAQ==", want: defaultPSK},
+		{value: "simple", wantErr: true},
+		{value: "simple255", wantErr: true},
+		{value: "0xzz", wantErr: true},
+		{value: "AQID", wantErr: true},
+		{value: "не base64", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParsePSK(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePSK(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ParsePSK(%q) = %x, want %x", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelPacketHash(t *testing.T) {
+	tests := []struct {
+		name string
+		psk  []byte
+		want uint32
+	}{
+		// Значения из захвата: пакеты LongFast и ArkhMesh со стандартным ключом
+		{name: "LongFast", psk: defaultPSK, want: 8},
+		{name: "ArkhMesh", psk: defaultPSK, want: 1},
+		{name: "LongFast", psk: nil, want: 0x0a},
+		{name: "", psk: nil, want: 0},
+	}
+	for _, tt := range tests {
+		if got := channelPacketHash(tt.name, tt.psk); got != tt.want {
+			t.Errorf("channelPacketHash(%q, %x) = %d, want %d", tt.name, tt.psk, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeTextMessageRoundTrip(t *testing.T) {
+	simple3, err := ParsePSK("simple3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		msg       TextMessage
+		to        string
+		hopLimit  string
+		replyID   string
+		encrypted bool
+	}{
+		{
+			name: "default key broadcast",
+			msg:  TextMessage{From: 0x11223344, Channel: "LongFast", PSK: defaultPSK, Text: "Привет, сеть", ID: 0x0badcafe},
+			to:   "4294967295", hopLimit: "3", encrypted: true,
+		},
+		{
+			name: "simple key direct reply",
+			msg:  TextMessage{From: 0x11223344, To: 0x55667788, Channel: "ArkhMesh", PSK: simple3, Text: "ответ", ReplyID: 12345, ID: 0x5a17c0de, HopLimit: 5},
+			to:   "1432778632", hopLimit: "5", replyID: "12345", encrypted: true,
+		},
+		{
+			name: "no encryption",
+			msg:  TextMessage{From: 0x11223344, Channel: "Open", Text: "open text", ID: 42},
+			to:   "4294967295", hopLimit: "3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, id, err := EncodeTextMessage(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.msg.ID != 0 && id != tt.msg.ID {
+				t.Errorf("id = %d, want %d", id, tt.msg.ID)
+			}
+			record := DecodeMessage("17.11.2025 12:00:00", DownlinkTopic("RU/ARKH", tt.msg.Channel, tt.msg.From), payload)
+			if record.Error != "" {
+				t.Fatalf("DecodeMessage: %s", record.Error)
+			}
+			if record.TextMessage != tt.msg.Text || record.From != "287454020" || record.To != tt.to {
+				t.Errorf("decoded %q from %s to %s, want %q from 287454020 to %s", record.TextMessage, record.From, record.To, tt.msg.Text, tt.to)
+			}
+			if record.HopLimit != tt.hopLimit || record.HopsAway != "0" {
+				t.Errorf("hop_limit %s hops_away %s, want %s and 0", record.HopLimit, record.HopsAway, tt.hopLimit)
+			}
+			if record.ReplyID != tt.replyID {
+				t.Errorf("reply_id = %s, want %s", record.ReplyID, tt.replyID)
+			}
+			if (record.EncryptedData != "") != tt.encrypted || record.ChannelID != tt.msg.Channel {
+				t.Errorf("encrypted %q channel %s, want encrypted %v channel %s", record.EncryptedData, record.ChannelID, tt.encrypted, tt.msg.Channel)
+			}
+		})
+	}
+}
+
+func TestEncodeTextMessageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  TextMessage
+	}{
+		{name: "no sender", msg: TextMessage{Channel: "LongFast", Text: "x"}},
+		{name: "broadcast sender", msg: TextMessage{From: BroadcastAddr, Channel: "LongFast", Text: "x"}},
+		{name: "no channel", msg: TextMessage{From: 1, Text: "x"}},
+		{name: "empty text", msg: TextMessage{From: 1, Channel: "LongFast"}},
+		{name: "hop limit", msg: TextMessage{From: 1, Channel: "LongFast", Text: "x", HopLimit: 8}},
+		{name: "short key", msg: TextMessage{From: 1, Channel: "LongFast", Text: "x", PSK: []byte{1, 2, 3}}},
+		{name: "too long", msg: TextMessage{From: 1, Channel: "LongFast", Text: string(bytes.Repeat([]byte("x"), 300))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := EncodeTextMessage(tt.msg); err == nil {
+				t.Error("EncodeTextMessage: want error")
+			}
+		})
+	}
+}
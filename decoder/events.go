@@ -0,0 +1,91 @@
+package decoder
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// Типы событий в колонке EventType
+const (
+	eventPaxcount  = "Paxcount"
+	eventDetection = "DetectionSensor"
+	eventAlert     = "Alert"
+)
+
+// decodePaxcount разбирает счетчик людей PAXCOUNTER_APP (wifi, ble, uptime)
+func decodePaxcount(payload []byte, record *CSVRecord) {
+	var pax generated.Paxcount
+	if err := proto.Unmarshal(payload, &pax); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования Paxcount: %v", err)
+		return
+	}
+
+	record.EventType = eventPaxcount
+	record.PaxWifi = fmt.Sprintf("%d", pax.GetWifi())
+	record.PaxBle = fmt.Sprintf("%d", pax.GetBle())
+	record.PaxUptime = fmt.Sprintf("%d", pax.GetUptime())
+}
+
+// decodeDetectionSensor сохраняет текстовое событие модуля Detection Sensor
+// (например "Motion detected"). Это не чат, поэтому текст идет в отдельную колонку.
+func decodeDetectionSensor(payload []byte, record *CSVRecord) {
+	record.EventType = eventDetection
+	record.DetectionText = strings.TrimSpace(string(payload))
+}
+
+// decodeAlert сохраняет тревожное сообщение ALERT_APP. Прошивка добавляет в текст
+// символ колокольчика (0x07), его убираем и помечаем запись флагом IsAlert.
+func decodeAlert(payload []byte, record *CSVRecord) {
+	record.EventType = eventAlert
+	record.IsAlert = "true"
+	record.TextMessage = strings.TrimSpace(strings.ReplaceAll(string(payload), "\a", ""))
+}
+
+// paxSeriesWriter пишет временной ряд показаний Paxcount в отдельный CSV
+type paxSeriesWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newPaxSeriesWriter(path string) (*paxSeriesWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания файла %s: %w", path, err)
+	}
+
+	writer := csv.NewWriter(file)
+	headers := []string{"Timestamp", "From", "NodeID", "GatewayID", "Wifi", "Ble", "Total", "Uptime"}
+	if err := writer.Write(headers); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ошибка записи заголовков: %w", err)
+	}
+
+	return &paxSeriesWriter{file: file, writer: writer}, nil
+}
+
+// Write добавляет точку ряда, записи других типов пропускаются
+func (w *paxSeriesWriter) Write(record *CSVRecord) error {
+	if record.EventType != eventPaxcount {
+		return nil
+	}
+
+	var wifi, ble int
+	fmt.Sscanf(record.PaxWifi, "%d", &wifi)
+	fmt.Sscanf(record.PaxBle, "%d", &ble)
+
+	return w.writer.Write([]string{
+		record.Timestamp, record.From, NodeIDFromString(record.From), record.GatewayID,
+		record.PaxWifi, record.PaxBle, fmt.Sprintf("%d", wifi+ble), record.PaxUptime,
+	})
+}
+
+func (w *paxSeriesWriter) Close() {
+	w.writer.Flush()
+	w.file.Close()
+}
@@ -0,0 +1,99 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// eventFields - колонки записи, которые заполняют декодеры событий
+type eventFields struct {
+	EventType, IsAlert, TextMessage, DetectionText string
+	PaxWifi, PaxBle, PaxUptime                     string
+}
+
+func TestDecodeEvents(t *testing.T) {
+	pax, err := proto.Marshal(&generated.Paxcount{Wifi: 12, Ble: 30, Uptime: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		portnum generated.PortNum
+		payload []byte
+		want    eventFields
+	}{
+		{
+			name:    "paxcount",
+			portnum: generated.PortNum_PAXCOUNTER_APP,
+			payload: pax,
+			want:    eventFields{EventType: eventPaxcount, PaxWifi: "12", PaxBle: "30", PaxUptime: "3600"},
+		},
+		{
+			name:    "detection sensor",
+			portnum: generated.PortNum_DETECTION_SENSOR_APP,
+			payload: []byte("Motion detected \n"),
+			want:    eventFields{EventType: eventDetection, DetectionText: "Motion detected"},
+		},
+		{
+			name:    "alert with bell",
+			portnum: generated.PortNum_ALERT_APP,
+			payload: []byte("\aSOS у моста"),
+			want:    eventFields{EventType: eventAlert, IsAlert: "true", TextMessage: "SOS у моста"},
+		},
+		{
+			name:    "broken paxcount",
+			portnum: generated.PortNum_PAXCOUNTER_APP,
+			payload: []byte{0xff},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record CSVRecord
+			decodeData(&generated.Data{Portnum: tt.portnum, Payload: tt.payload}, &record)
+			got := eventFields{
+				EventType: record.EventType, IsAlert: record.IsAlert, TextMessage: record.TextMessage,
+				DetectionText: record.DetectionText, PaxWifi: record.PaxWifi, PaxBle: record.PaxBle, PaxUptime: record.PaxUptime,
+			}
+			if got != tt.want {
+				t.Errorf("record = %+v, want %+v", got, tt.want)
+			}
+			if (record.Error != "") != (tt.want.EventType == "") {
+				t.Errorf("error = %q", record.Error)
+			}
+		})
+	}
+}
+
+func TestPaxSeriesWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pax.csv")
+	w, err := newPaxSeriesWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []CSVRecord{
+		{Timestamp: "11.17.2025 12:00:00", From: "287454020", GatewayID: "!9028d008", EventType: eventPaxcount, PaxWifi: "12", PaxBle: "30", PaxUptime: "3600"},
+		{Timestamp: "11.17.2025 12:01:00", From: "287454020", TextMessage: "не Paxcount"},
+	}
+	for i := range records {
+		if err := w.Write(&records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Timestamp,From,NodeID,GatewayID,Wifi,Ble,Total,Uptime\n" +
+		"11.17.2025 12:00:00,287454020,!11223344,!9028d008,12,30,42,3600\n"
+	if got := strings.ReplaceAll(string(data), "\r\n", "\n"); got != want {
+		t.Errorf("pax series =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package decoder
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// Сообщения, которыми кодируется Data.payload для известных portnum
+var payloadMessages = map[generated.PortNum]proto.Message{
+	generated.PortNum_POSITION_APP:         &generated.Position{},
+	generated.PortNum_NODEINFO_APP:         &generated.User{},
+	generated.PortNum_ROUTING_APP:          &generated.Routing{},
+	generated.PortNum_ADMIN_APP:            &generated.AdminMessage{},
+	generated.PortNum_WAYPOINT_APP:         &generated.Waypoint{},
+	generated.PortNum_TELEMETRY_APP:        &generated.Telemetry{},
+	generated.PortNum_TRACEROUTE_APP:       &generated.RouteDiscovery{},
+	generated.PortNum_NEIGHBORINFO_APP:     &generated.NeighborInfo{},
+	generated.PortNum_MAP_REPORT_APP:       &generated.MapReport{},
+	generated.PortNum_PAXCOUNTER_APP:       &generated.Paxcount{},
+	generated.PortNum_ATAK_PLUGIN:          &generated.TAKPacket{},
+	generated.PortNum_REMOTE_HARDWARE_APP:  &generated.HardwareMessage{},
+	generated.PortNum_STORE_FORWARD_APP:    &generated.StoreAndForward{},
+	generated.PortNum_KEY_VERIFICATION_APP: &generated.KeyVerification{},
+}
+
+// ExplainCapture печатает разбор пакета из файла захвата: строки номер line или
+// всех копий пакета с ID packetID (десятичный, 0x... или !...)
+func ExplainCapture(w io.Writer, path, packetID string, line int) error {
+	if packetID == "" && line == 0 {
+		return fmt.Errorf("для файла захвата нужно указать ID пакета или номер строки")
+	}
+
+	var wantID uint64
+	if packetID != "" {
+		var err error
+		wantID, err = parsePacketID(packetID)
+		if err != nil {
+			return fmt.Errorf("неверный ID пакета: %w", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	n, found := 0, 0
+	for scanner.Scan() {
+		n++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if line != 0 {
+			if n == line {
+				ExplainLine(w, text)
+				return nil
+			}
+			continue
+		}
+
+		// Один и тот же пакет может прийти через несколько шлюзов - показываем все копии
+		if id, ok := capturePacketID(text); ok && uint64(id) == wantID {
+			if found > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "Строка %d:\n", n)
+			ExplainLine(w, text)
+			found++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	if found == 0 {
+		return fmt.Errorf("пакет не найден")
+	}
+	return nil
+}
+
+// parsePacketID принимает ID пакета в десятичном виде, как 0x... или !...
+func parsePacketID(s string) (uint64, error) {
+	if hexID, ok := strings.CutPrefix(s, "!"); ok {
+		return strconv.ParseUint(hexID, 16, 32)
+	}
+	return strconv.ParseUint(s, 0, 32)
+}
+
+// capturePacketID извлекает ID пакета из строки захвата без полного декодирования
+func capturePacketID(line string) (uint32, bool) {
+	parts := strings.Split(line, " | ")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	data, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return 0, false
+	}
+	var envelope generated.ServiceEnvelope
+	if err := proto.Unmarshal(data, &envelope); err != nil || envelope.GetPacket() == nil {
+		return 0, false
+	}
+	return envelope.GetPacket().GetId(), true
+}
+
+// ExplainLine печатает для строки захвата "timestamp | topic | hex" дерево полей
+// ServiceEnvelope/MeshPacket/Data и попытки расшифровки
+func ExplainLine(w io.Writer, line string) {
+	parts := strings.Split(line, " | ")
+	if len(parts) != 3 {
+		fmt.Fprintf(w, "Неверный формат строки: ожидается \"timestamp | topic | hex\"\n")
+		return
+	}
+
+	fmt.Fprintf(w, "Время: %s\nТопик: %s\n", parts[0], parts[1])
+	data, err := hex.DecodeString(strings.TrimSpace(parts[2]))
+	if err != nil {
+		fmt.Fprintf(w, "Ошибка декодирования hex: %v\n", err)
+		return
+	}
+
+	var envelope generated.ServiceEnvelope
+	fmt.Fprintf(w, "\nServiceEnvelope (%d байт)\n", len(data))
+	explainMessage(w, data, 0, envelope.ProtoReflect().Descriptor(), "  ")
+
+	if err := proto.Unmarshal(data, &envelope); err != nil {
+		fmt.Fprintf(w, "\nОшибка декодирования ServiceEnvelope: %v\n", err)
+		return
+	}
+	packet := envelope.GetPacket()
+	encrypted := packet.GetEncrypted()
+	if len(encrypted) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nРасшифровка (%d байт, from=%s, id=%d)\n", len(encrypted), nodeIDFromNum(packet.GetFrom()), packet.GetId())
+	if packet.GetPkiEncrypted() {
+		fmt.Fprintf(w, "  PKI шифрование: нужен приватный ключ получателя, попытки не выполняются\n")
+		return
+	}
+
+	nonce := packetNonce(packet)
+	fmt.Fprintf(w, "  nonce: %s\n", hex.EncodeToString(nonce))
+	var decrypted []byte
+	for _, candidate := range channelKeyCandidates() {
+		plain := decryptAESCTR(encrypted, candidate.Key, nonce)
+		var testData generated.Data
+		if err := proto.Unmarshal(plain, &testData); err != nil {
+			fmt.Fprintf(w, "  %-16s не Data: %v\n", candidate.Name, err)
+			continue
+		}
+		fmt.Fprintf(w, "  %-16s OK: portnum=%s, payload %d байт\n", candidate.Name, testData.GetPortnum(), len(testData.GetPayload()))
+		decrypted = plain
+		break
+	}
+
+	if decrypted == nil {
+		fmt.Fprintf(w, "  Ни один из стандартных ключей не подошел\n")
+		return
+	}
+	var decoded generated.Data
+	fmt.Fprintf(w, "\nData (расшифровано, %d байт)\n", len(decrypted))
+	explainMessage(w, decrypted, 0, decoded.ProtoReflect().Descriptor(), "  ")
+}
+
+// explainMessage печатает поля сообщения: [начало:конец) #номер имя (тип провода) = значение.
+// base - смещение data от начала исходного буфера, md - схема (nil для неизвестных вложений).
+func explainMessage(w io.Writer, data []byte, base int, md protoreflect.MessageDescriptor, indent string) {
+	// Для Data тип payload зависит от portnum, поэтому сначала достаем его
+	var payloadMessage proto.Message
+	if md != nil && md.FullName() == "meshtastic.Data" {
+		var d generated.Data
+		if proto.Unmarshal(data, &d) == nil {
+			payloadMessage = payloadMessages[d.GetPortnum()]
+		}
+	}
+
+	for offset := 0; offset < len(data); {
+		num, typ, tagLen := protowire.ConsumeTag(data[offset:])
+		if tagLen < 0 {
+			fmt.Fprintf(w, "%s[%d] ошибка разбора тега: %v\n", indent, base+offset, protowire.ParseError(tagLen))
+			return
+		}
+		valueLen := protowire.ConsumeFieldValue(num, typ, data[offset+tagLen:])
+		if valueLen < 0 {
+			fmt.Fprintf(w, "%s[%d] #%d ошибка разбора значения: %v\n", indent, base+offset, num, protowire.ParseError(valueLen))
+			return
+		}
+
+		start, end := offset, offset+tagLen+valueLen
+		value := data[offset+tagLen : end]
+		offset = end
+
+		var fd protoreflect.FieldDescriptor
+		if md != nil {
+			fd = md.Fields().ByNumber(num)
+		}
+		name := "неизвестное поле"
+		if fd != nil {
+			name = string(fd.Name())
+		}
+
+		prefix := fmt.Sprintf("%s[%d:%d] #%d %s (%s)", indent, base+start, base+end, num, name, wireTypeName(typ))
+
+		// Ключи и пароли не печатаем, как и в сводке админ-сообщений
+		if fd != nil && fd.Kind() != protoreflect.MessageKind && isRedacted(fd.Name()) {
+			fmt.Fprintf(w, "%s = %s\n", prefix, redacted)
+			continue
+		}
+
+		if typ == protowire.BytesType {
+			content, _ := protowire.ConsumeBytes(value)
+			contentBase := base + start + tagLen + (len(value) - len(content))
+
+			switch {
+			case fd != nil && fd.Kind() == protoreflect.MessageKind && !fd.IsMap():
+				fmt.Fprintf(w, "%s %s, %d байт\n", prefix, fd.Message().Name(), len(content))
+				explainMessage(w, content, contentBase, fd.Message(), indent+"  ")
+			case fd != nil && fd.Name() == "payload" && payloadMessage != nil:
+				pmd := payloadMessage.ProtoReflect().Descriptor()
+				fmt.Fprintf(w, "%s %s, %d байт\n", prefix, pmd.Name(), len(content))
+				explainMessage(w, content, contentBase, pmd, indent+"  ")
+			case fd != nil && fd.Kind() == protoreflect.StringKind:
+				fmt.Fprintf(w, "%s = %q\n", prefix, string(content))
+			case fd != nil && fd.IsList() && fd.Kind() != protoreflect.BytesKind:
+				fmt.Fprintf(w, "%s packed = %s\n", prefix, explainPacked(fd, content))
+			case fd == nil && utf8.Valid(content) && isPrintable(content):
+				fmt.Fprintf(w, "%s = %q (строка?)\n", prefix, string(content))
+			default:
+				fmt.Fprintf(w, "%s = %s (%d байт)\n", prefix, hex.EncodeToString(content), len(content))
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "%s = %s\n", prefix, explainScalar(fd, typ, value))
+	}
+}
+
+// explainScalar интерпретирует varint/fixed32/fixed64 значение согласно схеме
+func explainScalar(fd protoreflect.FieldDescriptor, typ protowire.Type, value []byte) string {
+	var raw uint64
+	switch typ {
+	case protowire.VarintType:
+		raw, _ = protowire.ConsumeVarint(value)
+	case protowire.Fixed32Type:
+		v, _ := protowire.ConsumeFixed32(value)
+		raw = uint64(v)
+	case protowire.Fixed64Type:
+		raw, _ = protowire.ConsumeFixed64(value)
+	default:
+		return hex.EncodeToString(value)
+	}
+
+	if fd == nil {
+		return fmt.Sprintf("%d", raw)
+	}
+
+	var result string
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		result = boolToString(raw != 0)
+	case protoreflect.EnumKind:
+		result = fmt.Sprintf("%d", int32(raw))
+		if ev := fd.Enum().Values().ByNumber(protoreflect.EnumNumber(int32(raw))); ev != nil {
+			result = fmt.Sprintf("%s (%d)", ev.Name(), int32(raw))
+		}
+	case protoreflect.Int32Kind, protoreflect.Sfixed32Kind:
+		result = fmt.Sprintf("%d", int32(raw))
+	case protoreflect.Int64Kind, protoreflect.Sfixed64Kind:
+		result = fmt.Sprintf("%d", int64(raw))
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		result = fmt.Sprintf("%d", protowire.DecodeZigZag(raw))
+	case protoreflect.FloatKind:
+		result = fmt.Sprintf("%g", math.Float32frombits(uint32(raw)))
+	case protoreflect.DoubleKind:
+		result = fmt.Sprintf("%g", math.Float64frombits(raw))
+	default:
+		result = fmt.Sprintf("%d", raw)
+	}
+
+	// Для полей с номерами узлов показываем привычный вид !xxxxxxxx
+	switch fd.Name() {
+	case "from", "to", "node_num", "node_id", "dest", "source", "last_sent_by_id":
+		result += " (" + nodeIDFromNum(uint32(raw)) + ")"
+	case "latitude_i", "longitude_i":
+		result += fmt.Sprintf(" (%.7f°)", float64(int32(raw))/1e7)
+	}
+	return result
+}
+
+// explainPacked разбирает упакованный repeated скалярных значений
+func explainPacked(fd protoreflect.FieldDescriptor, content []byte) string {
+	var items []string
+	for len(content) > 0 {
+		var n int
+		var item string
+		switch fd.Kind() {
+		case protoreflect.FloatKind, protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+			if len(content) < 4 {
+				n = -1
+				break
+			}
+			item, n = explainScalar(fd, protowire.Fixed32Type, content[:4]), 4
+		case protoreflect.DoubleKind, protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+			if len(content) < 8 {
+				n = -1
+				break
+			}
+			item, n = explainScalar(fd, protowire.Fixed64Type, content[:8]), 8
+		default:
+			_, n = protowire.ConsumeVarint(content)
+			if n > 0 {
+				item = explainScalar(fd, protowire.VarintType, content[:n])
+			}
+		}
+		if n <= 0 {
+			items = append(items, "<ошибка>")
+			break
+		}
+		items = append(items, item)
+		content = content[n:]
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func wireTypeName(typ protowire.Type) string {
+	switch typ {
+	case protowire.VarintType:
+		return "VARINT"
+	case protowire.Fixed32Type:
+		return "I32"
+	case protowire.Fixed64Type:
+		return "I64"
+	case protowire.BytesType:
+		return "LEN"
+	case protowire.StartGroupType:
+		return "SGROUP"
+	case protowire.EndGroupType:
+		return "EGROUP"
+	default:
+		return fmt.Sprintf("wire %d", typ)
+	}
+}
+
+// isPrintable проверяет, что строка не содержит управляющих символов
+func isPrintable(b []byte) bool {
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
@@ -0,0 +1,37 @@
+package decoder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+func TestExplainMessageRedactsSecrets(t *testing.T) {
+	admin := &generated.AdminMessage{
+		SessionPasskey: []byte{0xaa, 0xbb},
+		PayloadVariant: &generated.AdminMessage_SetConfig{SetConfig: &generated.Config{
+			PayloadVariant: &generated.Config_Security{Security: &generated.Config_SecurityConfig{
+				PrivateKey: []byte{0xde, 0xad, 0xbe, 0xef},
+				PublicKey:  []byte{0x01, 0x02, 0x03, 0x04},
+			}},
+		}},
+	}
+	data, err := proto.Marshal(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	explainMessage(&out, data, 0, admin.ProtoReflect().Descriptor(), "")
+	for _, secret := range []string{"aabb", "deadbeef"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("explain leaks %q:\n%s", secret, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "01020304") || !strings.Contains(out.String(), redacted) {
+		t.Errorf("explain = \n%s, want public key and %s", out.String(), redacted)
+	}
+}
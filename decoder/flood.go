@@ -0,0 +1,300 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// floodNode - узел в дереве ретрансляции одного пакета
+type floodNode struct {
+	Node   string  `json:"node"`
+	Parent string  `json:"parent,omitempty"`
+	Hop    int     `json:"hop"`
+	Offset float64 `json:"offset_seconds"`
+	RxSNR  string  `json:"rx_snr,omitempty"`
+	RxRSSI string  `json:"rx_rssi,omitempty"`
+	// Gateway - узел сам выгрузил копию пакета в MQTT
+	Gateway bool `json:"gateway"`
+	// Inferred - связь с родителем угадана: relay_node не задан, не найден среди известных узлов
+	// или последнему байту соответствует несколько узлов
+	Inferred bool `json:"inferred,omitempty"`
+}
+
+// floodTree - вероятное дерево ретрансляции пакета
+type floodTree struct {
+	PacketID    string       `json:"packet_id"`
+	From        string       `json:"from"`
+	FirstSeen   string       `json:"first_seen"`
+	PortnumName string       `json:"portnum,omitempty"`
+	Nodes       []*floodNode `json:"nodes"`
+}
+
+// relayStats - сколько пакетов узел ретранслировал за весь захват
+type relayStats struct {
+	Node           string `json:"node"`
+	PacketsRelayed int    `json:"packets_relayed"`
+	Origins        int    `json:"distinct_origins"`
+	Receivers      int    `json:"receivers"`
+
+	origins map[string]bool
+}
+
+// floodAnalysis - результат реконструкции для всего захвата
+type floodAnalysis struct {
+	Packets []*floodTree  `json:"packets"`
+	Relays  []*relayStats `json:"relays"`
+}
+
+// analyzeFlood восстанавливает деревья ретрансляции по копиям пакетов от разных шлюзов.
+//
+// Для каждой копии известны hop_start - hop_limit (сколько прыжков пакет прошел до шлюза)
+// и relay_node - последний байт номера узла, от которого шлюз услышал пакет. Родителем
+// шлюза считаем узел с таким последним байтом, который сам находится на прыжок ближе
+// к отправителю: сначала среди шлюзов этого же пакета, затем среди всех узлов захвата.
+func analyzeFlood(packets []*logicalPacket) *floodAnalysis {
+	known := make(map[string]bool)
+	for _, p := range packets {
+		known[p.FromID] = true
+		for _, c := range p.Copies {
+			known[c.GatewayID] = true
+		}
+	}
+
+	analysis := &floodAnalysis{}
+	relays := make(map[string]*relayStats)
+
+	for _, p := range packets {
+		tree := buildFloodTree(p, known)
+		if len(tree.Nodes) < 2 {
+			// Пакет выгрузил в MQTT только сам отправитель - распространять нечего
+			continue
+		}
+		analysis.Packets = append(analysis.Packets, tree)
+
+		children := make(map[string]int)
+		for _, n := range tree.Nodes {
+			if n.Parent != "" {
+				children[n.Parent]++
+			}
+		}
+		for node, count := range children {
+			if node == tree.From {
+				continue
+			}
+			stats, ok := relays[node]
+			if !ok {
+				stats = &relayStats{Node: node, origins: make(map[string]bool)}
+				relays[node] = stats
+			}
+			stats.PacketsRelayed++
+			stats.Receivers += count
+			stats.origins[tree.From] = true
+		}
+	}
+
+	for _, stats := range relays {
+		stats.Origins = len(stats.origins)
+		analysis.Relays = append(analysis.Relays, stats)
+	}
+	sort.Slice(analysis.Relays, func(i, j int) bool {
+		if analysis.Relays[i].PacketsRelayed != analysis.Relays[j].PacketsRelayed {
+			return analysis.Relays[i].PacketsRelayed > analysis.Relays[j].PacketsRelayed
+		}
+		return analysis.Relays[i].Node < analysis.Relays[j].Node
+	})
+	return analysis
+}
+
+func buildFloodTree(p *logicalPacket, known map[string]bool) *floodTree {
+	tree := &floodTree{
+		PacketID:    p.PacketID,
+		From:        p.FromID,
+		FirstSeen:   p.FirstSeen,
+		PortnumName: p.PortnumName,
+	}
+	nodes := map[string]*floodNode{p.FromID: {Node: p.FromID}}
+	tree.Nodes = append(tree.Nodes, nodes[p.FromID])
+
+	// Копии с меньшим числом прыжков обрабатываем первыми, чтобы ретрансляторы уже были в дереве
+	copies := append([]packetCopy(nil), p.Copies...)
+	sort.SliceStable(copies, func(i, j int) bool {
+		return hopsOf(copies[i]) < hopsOf(copies[j])
+	})
+
+	for _, c := range copies {
+		if c.GatewayID == p.FromID {
+			nodes[p.FromID].Gateway = true
+			continue
+		}
+		if existing, ok := nodes[c.GatewayID]; ok {
+			existing.Gateway = true
+			continue
+		}
+
+		hops := hopsOf(c)
+		node := &floodNode{
+			Node:    c.GatewayID,
+			Hop:     hops,
+			Offset:  c.Offset,
+			RxSNR:   c.RxSNR,
+			RxRSSI:  c.RxRSSI,
+			Gateway: true,
+		}
+
+		switch {
+		case hops <= 0:
+			node.Parent = p.FromID
+			node.Inferred = hops < 0
+			if hops < 0 {
+				node.Hop = 1
+			}
+		default:
+			parent, ambiguous := findRelay(c.RelayNode, hops-1, c.GatewayID, nodes, known)
+			if parent == "" {
+				// Ретранслятор неизвестен - связываем с отправителем
+				node.Parent = p.FromID
+				node.Inferred = true
+				break
+			}
+			node.Parent = parent
+			node.Inferred = ambiguous
+			if _, ok := nodes[parent]; !ok {
+				relay := &floodNode{Node: parent, Hop: hops - 1, Parent: p.FromID, Inferred: hops-1 > 0}
+				nodes[parent] = relay
+				tree.Nodes = append(tree.Nodes, relay)
+			}
+		}
+
+		nodes[c.GatewayID] = node
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	return tree
+}
+
+// findRelay ищет узел с заданным последним байтом номера. Возвращает "" если relay_node не задан,
+// и "?xx" если подходящий узел не встречался в захвате. Из нескольких подходящих узлов выбирается
+// наименьший номер, а ambiguous сообщает, что выбор неоднозначен.
+func findRelay(relayByte string, hop int, receiver string, nodes map[string]*floodNode, known map[string]bool) (relay string, ambiguous bool) {
+	if relayByte == "" {
+		return "", false
+	}
+
+	// Узел этого же дерева на предыдущем прыжке - самый вероятный ретранслятор
+	var candidates []string
+	for id, n := range nodes {
+		if n.Hop == hop && nodeLastByte(id) == relayByte && id != receiver {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		for id := range known {
+			if nodeLastByte(id) == relayByte && id != receiver {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "?" + relayByte, false
+	}
+	sort.Strings(candidates)
+	return candidates[0], len(candidates) > 1
+}
+
+// nodeLastByte возвращает последний байт номера узла "!xxxxxxxx" в виде двух hex цифр
+func nodeLastByte(id string) string {
+	if len(id) < 2 || !strings.HasPrefix(id, "!") {
+		return ""
+	}
+	return id[len(id)-2:]
+}
+
+func hopsOf(c packetCopy) int {
+	hops, err := strconv.Atoi(c.HopsAway)
+	if err != nil {
+		return -1
+	}
+	return hops
+}
+
+// Write пишет деревья в DOT (расширение .dot/.gv) или JSON, а статистику
+// ретрансляторов - в <path>_relays.csv
+func (a *floodAnalysis) Write(path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".dot" || ext == ".gv" {
+		if err := os.WriteFile(path, []byte(a.dot()), 0644); err != nil {
+			return fmt.Errorf("ошибка записи %s: %w", path, err)
+		}
+	} else {
+		data, err := json.MarshalIndent(a, "", "  ")
+		if err != nil {
+			return fmt.Errorf("ошибка формирования JSON: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("ошибка записи %s: %w", path, err)
+		}
+	}
+
+	rows := [][]string{{"Node", "PacketsRelayed", "DistinctOrigins", "Receivers"}}
+	for _, r := range a.Relays {
+		rows = append(rows, []string{r.Node, fmt.Sprintf("%d", r.PacketsRelayed),
+			fmt.Sprintf("%d", r.Origins), fmt.Sprintf("%d", r.Receivers)})
+	}
+	return writeCSVFile(strings.TrimSuffix(path, filepath.Ext(path))+"_relays.csv", rows)
+}
+
+// dot формирует граф Graphviz: по одному кластеру на пакет
+func (a *floodAnalysis) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph flood {\n  rankdir=LR;\n  node [fontname=\"monospace\"];\n")
+	for _, t := range a.Packets {
+		fmt.Fprintf(&b, "  subgraph \"cluster_%s\" {\n", t.PacketID)
+		fmt.Fprintf(&b, "    label=%q;\n", fmt.Sprintf("%s id=%s %s %s", t.From, t.PacketID, t.PortnumName, t.FirstSeen))
+		for _, n := range t.Nodes {
+			label := n.Node
+			if n.Parent == "" {
+				label += "\\nотправитель"
+			} else {
+				label += fmt.Sprintf("\\nhop %d", n.Hop)
+			}
+			if n.RxSNR != "" {
+				label += fmt.Sprintf("\\nsnr %s rssi %s", n.RxSNR, n.RxRSSI)
+			}
+			shape := "ellipse"
+			if n.Gateway {
+				shape = "box"
+			}
+			fmt.Fprintf(&b, "    \"%s_%s\" [label=\"%s\", shape=%s];\n", t.PacketID, n.Node, label, shape)
+		}
+		for _, n := range t.Nodes {
+			if n.Parent == "" {
+				continue
+			}
+			style := "solid"
+			if n.Inferred {
+				style = "dashed"
+			}
+			fmt.Fprintf(&b, "    \"%s_%s\" -> \"%s_%s\" [label=\"%+.0fs\", style=%s];\n",
+				t.PacketID, n.Parent, t.PacketID, n.Node, n.Offset, style)
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// PrintSummary выводит самых загруженных ретрансляторов
+func (a *floodAnalysis) PrintSummary() {
+	fmt.Printf("Восстановлено деревьев ретрансляции: %d\n", len(a.Packets))
+	for i, r := range a.Relays {
+		if i == 10 {
+			break
+		}
+		fmt.Printf("  ретранслятор %s: пакетов %d, отправителей %d, получателей %d\n",
+			r.Node, r.PacketsRelayed, r.Origins, r.Receivers)
+	}
+}
@@ -0,0 +1,37 @@
+package decoder
+
+import "testing"
+
+func TestFindRelay(t *testing.T) {
+	nodes := map[string]*floodNode{
+		"!000000aa": {Node: "!000000aa", Hop: 1},
+		"!100000aa": {Node: "!100000aa", Hop: 1},
+		"!000000bb": {Node: "!000000bb", Hop: 1},
+		"!000000cc": {Node: "!000000cc", Hop: 2},
+	}
+	known := map[string]bool{"!200000cc": true, "!300000dd": true, "!400000dd": true}
+	tests := []struct {
+		name      string
+		relayByte string
+		hop       int
+		relay     string
+		ambiguous bool
+	}{
+		{name: "not set", relayByte: "", hop: 1, relay: ""},
+		{name: "single in tree", relayByte: "bb", hop: 1, relay: "!000000bb"},
+		{name: "several in tree", relayByte: "aa", hop: 1, relay: "!000000aa", ambiguous: true},
+		{name: "other hop falls back to known", relayByte: "cc", hop: 1, relay: "!200000cc"},
+		{name: "several known", relayByte: "dd", hop: 1, relay: "!300000dd", ambiguous: true},
+		{name: "unknown", relayByte: "ee", hop: 1, relay: "?ee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				relay, ambiguous := findRelay(tt.relayByte, tt.hop, "!00000001", nodes, known)
+				if relay != tt.relay || ambiguous != tt.ambiguous {
+					t.Fatalf("findRelay = %q, %v, want %q, %v", relay, ambiguous, tt.relay, tt.ambiguous)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Средний радиус Земли в метрах
+const earthRadius = 6371000.0
+
+// Структуры GeoJSON (RFC 7946)
+type geoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+type geoFeature struct {
+	Type       string         `json:"type"`
+	Geometry   geoGeometry    `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geoGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func newFeatureCollection() *geoFeatureCollection {
+	return &geoFeatureCollection{Type: "FeatureCollection", Features: []geoFeature{}}
+}
+
+// Add добавляет объект с геометрией заданного типа
+func (c *geoFeatureCollection) Add(geometry string, coordinates any, properties map[string]any) {
+	c.Features = append(c.Features, geoFeature{
+		Type:       "Feature",
+		Geometry:   geoGeometry{Type: geometry, Coordinates: coordinates},
+		Properties: properties,
+	})
+}
+
+// WriteFile записывает коллекцию в файл с отступами
+func (c *geoFeatureCollection) WriteFile(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка формирования GeoJSON: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи %s: %w", path, err)
+	}
+	return nil
+}
+
+// precisionCell возвращает центр ячейки округления координат и ее радиус в метрах
+// (половина диагонали). precision_bits 0 или 32 означает отсутствие округления.
+func precisionCell(latI, lonI int32, precisionBits uint32) (lat, lon, radius float64) {
+	if precisionBits == 0 || precisionBits >= 32 {
+		return float64(latI) / 1e7, float64(lonI) / 1e7, 0
+	}
+	mask := uint32(0xFFFFFFFF) << (32 - precisionBits)
+	half := int64(1) << (31 - precisionBits)
+	// Новые прошивки сами сдвигают точку в центр ячейки, старые оставляют угол - маска дает угол в обоих случаях
+	latCenter := int64(int32(uint32(latI)&mask)) + half
+	lonCenter := int64(int32(uint32(lonI)&mask)) + half
+	lat, lon = float64(latCenter)/1e7, float64(lonCenter)/1e7
+
+	size := float64(half) * 2 / 1e7
+	dLat := size * math.Pi / 180 * earthRadius
+	dLon := dLat * math.Cos(lat*math.Pi/180)
+	return lat, lon, math.Hypot(dLat, dLon) / 2
+}
+
+// geoPosition - координаты узла с радиусом неопределенности
+type geoPosition struct {
+	Lat, Lon float64
+	// Uncertainty - радиус неопределенности в метрах, 0 для точной позиции
+	Uncertainty float64
+}
+
+// recordPosition возвращает позицию отправителя из записи. Координаты метки
+// WAYPOINT_APP позицией узла не являются и пропускаются.
+func recordPosition(record *CSVRecord) (geoPosition, bool) {
+	if record.WaypointID != "" {
+		return geoPosition{}, false
+	}
+	lat, errLat := strconv.ParseFloat(record.Latitude, 64)
+	lon, errLon := strconv.ParseFloat(record.Longitude, 64)
+	if errLat != nil || errLon != nil {
+		return geoPosition{}, false
+	}
+	uncertainty, _ := strconv.ParseFloat(record.PositionUncertainty, 64)
+	return geoPosition{Lat: lat, Lon: lon, Uncertainty: uncertainty}, true
+}
+
+// DistanceTo возвращает расстояние до другой позиции и его погрешность (сумма радиусов)
+func (p geoPosition) DistanceTo(other geoPosition) (distance, uncertainty float64) {
+	return distanceMeters(p.Lat, p.Lon, other.Lat, other.Lon), p.Uncertainty + other.Uncertainty
+}
+
+// distanceMeters возвращает расстояние по дуге большого круга (формула гаверсинусов)
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// bearingDegrees возвращает начальный азимут от первой точки ко второй (0-360, от севера)
+func bearingDegrees(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// destinationPoint возвращает точку на расстоянии distance метров по азимуту bearing градусов
+func destinationPoint(lat, lon, bearing, distance float64) (float64, float64) {
+	phi1, lambda1 := lat*math.Pi/180, lon*math.Pi/180
+	theta := bearing * math.Pi / 180
+	delta := distance / earthRadius
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1),
+		math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return phi2 * 180 / math.Pi, lambda2 * 180 / math.Pi
+}
+
+// circlePolygon аппроксимирует круг многоугольником для GeoJSON: [[[lon, lat], ...]]
+func circlePolygon(lat, lon, radius float64, segments int) [][][]float64 {
+	ring := make([][]float64, 0, segments+1)
+	for i := 0; i < segments; i++ {
+		pLat, pLon := destinationPoint(lat, lon, float64(i)*360/float64(segments), radius)
+		ring = append(ring, []float64{pLon, pLat})
+	}
+	ring = append(ring, ring[0])
+	return [][][]float64{ring}
+}
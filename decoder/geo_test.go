@@ -0,0 +1,31 @@
+package decoder
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPrecisionCell(t *testing.T) {
+	tests := []struct {
+		name          string
+		latI, lonI    int32
+		bits          uint32
+		lat, lon, rad float64
+	}{
+		{name: "no rounding", latI: 645432100, lonI: 405123400, bits: 0, lat: 64.54321, lon: 40.51234},
+		{name: "full precision", latI: 645432100, lonI: 405123400, bits: 32, lat: 64.54321, lon: 40.51234},
+		{name: "13 bits", latI: 645432100, lonI: 405123400, bits: 13, lat: 64.5660672, lon: 40.501248, rad: 3172},
+		// Старые прошивки присылают угол ячейки, новые - центр: результат один
+		{name: "13 bits corner", latI: 645432100 &^ 0x7ffff, lonI: 405123400 &^ 0x7ffff, bits: 13, lat: 64.5660672, lon: 40.501248, rad: 3172},
+		{name: "13 bits center", latI: 645432100&^0x7ffff | 0x40000, lonI: 405123400&^0x7ffff | 0x40000, bits: 13, lat: 64.5660672, lon: 40.501248, rad: 3172},
+		{name: "southern hemisphere", latI: -335123400, lonI: -705432100, bits: 16, lat: -33.5118336, lon: -70.5462272, rad: 474},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, radius := precisionCell(tt.latI, tt.lonI, tt.bits)
+			if math.Abs(lat-tt.lat) > 1e-7 || math.Abs(lon-tt.lon) > 1e-7 || math.Abs(radius-tt.rad) > 1 {
+				t.Errorf("precisionCell = %.7f, %.7f ±%.0f, want %.7f, %.7f ±%.0f", lat, lon, radius, tt.lat, tt.lon, tt.rad)
+			}
+		})
+	}
+}
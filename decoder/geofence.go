@@ -0,0 +1,290 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Виды событий геозоны
+const (
+	GeofenceEnter = "enter"
+	GeofenceExit  = "exit"
+)
+
+// Сколько последних событий трекер держит для сводки
+const geofenceRecentEvents = 10
+
+// geofence - зона из GeoJSON: полигоны (Polygon, MultiPolygon) или круг
+// (Point со свойством radius в метрах)
+type geofence struct {
+	Name string
+	// polygons - полигон -> кольцо -> точка [lon, lat]; первое кольцо внешнее, остальные - дыры
+	polygons [][][][2]float64
+	center   *geoPosition
+	radius   float64
+	// hysteresis - собственный запас зоны (свойство hysteresis), иначе общий
+	hysteresis float64
+}
+
+// Distance возвращает расстояние в метрах от точки до границы зоны:
+// положительное внутри зоны, отрицательное снаружи
+func (f *geofence) Distance(lat, lon float64) float64 {
+	if f.center != nil {
+		return f.radius - distanceMeters(f.center.Lat, f.center.Lon, lat, lon)
+	}
+
+	inside := false
+	nearest := math.Inf(1)
+	for _, polygon := range f.polygons {
+		in := false
+		for i, ring := range polygon {
+			if pointInRing(ring, lat, lon) {
+				// Попадание во внешнее кольцо - внутри, в дыру - снова снаружи
+				in = i == 0 || !in
+			}
+			nearest = min(nearest, distanceToRing(ring, lat, lon))
+		}
+		inside = inside || in
+	}
+	if inside {
+		return nearest
+	}
+	return -nearest
+}
+
+// pointInRing - проверка попадания точки в кольцо методом трассировки луча
+func pointInRing(ring [][2]float64, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// distanceToRing возвращает расстояние от точки до ближайшего ребра кольца в метрах.
+// Ребра проецируются на локальную плоскость вокруг точки, для зон размером в десятки
+// километров этого достаточно.
+func distanceToRing(ring [][2]float64, lat, lon float64) float64 {
+	scaleY := math.Pi / 180 * earthRadius
+	scaleX := scaleY * math.Cos(lat*math.Pi/180)
+	project := func(p [2]float64) (float64, float64) {
+		return (p[0] - lon) * scaleX, (p[1] - lat) * scaleY
+	}
+
+	nearest := math.Inf(1)
+	for i := 0; i+1 < len(ring); i++ {
+		ax, ay := project(ring[i])
+		bx, by := project(ring[i+1])
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if length := dx*dx + dy*dy; length > 0 {
+			t = max(0, min(1, -(ax*dx+ay*dy)/length))
+		}
+		nearest = min(nearest, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	return nearest
+}
+
+// GeofenceEvent - вход узла в зону или выход из нее
+type GeofenceEvent struct {
+	Time  time.Time
+	Node  string
+	Name  string
+	Fence string
+	Kind  string
+	Lat   float64
+	Lon   float64
+	// Uncertainty - радиус неопределенности позиции, м
+	Uncertainty float64
+	// Distance - расстояние до границы, м (положительное внутри)
+	Distance float64
+}
+
+func (e GeofenceEvent) String() string {
+	text := fmt.Sprintf("%s %s", e.Time.Format(time.DateTime), e.Node)
+	if e.Name != "" {
+		text += " (" + e.Name + ")"
+	}
+	action := "вошел в зону"
+	if e.Kind == GeofenceExit {
+		action = "вышел из зоны"
+	}
+	return fmt.Sprintf("%s %s %s: %.5f, %.5f ±%.0f м, %.0f м от границы",
+		text, action, e.Fence, e.Lat, e.Lon, e.Uncertainty, math.Abs(e.Distance))
+}
+
+// GeofenceTracker следит за положением узлов относительно зон. Переход фиксируется,
+// только когда вся область неопределенности позиции (радиус ячейки precision_bits)
+// плюс запас hysteresis лежит по другую сторону границы, поэтому грубые позиции
+// и колебания у самой границы событий не дают. Первая позиция внутри зоны дает
+// вход, первая позиция снаружи только запоминается.
+type GeofenceTracker struct {
+	fences     []*geofence
+	hysteresis float64
+	inside     map[string]bool
+	names      map[string]string
+	total      int
+	recent     []GeofenceEvent
+}
+
+// LoadGeofences читает зоны из GeoJSON файла. Имя зоны берется из свойства name
+// (или id), hysteresis - запас в метрах по умолчанию для зон без одноименного свойства.
+func LoadGeofences(path string, hysteresis float64) (*GeofenceTracker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %w", path, err)
+	}
+
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %w", path, err)
+	}
+
+	t := &GeofenceTracker{
+		hysteresis: hysteresis,
+		inside:     make(map[string]bool),
+		names:      make(map[string]string),
+	}
+	for i, feature := range collection.Features {
+		fence := &geofence{Name: fmt.Sprintf("zone%d", i+1), hysteresis: -1}
+		if name, ok := feature.Properties["name"].(string); ok && name != "" {
+			fence.Name = name
+		} else if id, ok := feature.Properties["id"]; ok {
+			fence.Name = fmt.Sprint(id)
+		}
+		if h, ok := feature.Properties["hysteresis"].(float64); ok {
+			fence.hysteresis = h
+		}
+
+		coords := feature.Geometry.Coordinates
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var polygon [][][2]float64
+			err = json.Unmarshal(coords, &polygon)
+			fence.polygons = [][][][2]float64{polygon}
+		case "MultiPolygon":
+			err = json.Unmarshal(coords, &fence.polygons)
+		case "Point":
+			var point [2]float64
+			err = json.Unmarshal(coords, &point)
+			radius, ok := feature.Properties["radius"].(float64)
+			if err == nil && (!ok || radius <= 0) {
+				err = fmt.Errorf("у точки нет свойства radius (метры)")
+			}
+			fence.center = &geoPosition{Lat: point[1], Lon: point[0]}
+			fence.radius = radius
+		default:
+			err = fmt.Errorf("геометрия %s не поддерживается", feature.Geometry.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("зона %s: %w", fence.Name, err)
+		}
+		t.fences = append(t.fences, fence)
+	}
+	if len(t.fences) == 0 {
+		return nil, fmt.Errorf("в %s нет зон", path)
+	}
+	return t, nil
+}
+
+// Observe проверяет позицию из записи, дописывает события в колонку GeofenceEvents
+// и возвращает их. Повторные копии пакета новых событий не дают.
+func (t *GeofenceTracker) Observe(record *CSVRecord) []GeofenceEvent {
+	if record.From == "" {
+		return nil
+	}
+	node := NodeIDFromString(record.From)
+	if record.UserLongName != "" {
+		t.names[node] = record.UserLongName
+	} else if record.MapLongName != "" && t.names[node] == "" {
+		t.names[node] = record.MapLongName
+	}
+
+	pos, ok := recordPosition(record)
+	if !ok {
+		return nil
+	}
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		return nil
+	}
+
+	var events []GeofenceEvent
+	for _, fence := range t.fences {
+		hysteresis := t.hysteresis
+		if fence.hysteresis >= 0 {
+			hysteresis = fence.hysteresis
+		}
+		margin := pos.Uncertainty + hysteresis
+		distance := fence.Distance(pos.Lat, pos.Lon)
+
+		key := node + "|" + fence.Name
+		inside, known := t.inside[key]
+		var kind string
+		switch {
+		case distance >= margin && !inside:
+			kind = GeofenceEnter
+		case distance <= -margin && inside:
+			kind = GeofenceExit
+		case distance <= -margin && !known:
+			t.inside[key] = false
+		}
+		if kind == "" {
+			continue
+		}
+		t.inside[key] = kind == GeofenceEnter
+		events = append(events, GeofenceEvent{
+			Time: at, Node: node, Name: t.names[node], Fence: fence.Name, Kind: kind,
+			Lat: pos.Lat, Lon: pos.Lon, Uncertainty: pos.Uncertainty, Distance: distance,
+		})
+	}
+
+	if len(events) > 0 {
+		parts := make([]string, len(events))
+		for i, e := range events {
+			parts[i] = e.Kind + ":" + e.Fence
+		}
+		record.GeofenceEvents = strings.Join(parts, ";")
+		t.total += len(events)
+		t.recent = append(t.recent, events...)
+		if len(t.recent) > geofenceRecentEvents {
+			t.recent = append([]GeofenceEvent(nil), t.recent[len(t.recent)-geofenceRecentEvents:]...)
+		}
+	}
+	return events
+}
+
+func (t *GeofenceTracker) PrintSummary() {
+	fmt.Printf("Геозоны: %d зон, %d событий входа/выхода\n", len(t.fences), t.total)
+	for _, fence := range t.fences {
+		var nodes []string
+		for key, inside := range t.inside {
+			node, name, _ := strings.Cut(key, "|")
+			if inside && name == fence.Name {
+				nodes = append(nodes, node)
+			}
+		}
+		sort.Strings(nodes)
+		fmt.Printf("  %s: внутри %d %s\n", fence.Name, len(nodes), strings.Join(nodes, " "))
+	}
+	for _, e := range t.recent {
+		fmt.Printf("  %s\n", e)
+	}
+}
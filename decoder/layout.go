@@ -0,0 +1,145 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// layoutField - одно поле описания раскладки "имя:тип[/делитель]"
+type layoutField struct {
+	Name    string
+	Type    string
+	Size    int
+	Order   binary.ByteOrder
+	Divisor float64
+}
+
+// layoutDecoder разбирает payload фиксированной бинарной раскладки.
+//
+// Типы: u8 i8 u16 i16 u32 i32 u64 i64 f32 f64 bool - числа little-endian,
+// суффикс "be" меняет порядок байт (u16be). str и hex забирают остаток payload.
+// Делитель переводит сырое целое в единицы измерения: temp:i16/10.
+type layoutDecoder struct {
+	name   string
+	fields []layoutField
+}
+
+var layoutTypeSizes = map[string]int{
+	"u8": 1, "i8": 1, "bool": 1,
+	"u16": 2, "i16": 2,
+	"u32": 4, "i32": 4, "f32": 4,
+	"u64": 8, "i64": 8, "f64": 8,
+	"str": 0, "hex": 0,
+}
+
+func newLayoutDecoder(name, layout string) (*layoutDecoder, error) {
+	decoder := &layoutDecoder{name: name}
+
+	specs := strings.Fields(layout)
+	for i, spec := range specs {
+		fieldName, typ, ok := strings.Cut(spec, ":")
+		if !ok || fieldName == "" {
+			return nil, fmt.Errorf("неверное поле %q, ожидается имя:тип", spec)
+		}
+
+		field := layoutField{Name: fieldName, Order: binary.LittleEndian, Divisor: 1}
+		if t, div, ok := strings.Cut(typ, "/"); ok {
+			d, err := strconv.ParseFloat(div, 64)
+			if err != nil || d == 0 {
+				return nil, fmt.Errorf("неверный делитель в поле %q", spec)
+			}
+			typ, field.Divisor = t, d
+		}
+		if t, ok := strings.CutSuffix(typ, "be"); ok {
+			typ, field.Order = t, binary.BigEndian
+		} else {
+			typ = strings.TrimSuffix(typ, "le")
+		}
+
+		size, ok := layoutTypeSizes[typ]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный тип %q в поле %q", typ, spec)
+		}
+		if size == 0 && i != len(specs)-1 {
+			return nil, fmt.Errorf("поле %q типа %s должно быть последним", fieldName, typ)
+		}
+		field.Type, field.Size = typ, size
+		decoder.fields = append(decoder.fields, field)
+	}
+
+	if len(decoder.fields) == 0 {
+		return nil, fmt.Errorf("пустое описание раскладки")
+	}
+	return decoder, nil
+}
+
+func (d *layoutDecoder) Name() string {
+	return d.name
+}
+
+func (d *layoutDecoder) Decode(payload []byte, record *CSVRecord) error {
+	var values []string
+	offset := 0
+
+	for _, f := range d.fields {
+		if f.Size == 0 {
+			rest := payload[offset:]
+			if f.Type == "str" {
+				values = append(values, fmt.Sprintf("%s=%q", f.Name, string(rest)))
+			} else {
+				values = append(values, f.Name+"="+hex.EncodeToString(rest))
+			}
+			offset = len(payload)
+			break
+		}
+
+		if offset+f.Size > len(payload) {
+			record.CustomValues = strings.Join(values, " ")
+			return fmt.Errorf("payload короче раскладки: поле %s на смещении %d", f.Name, offset)
+		}
+		raw := payload[offset : offset+f.Size]
+		offset += f.Size
+
+		var v float64
+		switch f.Type {
+		case "u8", "bool":
+			v = float64(raw[0])
+		case "i8":
+			v = float64(int8(raw[0]))
+		case "u16":
+			v = float64(f.Order.Uint16(raw))
+		case "i16":
+			v = float64(int16(f.Order.Uint16(raw)))
+		case "u32":
+			v = float64(f.Order.Uint32(raw))
+		case "i32":
+			v = float64(int32(f.Order.Uint32(raw)))
+		case "u64":
+			v = float64(f.Order.Uint64(raw))
+		case "i64":
+			v = float64(int64(f.Order.Uint64(raw)))
+		case "f32":
+			v = float64(math.Float32frombits(f.Order.Uint32(raw)))
+		case "f64":
+			v = math.Float64frombits(f.Order.Uint64(raw))
+		}
+
+		if f.Type == "bool" {
+			values = append(values, f.Name+"="+boolToString(v != 0))
+			continue
+		}
+		v /= f.Divisor
+		record.addMetric(d.name+"_"+f.Name, v)
+		values = append(values, f.Name+"="+strconv.FormatFloat(v, 'f', -1, 64))
+	}
+
+	record.CustomValues = strings.Join(values, " ")
+	if offset < len(payload) {
+		return fmt.Errorf("лишние %d байт после раскладки", len(payload)-offset)
+	}
+	return nil
+}
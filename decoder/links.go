@@ -0,0 +1,124 @@
+package decoder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// Источники сведений о радиосвязи между узлами
+const (
+	linkNeighborInfo = "neighborinfo"
+	linkTraceroute   = "traceroute"
+	linkDirect       = "direct"
+)
+
+// nodeLink - наблюдаемая радиосвязь между двумя узлами ("!xxxxxxxx")
+type nodeLink struct {
+	From   string
+	To     string
+	SNR    string
+	Source string
+}
+
+// addLink добавляет к записи наблюдаемую связь для построения топологии
+func (r *CSVRecord) addLink(from, to uint32, snr string, source string) {
+	if from == to || from == 0 || to == 0 || to == 0xffffffff {
+		return
+	}
+	r.links = append(r.links, nodeLink{From: nodeIDFromNum(from), To: nodeIDFromNum(to), SNR: snr, Source: source})
+}
+
+// decodeNeighborInfo разбирает список соседей NEIGHBORINFO_APP
+func decodeNeighborInfo(payload []byte, record *CSVRecord) {
+	var info generated.NeighborInfo
+	if err := proto.Unmarshal(payload, &info); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования NeighborInfo: %v", err)
+		return
+	}
+
+	var neighbors []string
+	for _, n := range info.GetNeighbors() {
+		snr := fmt.Sprintf("%.2f", n.GetSnr())
+		neighbors = append(neighbors, fmt.Sprintf("%s snr=%s", nodeIDFromNum(n.GetNodeId()), snr))
+		// Сосед слышит узел, отправивший NeighborInfo, с указанным SNR
+		record.addLink(n.GetNodeId(), info.GetNodeId(), snr, linkNeighborInfo)
+	}
+	record.Neighbors = strings.Join(neighbors, "; ")
+}
+
+// Значение SNR, означающее "неизвестно" в RouteDiscovery (INT8_MIN)
+const routeSNRUnknown = -128
+
+// decodeTraceroute разбирает маршрут TRACEROUTE_APP.
+//
+// В ответе (есть request_id) пакет идет от цели к инициатору: прямой путь
+// to -> route... -> from, обратный from -> route_back... -> to.
+// В запросе route содержит узлы, через которые запрос уже прошел от from.
+func decodeTraceroute(payload []byte, record *CSVRecord) {
+	var route generated.RouteDiscovery
+	if err := proto.Unmarshal(payload, &route); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования RouteDiscovery: %v", err)
+		return
+	}
+
+	from, to := parseNodeNum(record.From), parseNodeNum(record.To)
+	requestID := parseNodeNum(record.RequestID)
+
+	var towards []uint32
+	if requestID != 0 {
+		towards = append(append([]uint32{to}, route.GetRoute()...), from)
+	} else {
+		towards = append([]uint32{from}, route.GetRoute()...)
+	}
+	record.TraceRoute = formatRoute(towards, route.GetSnrTowards())
+	addRouteLinks(record, towards, route.GetSnrTowards())
+
+	if requestID != 0 && (len(route.GetRouteBack()) > 0 || len(route.GetSnrBack()) > 0) {
+		back := append(append([]uint32{from}, route.GetRouteBack()...), to)
+		record.TraceRouteBack = formatRoute(back, route.GetSnrBack())
+		addRouteLinks(record, back, route.GetSnrBack())
+	}
+}
+
+// formatRoute выводит маршрут как "!a > !b (6.25dB) > !c (-3.00dB)"
+func formatRoute(path []uint32, snrs []int32) string {
+	parts := make([]string, len(path))
+	for i, node := range path {
+		parts[i] = nodeIDFromNum(node)
+		if i > 0 {
+			if snr := routeSNR(snrs, i-1); snr != "" {
+				parts[i] += " (" + snr + "dB)"
+			}
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+// addRouteLinks добавляет связи между соседними узлами маршрута
+func addRouteLinks(record *CSVRecord, path []uint32, snrs []int32) {
+	for i := 1; i < len(path); i++ {
+		record.addLink(path[i-1], path[i], routeSNR(snrs, i-1), linkTraceroute)
+	}
+}
+
+// parseNodeNum разбирает десятичный номер из колонок From/To/RequestID, 0 если пусто
+func parseNodeNum(s string) uint32 {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(n)
+}
+
+// routeSNR возвращает SNR i-го прыжка: прошивка передает его умноженным на 4
+func routeSNR(snrs []int32, i int) string {
+	if i >= len(snrs) || snrs[i] == routeSNRUnknown {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", float64(snrs[i])/4)
+}
@@ -0,0 +1,150 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// loraRegion - частотный диапазон региона Meshtastic и его ограничения
+type loraRegion struct {
+	FreqStart float64 // МГц
+	FreqEnd   float64 // МГц
+	// DutyCycle - допустимая доля времени в эфире, %
+	DutyCycle float64
+	// PowerLimit - максимальная мощность передатчика, дБм
+	PowerLimit float64
+}
+
+// Диапазоны регионов по таблице RadioInterface.cpp прошивки
+var loraRegions = map[generated.Config_LoRaConfig_RegionCode]loraRegion{
+	generated.Config_LoRaConfig_US:      {902.0, 928.0, 100, 30},
+	generated.Config_LoRaConfig_EU_433:  {433.0, 434.0, 10, 12},
+	generated.Config_LoRaConfig_EU_868:  {869.4, 869.65, 10, 27},
+	generated.Config_LoRaConfig_CN:      {470.0, 510.0, 100, 19},
+	generated.Config_LoRaConfig_JP:      {920.5, 923.5, 100, 13},
+	generated.Config_LoRaConfig_ANZ:     {915.0, 928.0, 100, 30},
+	generated.Config_LoRaConfig_KR:      {920.0, 923.0, 100, 23},
+	generated.Config_LoRaConfig_TW:      {920.0, 925.0, 100, 27},
+	generated.Config_LoRaConfig_RU:      {868.7, 869.2, 100, 20},
+	generated.Config_LoRaConfig_IN:      {865.0, 867.0, 100, 30},
+	generated.Config_LoRaConfig_NZ_865:  {864.0, 868.0, 100, 36},
+	generated.Config_LoRaConfig_TH:      {920.0, 925.0, 100, 16},
+	generated.Config_LoRaConfig_LORA_24: {2400.0, 2483.5, 100, 10},
+	generated.Config_LoRaConfig_UA_433:  {433.0, 434.7, 10, 10},
+	generated.Config_LoRaConfig_UA_868:  {868.0, 868.6, 1, 14},
+	generated.Config_LoRaConfig_MY_433:  {433.0, 435.0, 100, 20},
+	generated.Config_LoRaConfig_MY_919:  {919.0, 924.0, 100, 27},
+	generated.Config_LoRaConfig_SG_923:  {917.0, 925.0, 100, 20},
+	generated.Config_LoRaConfig_PH_433:  {433.0, 434.7, 100, 10},
+	generated.Config_LoRaConfig_PH_868:  {868.0, 869.4, 100, 14},
+	generated.Config_LoRaConfig_PH_915:  {915.0, 918.0, 100, 24},
+	generated.Config_LoRaConfig_ANZ_433: {433.05, 434.79, 100, 14},
+	generated.Config_LoRaConfig_KZ_433:  {433.075, 434.775, 100, 10},
+	generated.Config_LoRaConfig_KZ_863:  {863.0, 868.0, 100, 30},
+	generated.Config_LoRaConfig_NP_865:  {865.0, 868.0, 100, 30},
+	generated.Config_LoRaConfig_BR_902:  {902.0, 907.5, 100, 30},
+}
+
+// loraModem - параметры модуляции пресета
+type loraModem struct {
+	SpreadingFactor int
+	Bandwidth       float64 // кГц
+	// CodingRate - знаменатель 4/x
+	CodingRate int
+	// Channel - имя канала по умолчанию, от него зависит номер частотного слота
+	Channel string
+}
+
+var loraPresets = map[generated.Config_LoRaConfig_ModemPreset]loraModem{
+	generated.Config_LoRaConfig_SHORT_TURBO:    {7, 500, 5, "ShortTurbo"},
+	generated.Config_LoRaConfig_SHORT_FAST:     {7, 250, 5, "ShortFast"},
+	generated.Config_LoRaConfig_SHORT_SLOW:     {8, 250, 5, "ShortSlow"},
+	generated.Config_LoRaConfig_MEDIUM_FAST:    {9, 250, 5, "MediumFast"},
+	generated.Config_LoRaConfig_MEDIUM_SLOW:    {10, 250, 5, "MediumSlow"},
+	generated.Config_LoRaConfig_LONG_FAST:      {11, 250, 5, "LongFast"},
+	generated.Config_LoRaConfig_LONG_MODERATE:  {11, 125, 8, "LongMod"},
+	generated.Config_LoRaConfig_LONG_SLOW:      {12, 125, 8, "LongSlow"},
+	generated.Config_LoRaConfig_VERY_LONG_SLOW: {12, 62.5, 8, "VLongSlow"},
+}
+
+// lookupRegion находит регион по имени из MapReport ("RU", "EU_868")
+func lookupRegion(name string) (loraRegion, error) {
+	code, ok := generated.Config_LoRaConfig_RegionCode_value[name]
+	if !ok {
+		return loraRegion{}, fmt.Errorf("неизвестный регион %q", name)
+	}
+	region, ok := loraRegions[generated.Config_LoRaConfig_RegionCode(code)]
+	if !ok {
+		return loraRegion{}, fmt.Errorf("нет частотного плана для региона %q", name)
+	}
+	return region, nil
+}
+
+// lookupPreset находит пресет по имени из MapReport ("LONG_FAST")
+func lookupPreset(name string) (loraModem, error) {
+	code, ok := generated.Config_LoRaConfig_ModemPreset_value[name]
+	if !ok {
+		return loraModem{}, fmt.Errorf("неизвестный пресет %q", name)
+	}
+	modem, ok := loraPresets[generated.Config_LoRaConfig_ModemPreset(code)]
+	if !ok {
+		return loraModem{}, fmt.Errorf("нет параметров для пресета %q", name)
+	}
+	return modem, nil
+}
+
+// channelHash - хеш djb2 имени канала, которым прошивка выбирает частотный слот
+func channelHash(name string) uint32 {
+	hash := uint32(5381)
+	for i := 0; i < len(name); i++ {
+		hash = hash*33 + uint32(name[i])
+	}
+	return hash
+}
+
+// Frequency возвращает центральную частоту канала в МГц так же, как прошивка:
+// диапазон делится на слоты шириной полосы, слот выбирается по хешу имени канала
+func (r loraRegion) Frequency(modem loraModem, channel string) float64 {
+	if channel == "" {
+		channel = modem.Channel
+	}
+	slots := int(math.Floor((r.FreqEnd - r.FreqStart) / (modem.Bandwidth / 1000)))
+	if slots < 1 {
+		slots = 1
+	}
+	slot := int(channelHash(channel) % uint32(slots))
+	return r.FreqStart + modem.Bandwidth/2000 + float64(slot)*modem.Bandwidth/1000
+}
+
+// Минимальный SNR демодуляции LoRa для SF7..SF12, дБ
+var loraDemodSNR = map[int]float64{7: -7.5, 8: -10, 9: -12.5, 10: -15, 11: -17.5, 12: -20}
+
+// NoiseFloor возвращает мощность теплового шума в полосе канала с учетом шум-фактора приемника, дБм
+func (m loraModem) NoiseFloor(noiseFigure float64) float64 {
+	return -174 + 10*math.Log10(m.Bandwidth*1000) + noiseFigure
+}
+
+// Размер заголовка радиопакета Meshtastic перед зашифрованным Data, байт
+const meshHeaderSize = 16
+
+// Длина преамбулы Meshtastic в символах
+const loraPreambleLength = 16
+
+// Airtime возвращает время в эфире кадра длиной payloadBytes
+// (Semtech AN1200.13: явный заголовок, CRC включен)
+func (m loraModem) Airtime(payloadBytes int) time.Duration {
+	sf := float64(m.SpreadingFactor)
+	symbol := math.Pow(2, sf) / (m.Bandwidth * 1000)
+	// Оптимизация для низкой скорости включается при длительности символа больше 16 мс
+	lowDataRate := 0.0
+	if symbol > 0.016 {
+		lowDataRate = 1
+	}
+	preamble := (loraPreambleLength + 4.25) * symbol
+	numerator := 8*float64(payloadBytes) - 4*sf + 28 + 16
+	payloadSymbols := 8 + max(math.Ceil(numerator/(4*(sf-2*lowDataRate)))*float64(m.CodingRate), 0)
+	return time.Duration((preamble + payloadSymbols*symbol) * float64(time.Second))
+}
@@ -0,0 +1,388 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Эквивалентный радиус Земли для стандартной рефракции (k = 4/3)
+const effectiveEarthRadius = earthRadius * 4 / 3
+
+// Шум-фактор типичного приемника SX126x, дБ
+const receiverNoiseFigure = 6.0
+
+// Предел SNR, который сообщает приемник при сильном сигнале, дБ
+const loraMaxReportedSNR = 12.0
+
+// losEndpoint - конец радиолинии
+type losEndpoint struct {
+	// Node - ID узла, пусто если конец задан координатами
+	Node  string
+	Label string
+	Pos   geoPosition
+	// Antenna - высота антенны над землей, м
+	Antenna float64
+	Region  string
+	Preset  string
+}
+
+// profileSample - точка профиля рельефа между концами линии
+type profileSample struct {
+	Distance float64
+	Lat, Lon float64
+	Terrain  float64
+	// Bulge - подъем поверхности Земли над хордой из-за кривизны
+	Bulge   float64
+	LOS     float64
+	Fresnel float64
+	// Clearance - просвет над препятствием в долях радиуса первой зоны Френеля
+	Clearance float64
+}
+
+// linkPrediction - результат расчета линии
+type linkPrediction struct {
+	Distance, DistanceUncertainty float64
+	Frequency                     float64
+	Samples                       []profileSample
+	Worst                         profileSample
+	FreeSpaceLoss                 float64
+	DiffractionLoss               float64
+	RxPower                       float64
+	SNR                           float64
+	// Margin - запас SNR над порогом демодуляции пресета
+	Margin float64
+}
+
+// knifeEdgeLoss - потери дифракции на одиночном клиновидном препятствии (ITU-R P.526)
+func knifeEdgeLoss(v float64) float64 {
+	if v <= -0.78 {
+		return 0
+	}
+	return 6.9 + 20*math.Log10(math.Sqrt((v-0.1)*(v-0.1)+1)+v-0.1)
+}
+
+// freeSpaceLoss - потери в свободном пространстве, дБ
+func freeSpaceLoss(distance, freqMHz float64) float64 {
+	return 20*math.Log10(distance/1000) + 20*math.Log10(freqMHz) + 32.44
+}
+
+// predictLink строит профиль рельефа и оценивает просвет зоны Френеля и затухание
+func predictLink(dem *demTiles, a, b losEndpoint, freqMHz, step float64) (*linkPrediction, error) {
+	distance, uncertainty := a.Pos.DistanceTo(b.Pos)
+	if distance < 1 {
+		return nil, fmt.Errorf("концы линии совпадают")
+	}
+	p := &linkPrediction{Distance: distance, DistanceUncertainty: uncertainty, Frequency: freqMHz}
+
+	groundA, err := dem.Elevation(a.Pos.Lat, a.Pos.Lon)
+	if err != nil {
+		return nil, err
+	}
+	groundB, err := dem.Elevation(b.Pos.Lat, b.Pos.Lon)
+	if err != nil {
+		return nil, err
+	}
+	heightA, heightB := groundA+a.Antenna, groundB+b.Antenna
+	wavelength := 299.792458 / freqMHz
+
+	bearing := bearingDegrees(a.Pos.Lat, a.Pos.Lon, b.Pos.Lat, b.Pos.Lon)
+	n := max(int(math.Ceil(distance/step)), 2)
+	p.Worst.Clearance = math.Inf(1)
+	for i := 0; i <= n; i++ {
+		d1 := distance * float64(i) / float64(n)
+		d2 := distance - d1
+		lat, lon := destinationPoint(a.Pos.Lat, a.Pos.Lon, bearing, d1)
+		terrain, err := dem.Elevation(lat, lon)
+		if err != nil {
+			return nil, err
+		}
+		s := profileSample{
+			Distance: d1,
+			Lat:      lat,
+			Lon:      lon,
+			Terrain:  terrain,
+			Bulge:    d1 * d2 / (2 * effectiveEarthRadius),
+			LOS:      heightA + (heightB-heightA)*d1/distance,
+			Fresnel:  math.Sqrt(wavelength * d1 * d2 / distance),
+		}
+		if i > 0 && i < n {
+			s.Clearance = (s.LOS - s.Terrain - s.Bulge) / s.Fresnel
+			if s.Clearance < p.Worst.Clearance {
+				p.Worst = s
+			}
+		}
+		p.Samples = append(p.Samples, s)
+	}
+
+	p.FreeSpaceLoss = freeSpaceLoss(distance, freqMHz)
+	// Параметр дифракции v = -h * sqrt(2 (d1 + d2) / (λ d1 d2)) = -sqrt(2) * h / F1
+	p.DiffractionLoss = knifeEdgeLoss(-math.Sqrt2 * p.Worst.Clearance)
+	return p, nil
+}
+
+// Status описывает просвет первой зоны Френеля
+func (p *linkPrediction) Status() string {
+	switch {
+	case p.Worst.Clearance >= 0.6:
+		return "прямая видимость, зона Френеля свободна"
+	case p.Worst.Clearance >= 0:
+		return "прямая видимость, зона Френеля частично перекрыта"
+	default:
+		return "прямой видимости нет"
+	}
+}
+
+// linkObservation - SNR, наблюдавшиеся на линии между двумя узлами в захвате
+type linkObservation struct {
+	Source string
+	SNR    float64
+}
+
+// losCapture - сведения об узлах из файла захвата
+type losCapture struct {
+	positions map[string]geoPosition
+	names     map[string]string
+	regions   map[string]string
+	presets   map[string]string
+	links     map[string][]linkObservation
+}
+
+func loadLOSCapture(path string) (*losCapture, error) {
+	c := &losCapture{
+		positions: make(map[string]geoPosition),
+		names:     make(map[string]string),
+		regions:   make(map[string]string),
+		presets:   make(map[string]string),
+		links:     make(map[string][]linkObservation),
+	}
+	err := forEachCaptureRecord(path, func(record *CSVRecord) {
+		for _, link := range record.links {
+			if snr, err := strconv.ParseFloat(link.SNR, 64); err == nil {
+				key := link.From + "|" + link.To
+				c.links[key] = append(c.links[key], linkObservation{Source: link.Source, SNR: snr})
+			}
+		}
+		if record.From == "" {
+			return
+		}
+		node := NodeIDFromString(record.From)
+		if pos, ok := recordPosition(record); ok {
+			c.positions[node] = pos
+		}
+		if record.UserLongName != "" {
+			c.names[node] = record.UserLongName
+		} else if record.MapLongName != "" && c.names[node] == "" {
+			c.names[node] = record.MapLongName
+		}
+		if record.MapRegion != "" {
+			c.regions[node] = record.MapRegion
+		}
+		if record.MapModemPreset != "" {
+			c.presets[node] = record.MapModemPreset
+		}
+	})
+	return c, err
+}
+
+// resolveEndpoint разбирает "lat,lon" или ID узла (!xxxxxxxx или десятичный)
+func resolveEndpoint(arg string, capture *losCapture) (losEndpoint, error) {
+	if parts := strings.Split(arg, ","); len(parts) == 2 {
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lon, errLon := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if errLat != nil || errLon != nil {
+			return losEndpoint{}, fmt.Errorf("неверные координаты %q", arg)
+		}
+		return losEndpoint{Label: arg, Pos: geoPosition{Lat: lat, Lon: lon}}, nil
+	}
+
+	nodes, err := parseNodeList(arg)
+	if err != nil || len(nodes) != 1 {
+		return losEndpoint{}, fmt.Errorf("ожидается ID узла или координаты \"lat,lon\": %q", arg)
+	}
+	var node string
+	for id := range nodes {
+		node = id
+	}
+	if capture == nil {
+		return losEndpoint{}, fmt.Errorf("для узла %s нужен файл захвата (-capture)", node)
+	}
+	pos, ok := capture.positions[node]
+	if !ok {
+		return losEndpoint{}, fmt.Errorf("позиция узла %s в захвате не найдена", node)
+	}
+	label := node
+	if name := capture.names[node]; name != "" {
+		label += " " + name
+	}
+	return losEndpoint{
+		Node:   node,
+		Label:  label,
+		Pos:    pos,
+		Region: capture.regions[node],
+		Preset: capture.presets[node],
+	}, nil
+}
+
+// observedSNR собирает SNR на линии в обоих направлениях
+func (c *losCapture) observedSNR(a, b string) []linkObservation {
+	if c == nil || a == "" || b == "" {
+		return nil
+	}
+	return append(append([]linkObservation(nil), c.links[a+"|"+b]...), c.links[b+"|"+a]...)
+}
+
+// writeProfile пишет профиль рельефа в CSV
+func writeProfile(path string, p *linkPrediction) error {
+	rows := [][]string{{"DistanceM", "Latitude", "Longitude", "TerrainM", "EarthBulgeM", "LOSM",
+		"Fresnel1M", "Clearance"}}
+	for _, s := range p.Samples {
+		clearance := ""
+		if s.Fresnel > 0 {
+			clearance = fmt.Sprintf("%.2f", s.Clearance)
+		}
+		rows = append(rows, []string{fmt.Sprintf("%.0f", s.Distance), fmt.Sprintf("%.6f", s.Lat),
+			fmt.Sprintf("%.6f", s.Lon), fmt.Sprintf("%.1f", s.Terrain), fmt.Sprintf("%.1f", s.Bulge),
+			fmt.Sprintf("%.1f", s.LOS), fmt.Sprintf("%.1f", s.Fresnel), clearance})
+	}
+	return writeCSVFile(path, rows)
+}
+
+// LOSOptions - параметры радиолинии для PredictLOS. Незаданные поля, для которых указано
+// значение по умолчанию, заменяются им.
+type LOSOptions struct {
+	// DEMDir - каталог с тайлами SRTM .hgt (N64E040.hgt и т.д.), обязателен
+	DEMDir string
+	// CapturePath - файл захвата для позиций, региона, пресета и наблюдаемого SNR узлов
+	CapturePath string
+	// HeightA и HeightB - высоты антенн над землей, м
+	HeightA, HeightB float64
+	// Region и Preset - по умолчанию из MapReport узлов, иначе RU и LONG_FAST
+	Region, Preset string
+	// Channel - имя канала для выбора частотного слота, по умолчанию имя пресета
+	Channel string
+	// Frequency - частота в МГц вместо расчетной по региону и каналу
+	Frequency float64
+	// TxPower - мощность передатчика, дБм, по умолчанию предел региона, не больше 22
+	TxPower float64
+	// Gain - усиление каждой антенны, дБи
+	Gain float64
+	// Step - шаг профиля, м, по умолчанию 30
+	Step float64
+	// ProfilePath - CSV файл профиля рельефа
+	ProfilePath string
+}
+
+// PredictLOS строит профиль рельефа и зону Френеля между точками from и to (узел или
+// lat,lon), печатает прогноз SNR и сравнивает его с наблюдаемым в захвате
+func PredictLOS(from, to string, opts LOSOptions) error {
+	if opts.DEMDir == "" {
+		return fmt.Errorf("не указан каталог тайлов рельефа")
+	}
+	if opts.Step <= 0 {
+		opts.Step = 30
+	}
+
+	var capture *losCapture
+	if opts.CapturePath != "" {
+		var err error
+		capture, err = loadLOSCapture(opts.CapturePath)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения файла: %w", err)
+		}
+	}
+
+	a, err := resolveEndpoint(from, capture)
+	if err != nil {
+		return err
+	}
+	b, err := resolveEndpoint(to, capture)
+	if err != nil {
+		return err
+	}
+	a.Antenna, b.Antenna = opts.HeightA, opts.HeightB
+
+	regionArg := firstNonEmpty(opts.Region, a.Region, b.Region, "RU")
+	presetArg := firstNonEmpty(opts.Preset, a.Preset, b.Preset, "LONG_FAST")
+	region, err := lookupRegion(regionArg)
+	if err != nil {
+		return err
+	}
+	modem, err := lookupPreset(presetArg)
+	if err != nil {
+		return err
+	}
+	frequency := opts.Frequency
+	if frequency == 0 {
+		frequency = region.Frequency(modem, opts.Channel)
+	}
+	power := opts.TxPower
+	if power == 0 {
+		power = min(region.PowerLimit, 22)
+	}
+
+	p, err := predictLink(newDEMTiles(opts.DEMDir), a, b, frequency, opts.Step)
+	if err != nil {
+		return fmt.Errorf("ошибка расчета профиля: %w", err)
+	}
+	p.RxPower = power + 2*opts.Gain - p.FreeSpaceLoss - p.DiffractionLoss
+	snr := p.RxPower - modem.NoiseFloor(receiverNoiseFigure)
+	p.Margin = snr - loraDemodSNR[modem.SpreadingFactor]
+	// Приемник SX126x не сообщает SNR выше примерно +12 дБ - так прогноз сравним с наблюдаемым
+	p.SNR = min(snr, loraMaxReportedSNR)
+
+	if opts.ProfilePath != "" {
+		if err := writeProfile(opts.ProfilePath, p); err != nil {
+			return fmt.Errorf("ошибка записи профиля: %w", err)
+		}
+	}
+
+	fmt.Printf("Линия %s -> %s\n", a.Label, b.Label)
+	fmt.Printf("  расстояние %.2f км", p.Distance/1000)
+	if p.DistanceUncertainty > 0 {
+		fmt.Printf(" ± %.2f км (позиции округлены)", p.DistanceUncertainty/1000)
+	}
+	fmt.Println()
+	fmt.Printf("  %s %s: %.3f МГц, SF%d, BW %.1f кГц, мощность %.0f дБм\n",
+		regionArg, presetArg, frequency, modem.SpreadingFactor, modem.Bandwidth, power)
+	fmt.Printf("  %s; худший просвет %.2f F1 на %.2f км (рельеф %.0f м, линия %.0f м)\n",
+		p.Status(), p.Worst.Clearance, p.Worst.Distance/1000, p.Worst.Terrain+p.Worst.Bulge, p.Worst.LOS)
+	fmt.Printf("  потери: свободное пространство %.1f дБ, дифракция %.1f дБ\n", p.FreeSpaceLoss, p.DiffractionLoss)
+	fmt.Printf("  прогноз: прием %.1f дБм, SNR %.1f дБ, запас до порога SF%d %.1f дБ\n",
+		p.RxPower, p.SNR, modem.SpreadingFactor, p.Margin)
+
+	observed := capture.observedSNR(a.Node, b.Node)
+	if len(observed) == 0 {
+		if capture != nil {
+			fmt.Println("  наблюдений SNR на этой линии в захвате нет")
+		}
+		return nil
+	}
+	values := make([]float64, len(observed))
+	sources := make(map[string]int)
+	for i, o := range observed {
+		values[i] = o.SNR
+		sources[o.Source]++
+	}
+	var parts []string
+	for source, count := range sources {
+		parts = append(parts, fmt.Sprintf("%s=%d", source, count))
+	}
+	sort.Strings(parts)
+	med := median(values)
+	fmt.Printf("  наблюдалось: SNR медиана %.2f дБ (мин %.2f, макс %.2f, %s), отклонение от прогноза %+.1f дБ\n",
+		med, slices.Min(values), slices.Max(values), strings.Join(parts, " "), med-p.SNR)
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
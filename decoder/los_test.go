@@ -0,0 +1,159 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeHGT пишет тайл SRTM из строк высот, первая строка - северный край
+func writeHGT(t *testing.T, dir, name string, rows [][]int16) {
+	t.Helper()
+	var data []byte
+	for _, row := range rows {
+		for _, h := range row {
+			data = binary.BigEndian.AppendUint16(data, uint16(h))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHGTTileName(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		want     string
+	}{
+		{64.5, 40.5, "N64E040"},
+		{0.5, 0.5, "N00E000"},
+		{-0.5, -0.5, "S01W001"},
+		{-33.9, 151.2, "S34E151"},
+		{51.5, -0.1, "N51W001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := hgtTileName(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("hgtTileName(%v, %v) = %s, want %s", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDEMElevation(t *testing.T) {
+	dir := t.TempDir()
+	writeHGT(t, dir, "N64E040.hgt", [][]int16{
+		{100, 200, 300},
+		{400, 500, 600},
+		{700, 800, hgtVoid},
+	})
+	// Имя тайла в нижнем регистре тоже находится
+	writeHGT(t, dir, "n64e041.hgt", [][]int16{{10, 10}, {10, 10}})
+	if err := os.WriteFile(filepath.Join(dir, "N64E042.hgt"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dem := newDEMTiles(dir)
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     float64
+		wantErr  bool
+	}{
+		{name: "south west corner", lat: 64, lon: 40, want: 700},
+		{name: "center", lat: 64.5, lon: 40.5, want: 500},
+		{name: "between rows", lat: 64.75, lon: 40.5, want: 350},
+		{name: "between columns", lat: 64.5, lon: 40.25, want: 450},
+		{name: "void skipped", lat: 64.25, lon: 40.75, want: (500 + 600 + 800) / 3.0},
+		{name: "lower case file", lat: 64.5, lon: 41.5, want: 10},
+		{name: "missing tile", lat: 10, lon: 10, wantErr: true},
+		{name: "bad size", lat: 64.5, lon: 42.5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dem.Elevation(tt.lat, tt.lon)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Elevation error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("Elevation = %.3f, want %.3f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictLink(t *testing.T) {
+	flat := [][]int16{{0, 0, 0}, {0, 0, 0}, {0, 0, 0}}
+	ridge := [][]int16{{0, 0, 0}, {0, 500, 0}, {0, 0, 0}}
+	a := geoPosition{Lat: 64.2, Lon: 40.2}
+	b := geoPosition{Lat: 64.2, Lon: 40.8}
+
+	tests := []struct {
+		name        string
+		tile        [][]int16
+		antenna     float64
+		status      string
+		diffraction bool
+	}{
+		{name: "clear", tile: flat, antenna: 100, status: "прямая видимость, зона Френеля свободна"},
+		{name: "earth bulge", tile: flat, antenna: 20, status: "прямая видимость, зона Френеля частично перекрыта", diffraction: true},
+		{name: "ridge", tile: ridge, antenna: 10, status: "прямой видимости нет", diffraction: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeHGT(t, dir, "N64E040.hgt", tt.tile)
+			p, err := predictLink(newDEMTiles(dir),
+				losEndpoint{Pos: a, Antenna: tt.antenna}, losEndpoint{Pos: b, Antenna: tt.antenna}, 868, 100)
+			if err != nil {
+				t.Fatalf("predictLink: %v", err)
+			}
+			if got := p.Status(); got != tt.status {
+				t.Errorf("Status = %q (clearance %.2f), want %q", got, p.Worst.Clearance, tt.status)
+			}
+			if (p.DiffractionLoss > 0) != tt.diffraction {
+				t.Errorf("DiffractionLoss = %.1f, want > 0: %v", p.DiffractionLoss, tt.diffraction)
+			}
+			if want := freeSpaceLoss(p.Distance, 868); p.FreeSpaceLoss != want {
+				t.Errorf("FreeSpaceLoss = %.2f, want %.2f", p.FreeSpaceLoss, want)
+			}
+
+			// Подъем Земли и радиус зоны Френеля максимальны в середине линии
+			mid := p.Samples[len(p.Samples)/2]
+			d := p.Distance / 2
+			if bulge := d * d / (2 * effectiveEarthRadius); math.Abs(mid.Bulge-bulge) > 0.01 {
+				t.Errorf("mid bulge = %.2f, want %.2f", mid.Bulge, bulge)
+			}
+			if fresnel := math.Sqrt(299.792458 / 868 * d / 2); math.Abs(mid.Fresnel-fresnel) > 0.01 {
+				t.Errorf("mid fresnel = %.2f, want %.2f", mid.Fresnel, fresnel)
+			}
+		})
+	}
+
+	if _, err := predictLink(newDEMTiles(t.TempDir()), losEndpoint{Pos: a}, losEndpoint{Pos: a}, 868, 100); err == nil {
+		t.Error("predictLink with coincident endpoints: want error")
+	}
+}
+
+func TestRadioLoss(t *testing.T) {
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "free space 1 km 868 MHz", got: freeSpaceLoss(1000, 868), want: 91.21},
+		{name: "free space 10 km 433 MHz", got: freeSpaceLoss(10000, 433), want: 105.17},
+		{name: "knife edge clear", got: knifeEdgeLoss(-1), want: 0},
+		{name: "knife edge grazing", got: knifeEdgeLoss(0), want: 6.03},
+		{name: "knife edge blocked", got: knifeEdgeLoss(2.4), want: 20.54},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 0.01 {
+				t.Errorf("got %.2f, want %.2f", tt.got, tt.want)
+			}
+		})
+	}
+}
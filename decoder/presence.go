@@ -0,0 +1,332 @@
+package decoder
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PresenceState - состояние присутствия узла в сети
+type PresenceState string
+
+const (
+	PresenceUnknown PresenceState = ""
+	PresenceOnline  PresenceState = "online"
+	PresenceStale   PresenceState = "stale"
+	PresenceOffline PresenceState = "offline"
+)
+
+// presenceConfig задает пороги перехода состояний. Пороги узла - интервал его
+// маяков, умноженный на коэффициент и ограниченный снизу и сверху; пока интервал
+// не оценен, используются значения по умолчанию.
+type presenceConfig struct {
+	StaleFactor    float64
+	OfflineFactor  float64
+	MinStale       time.Duration
+	MinOffline     time.Duration
+	MaxStale       time.Duration
+	MaxOffline     time.Duration
+	DefaultStale   time.Duration
+	DefaultOffline time.Duration
+	// MinSamples - сколько интервалов между пакетами нужно для собственной оценки узла
+	MinSamples int
+}
+
+var defaultPresenceConfig = presenceConfig{
+	StaleFactor:    3,
+	OfflineFactor:  6,
+	MinStale:       15 * time.Minute,
+	MinOffline:     45 * time.Minute,
+	MaxStale:       12 * time.Hour,
+	MaxOffline:     36 * time.Hour,
+	DefaultStale:   time.Hour,
+	DefaultOffline: 3 * time.Hour,
+	MinSamples:     3,
+}
+
+// Интервалы короче этого считаются копиями одной передачи и в оценку не входят
+const presenceMinGap = 10 * time.Second
+
+// Сколько последних интервалов хранится для оценки периода маяков
+const presenceGapHistory = 20
+
+// nodePresence - текущее состояние узла
+type nodePresence struct {
+	Node        string
+	Name        string
+	State       PresenceState
+	Since       time.Time
+	FirstHeard  time.Time
+	LastHeard   time.Time
+	LastDirect  time.Time
+	LastGateway string
+	Packets     int
+
+	Position   *geoPosition
+	PositionAt time.Time
+
+	Battery     string
+	Voltage     string
+	TelemetryAt time.Time
+
+	lastPacketID string
+	lastPacketAt time.Time
+	gaps         []float64 // секунды
+}
+
+// Interval возвращает оценку периода маяков узла (медиана интервалов) или 0
+func (n *nodePresence) Interval(minSamples int) time.Duration {
+	if len(n.gaps) < minSamples {
+		return 0
+	}
+	return time.Duration(median(n.gaps) * float64(time.Second))
+}
+
+// PresenceEvent - переход узла из одного состояния в другое
+type PresenceEvent struct {
+	Time      time.Time
+	Node      string
+	Name      string
+	From      PresenceState
+	To        PresenceState
+	LastHeard time.Time
+	Interval  time.Duration
+}
+
+// Silence возвращает время, прошедшее с последнего пакета узла к моменту перехода
+func (e PresenceEvent) Silence() time.Duration {
+	return e.Time.Sub(e.LastHeard)
+}
+
+func (e PresenceEvent) String() string {
+	from := string(e.From)
+	if e.From == PresenceUnknown {
+		from = "new"
+	}
+	text := fmt.Sprintf("%s %s", e.Time.Format(time.DateTime), e.Node)
+	if e.Name != "" {
+		text += " (" + e.Name + ")"
+	}
+	text += fmt.Sprintf(": %s -> %s", from, e.To)
+	if e.To != PresenceOnline {
+		text += fmt.Sprintf(", тишина %s", e.Silence().Round(time.Second))
+	}
+	return text
+}
+
+// presenceTracker ведет состояние присутствия узлов по потоку записей. Входящий
+// пакет переводит узел в online, Advance переводит замолчавшие узлы в stale и
+// offline. Все переходы возвращаются вызывающему. Хронология для WriteReport
+// копится только при включенном history: живому хранилищу она не нужна и росла бы
+// без предела.
+type presenceTracker struct {
+	config  presenceConfig
+	nodes   map[string]*nodePresence
+	history bool
+	events  []PresenceEvent
+	now     time.Time
+}
+
+func newPresenceTracker(config presenceConfig) *presenceTracker {
+	return &presenceTracker{config: config, nodes: make(map[string]*nodePresence)}
+}
+
+// Thresholds возвращает пороги перехода узла в stale и offline
+func (t *presenceTracker) Thresholds(n *nodePresence) (stale, offline time.Duration) {
+	interval := n.Interval(t.config.MinSamples)
+	if interval == 0 {
+		return t.config.DefaultStale, t.config.DefaultOffline
+	}
+	stale = time.Duration(float64(interval) * t.config.StaleFactor)
+	offline = time.Duration(float64(interval) * t.config.OfflineFactor)
+	stale = min(max(stale, t.config.MinStale), t.config.MaxStale)
+	offline = min(max(offline, t.config.MinOffline, stale), t.config.MaxOffline)
+	return stale, offline
+}
+
+// Observe учитывает запись (в том числе повторные копии через другие шлюзы)
+func (t *presenceTracker) Observe(record *CSVRecord) []PresenceEvent {
+	if record.From == "" {
+		return nil
+	}
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		return nil
+	}
+	events := t.Advance(at)
+
+	node := NodeIDFromString(record.From)
+	n := t.nodes[node]
+	if n == nil {
+		n = &nodePresence{Node: node, FirstHeard: at}
+		t.nodes[node] = n
+	}
+	if record.UserLongName != "" {
+		n.Name = record.UserLongName
+	} else if record.MapLongName != "" && n.Name == "" {
+		n.Name = record.MapLongName
+	}
+
+	// Интервал считаем только между разными пакетами
+	if record.PacketID == "" || record.PacketID != n.lastPacketID {
+		if !n.lastPacketAt.IsZero() {
+			if gap := at.Sub(n.lastPacketAt); gap >= presenceMinGap {
+				n.gaps = append(n.gaps, gap.Seconds())
+				if len(n.gaps) > presenceGapHistory {
+					n.gaps = n.gaps[1:]
+				}
+			}
+		}
+		n.lastPacketID = record.PacketID
+		n.lastPacketAt = at
+		n.Packets++
+	}
+
+	if at.After(n.LastHeard) {
+		n.LastHeard = at
+	}
+	n.LastGateway = record.GatewayID
+	if record.HopsAway == "0" && at.After(n.LastDirect) {
+		n.LastDirect = at
+	}
+	if pos, ok := recordPosition(record); ok && !at.Before(n.PositionAt) {
+		n.Position = &pos
+		n.PositionAt = at
+	}
+	if (record.BatteryLevel != "" || record.Voltage != "") && !at.Before(n.TelemetryAt) {
+		n.Battery = record.BatteryLevel
+		n.Voltage = record.Voltage
+		n.TelemetryAt = at
+	}
+
+	if n.State != PresenceOnline {
+		events = append(events, t.transition(n, PresenceOnline, at))
+	}
+	return events
+}
+
+// Advance переводит узлы, молчащие дольше порога, в stale и offline. Время
+// перехода - момент пересечения порога, а не момент вызова.
+func (t *presenceTracker) Advance(now time.Time) []PresenceEvent {
+	if now.After(t.now) {
+		t.now = now
+	}
+
+	var events []PresenceEvent
+	for _, n := range t.nodes {
+		stale, offline := t.Thresholds(n)
+		if n.State == PresenceOnline && now.Sub(n.LastHeard) > stale {
+			events = append(events, t.transition(n, PresenceStale, n.LastHeard.Add(stale)))
+		}
+		if n.State == PresenceStale && now.Sub(n.LastHeard) > offline {
+			events = append(events, t.transition(n, PresenceOffline, n.LastHeard.Add(offline)))
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].Time.Equal(events[j].Time) {
+			return events[i].Time.Before(events[j].Time)
+		}
+		return events[i].Node < events[j].Node
+	})
+	return events
+}
+
+func (t *presenceTracker) transition(n *nodePresence, to PresenceState, at time.Time) PresenceEvent {
+	event := PresenceEvent{
+		Time:      at,
+		Node:      n.Node,
+		Name:      n.Name,
+		From:      n.State,
+		To:        to,
+		LastHeard: n.LastHeard,
+		Interval:  n.Interval(t.config.MinSamples),
+	}
+	n.State = to
+	n.Since = at
+	if t.history {
+		t.events = append(t.events, event)
+	}
+	return event
+}
+
+// Nodes возвращает узлы, отсортированные по идентификатору
+func (t *presenceTracker) Nodes() []*nodePresence {
+	nodes := make([]*nodePresence, 0, len(t.nodes))
+	for _, n := range t.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes
+}
+
+// WriteReport пишет хронологию переходов в path и состояние узлов в <имя>_nodes
+func (t *presenceTracker) WriteReport(path string) error {
+	rows := [][]string{{"Time", "Node", "Name", "From", "To", "LastHeard", "Silence", "Interval"}}
+	for _, e := range t.events {
+		from := string(e.From)
+		if e.From == PresenceUnknown {
+			from = "new"
+		}
+		rows = append(rows, []string{
+			e.Time.Format(time.DateTime), e.Node, e.Name, from, string(e.To),
+			e.LastHeard.Format(time.DateTime), formatSeconds(e.Silence()), formatSeconds(e.Interval),
+		})
+	}
+	if err := writeCSVFile(path, rows); err != nil {
+		return err
+	}
+
+	rows = [][]string{{
+		"Node", "Name", "State", "Since", "FirstHeard", "LastHeard", "LastDirect", "LastGateway",
+		"Packets", "Interval", "StaleAfter", "OfflineAfter", "Latitude", "Longitude",
+		"PositionUncertainty", "PositionTime", "BatteryLevel", "Voltage", "TelemetryTime",
+	}}
+	for _, n := range t.Nodes() {
+		stale, offline := t.Thresholds(n)
+		row := []string{
+			n.Node, n.Name, string(n.State), n.Since.Format(time.DateTime),
+			n.FirstHeard.Format(time.DateTime), n.LastHeard.Format(time.DateTime),
+			formatTime(n.LastDirect), n.LastGateway, fmt.Sprintf("%d", n.Packets),
+			formatSeconds(n.Interval(t.config.MinSamples)), formatSeconds(stale), formatSeconds(offline),
+		}
+		if n.Position != nil {
+			row = append(row, fmt.Sprintf("%.7f", n.Position.Lat), fmt.Sprintf("%.7f", n.Position.Lon),
+				fmt.Sprintf("%.0f", n.Position.Uncertainty), formatTime(n.PositionAt))
+		} else {
+			row = append(row, "", "", "", "")
+		}
+		row = append(row, n.Battery, n.Voltage, formatTime(n.TelemetryAt))
+		rows = append(rows, row)
+	}
+	return writeCSVFile(withSuffix(path, "_nodes"), rows)
+}
+
+func (t *presenceTracker) PrintSummary() {
+	counts := make(map[PresenceState]int)
+	for _, n := range t.nodes {
+		counts[n.State]++
+	}
+	fmt.Printf("Присутствие на %s: %d узлов (online %d, stale %d, offline %d), переходов %d\n",
+		t.now.Format(time.DateTime), len(t.nodes), counts[PresenceOnline], counts[PresenceStale],
+		counts[PresenceOffline], len(t.events))
+	start := max(len(t.events)-10, 0)
+	for _, e := range t.events[start:] {
+		fmt.Printf("  %s\n", e)
+	}
+}
+
+// formatSeconds возвращает длительность в целых секундах, пустую строку для нуля
+func formatSeconds(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", d.Seconds())
+}
+
+// formatTime возвращает время в формате отчетов, пустую строку для нулевого
+func formatTime(at time.Time) string {
+	if at.IsZero() {
+		return ""
+	}
+	return at.Format(time.DateTime)
+}
@@ -0,0 +1,82 @@
+package decoder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPresenceThresholds(t *testing.T) {
+	tests := []struct {
+		name           string
+		gaps           []float64
+		stale, offline time.Duration
+	}{
+		{name: "no estimate", stale: time.Hour, offline: 3 * time.Hour},
+		{name: "too few samples", gaps: []float64{600, 600}, stale: time.Hour, offline: 3 * time.Hour},
+		{name: "clamped below", gaps: []float64{120, 120, 120}, stale: 15 * time.Minute, offline: 45 * time.Minute},
+		{name: "median interval", gaps: []float64{1800, 1700, 1900, 36000, 1900}, stale: 95 * time.Minute, offline: 190 * time.Minute},
+		{name: "clamped above", gaps: []float64{28800, 28800, 28800}, stale: 12 * time.Hour, offline: 36 * time.Hour},
+	}
+	tracker := newPresenceTracker(defaultPresenceConfig)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale, offline := tracker.Thresholds(&nodePresence{gaps: tt.gaps})
+			if stale != tt.stale || offline != tt.offline {
+				t.Errorf("Thresholds = %v/%v, want %v/%v", stale, offline, tt.stale, tt.offline)
+			}
+		})
+	}
+}
+
+func TestPresenceTransitions(t *testing.T) {
+	for _, history := range []bool{false, true} {
+		t.Run(fmt.Sprintf("history=%v", history), func(t *testing.T) {
+			testPresenceTransitions(t, history)
+		})
+	}
+}
+
+func testPresenceTransitions(t *testing.T, history bool) {
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.Local)
+	tracker := newPresenceTracker(defaultPresenceConfig)
+	tracker.history = history
+	observe := func(at time.Duration, id int) []PresenceEvent {
+		return tracker.Observe(&CSVRecord{Timestamp: CaptureTimestamp(start.Add(at)), From: "1", PacketID: fmt.Sprint(id)})
+	}
+
+	// Маяк каждые 15 минут: пороги 45 минут и полтора часа от последнего пакета
+	var events []PresenceEvent
+	for i := range 4 {
+		events = append(events, observe(time.Duration(i)*15*time.Minute, i+1)...)
+	}
+	events = append(events, tracker.Advance(start.Add(3*time.Hour))...)
+	events = append(events, observe(3*time.Hour, 5)...)
+
+	want := []struct {
+		to PresenceState
+		at time.Duration
+	}{
+		{PresenceOnline, 0},
+		{PresenceStale, 90 * time.Minute},
+		{PresenceOffline, 135 * time.Minute},
+		{PresenceOnline, 3 * time.Hour},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %d", events, len(want))
+	}
+	for i, w := range want {
+		if events[i].To != w.to || !events[i].Time.Equal(start.Add(w.at)) {
+			t.Errorf("event %d = %s, want %s at %v", i, events[i], w.to, w.at)
+		}
+	}
+
+	// Хронология копится только для отчета
+	wantKept := 0
+	if history {
+		wantKept = len(want)
+	}
+	if len(tracker.events) != wantKept {
+		t.Errorf("kept %d events, want %d", len(tracker.events), wantKept)
+	}
+}
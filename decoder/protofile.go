@@ -0,0 +1,479 @@
+package decoder
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoDecoder декодирует payload как сообщение, описанное в .proto файле
+type protoDecoder struct {
+	name    string
+	message protoreflect.MessageDescriptor
+}
+
+func newProtoDecoder(name, path, messageName string) (*protoDecoder, error) {
+	file, err := parseProtoFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	message := findProtoMessage(file.Messages(), messageName)
+	if message == nil {
+		return nil, fmt.Errorf("сообщение %q не найдено в %s", messageName, path)
+	}
+	return &protoDecoder{name: name, message: message}, nil
+}
+
+func (d *protoDecoder) Name() string {
+	return d.name
+}
+
+func (d *protoDecoder) Decode(payload []byte, record *CSVRecord) error {
+	msg := dynamicpb.NewMessage(d.message)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return err
+	}
+
+	// Числовые поля верхнего уровня идут во временной ряд телеметрии
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() || fd.IsMap() {
+			return true
+		}
+		switch fd.Kind() {
+		case protoreflect.FloatKind, protoreflect.DoubleKind:
+			record.addMetric(d.name+"_"+string(fd.Name()), v.Float())
+		case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind,
+			protoreflect.Sint64Kind, protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+			record.addMetric(d.name+"_"+string(fd.Name()), float64(v.Int()))
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+			record.addMetric(d.name+"_"+string(fd.Name()), float64(v.Uint()))
+		}
+		return true
+	})
+
+	formatted := formatProtoMessage(msg)
+	record.CustomValues = strings.TrimSuffix(strings.TrimPrefix(formatted, "{"), "}")
+	return nil
+}
+
+// findProtoMessage ищет сообщение по полному или короткому имени.
+// Пустое имя подходит, только если в файле одно сообщение верхнего уровня.
+func findProtoMessage(messages protoreflect.MessageDescriptors, name string) protoreflect.MessageDescriptor {
+	if name == "" {
+		if messages.Len() == 1 {
+			return messages.Get(0)
+		}
+		return nil
+	}
+
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if string(md.FullName()) == name || string(md.Name()) == name {
+			return md
+		}
+		if nested := findProtoMessage(md.Messages(), name); nested != nil {
+			return nested
+		}
+	}
+	return nil
+}
+
+// parseProtoFile разбирает .proto файл без внешнего компилятора protoc.
+// Поддерживается подмножество языка, достаточное для описания payload:
+// syntax, package, option, message (в том числе вложенные), enum, oneof,
+// метки optional/repeated и скалярные типы. import и map не поддерживаются.
+func parseProtoFile(path string) (protoreflect.FileDescriptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %w", path, err)
+	}
+
+	p := &protoParser{tokens: tokenizeProto(string(data))}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:   proto.String(path),
+		Syntax: proto.String("proto2"),
+	}
+	if err := p.parseFile(fdp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := resolveProtoTypes(fdp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file, err := protodesc.NewFile(fdp, new(protoregistry.Files))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// tokenizeProto разбивает текст на идентификаторы, числа, строки и символы, пропуская комментарии
+func tokenizeProto(src string) []string {
+	var tokens []string
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i += 2
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			tokens = append(tokens, string(runes[i:min(j+1, len(runes))]))
+			i = j + 1
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) ||
+				runes[j] == '_' || runes[j] == '.' || (j == i && runes[j] == '-')) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+type protoParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *protoParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *protoParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *protoParser) expect(want string) error {
+	if got := p.next(); got != want {
+		return fmt.Errorf("ожидалось %q, получено %q", want, got)
+	}
+	return nil
+}
+
+// skipStatement пропускает конструкцию до ';' (option, reserved, extensions)
+func (p *protoParser) skipStatement() {
+	for p.pos < len(p.tokens) && p.next() != ";" {
+	}
+}
+
+func (p *protoParser) parseFile(fdp *descriptorpb.FileDescriptorProto) error {
+	for p.pos < len(p.tokens) {
+		switch tok := p.next(); tok {
+		case "syntax":
+			if err := p.expect("="); err != nil {
+				return err
+			}
+			fdp.Syntax = proto.String(strings.Trim(p.next(), `"'`))
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "package":
+			fdp.Package = proto.String(p.next())
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "option":
+			p.skipStatement()
+		case "import":
+			return fmt.Errorf("import не поддерживается, опишите все типы в одном файле")
+		case "message":
+			msg, err := p.parseMessage()
+			if err != nil {
+				return err
+			}
+			fdp.MessageType = append(fdp.MessageType, msg)
+		case "enum":
+			enum, err := p.parseEnum()
+			if err != nil {
+				return err
+			}
+			fdp.EnumType = append(fdp.EnumType, enum)
+		case ";":
+		default:
+			return fmt.Errorf("неожиданный токен %q", tok)
+		}
+	}
+	return nil
+}
+
+func (p *protoParser) parseMessage() (*descriptorpb.DescriptorProto, error) {
+	msg := &descriptorpb.DescriptorProto{Name: proto.String(p.next())}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	for {
+		switch tok := p.peek(); tok {
+		case "":
+			return nil, fmt.Errorf("незакрытое сообщение %s", msg.GetName())
+		case "}":
+			p.next()
+			return msg, nil
+		case ";":
+			p.next()
+		case "option", "reserved", "extensions":
+			p.skipStatement()
+		case "message":
+			p.next()
+			nested, err := p.parseMessage()
+			if err != nil {
+				return nil, err
+			}
+			msg.NestedType = append(msg.NestedType, nested)
+		case "enum":
+			p.next()
+			enum, err := p.parseEnum()
+			if err != nil {
+				return nil, err
+			}
+			msg.EnumType = append(msg.EnumType, enum)
+		case "oneof":
+			p.next()
+			index := int32(len(msg.OneofDecl))
+			msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(p.next())})
+			if err := p.expect("{"); err != nil {
+				return nil, err
+			}
+			for p.peek() != "}" && p.peek() != "" {
+				if p.peek() == "option" {
+					p.skipStatement()
+					continue
+				}
+				field, err := p.parseField()
+				if err != nil {
+					return nil, err
+				}
+				field.OneofIndex = proto.Int32(index)
+				msg.Field = append(msg.Field, field)
+			}
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+		case "map":
+			return nil, fmt.Errorf("поле map в сообщении %s не поддерживается", msg.GetName())
+		default:
+			field, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			msg.Field = append(msg.Field, field)
+		}
+	}
+}
+
+// Скалярные типы protobuf
+var protoScalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+func (p *protoParser) parseField() (*descriptorpb.FieldDescriptorProto, error) {
+	field := &descriptorpb.FieldDescriptorProto{
+		Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+
+	switch p.peek() {
+	case "repeated":
+		p.next()
+		field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	case "required":
+		p.next()
+		field.Label = descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+	case "optional":
+		p.next()
+	}
+
+	typeName := p.next()
+	if t, ok := protoScalarTypes[typeName]; ok {
+		field.Type = t.Enum()
+	} else {
+		// Ссылка на message или enum - разрешается после разбора всего файла
+		field.TypeName = proto.String(typeName)
+	}
+
+	field.Name = proto.String(p.next())
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	number, err := strconv.ParseInt(p.next(), 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("неверный номер поля %s: %w", field.GetName(), err)
+	}
+	field.Number = proto.Int32(int32(number))
+	field.JsonName = proto.String(field.GetName())
+
+	// Опции поля [packed = true, deprecated = true] не влияют на разбор
+	if p.peek() == "[" {
+		for p.peek() != "]" && p.peek() != "" {
+			p.next()
+		}
+		p.next()
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+func (p *protoParser) parseEnum() (*descriptorpb.EnumDescriptorProto, error) {
+	enum := &descriptorpb.EnumDescriptorProto{Name: proto.String(p.next())}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return nil, fmt.Errorf("незакрытый enum %s", enum.GetName())
+		case "}":
+			return enum, nil
+		case ";":
+		case "option", "reserved":
+			p.skipStatement()
+		default:
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			number, err := strconv.ParseInt(p.next(), 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("неверное значение %s: %w", tok, err)
+			}
+			enum.Value = append(enum.Value, &descriptorpb.EnumValueDescriptorProto{
+				Name:   proto.String(tok),
+				Number: proto.Int32(int32(number)),
+			})
+			if p.peek() == "[" {
+				for p.peek() != "]" && p.peek() != "" {
+					p.next()
+				}
+				p.next()
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// resolveProtoTypes заменяет относительные имена типов полей на полные (".pkg.Msg")
+// и проставляет тип поля MESSAGE или ENUM, как это делает protoc
+func resolveProtoTypes(fdp *descriptorpb.FileDescriptorProto) error {
+	kinds := make(map[string]descriptorpb.FieldDescriptorProto_Type)
+	prefix := ""
+	if fdp.GetPackage() != "" {
+		prefix = fdp.GetPackage() + "."
+	}
+
+	var collect func(scope string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto)
+	collect = func(scope string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto) {
+		for _, e := range enums {
+			kinds[scope+e.GetName()] = descriptorpb.FieldDescriptorProto_TYPE_ENUM
+		}
+		for _, m := range msgs {
+			kinds[scope+m.GetName()] = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+			collect(scope+m.GetName()+".", m.GetNestedType(), m.GetEnumType())
+		}
+	}
+	collect(prefix, fdp.GetMessageType(), fdp.GetEnumType())
+
+	var resolve func(scope string, msgs []*descriptorpb.DescriptorProto) error
+	resolve = func(scope string, msgs []*descriptorpb.DescriptorProto) error {
+		for _, m := range msgs {
+			msgScope := scope + m.GetName()
+			for _, f := range m.GetField() {
+				if f.TypeName == nil {
+					continue
+				}
+				full, kind, ok := lookupProtoType(kinds, msgScope, f.GetTypeName())
+				if !ok {
+					return fmt.Errorf("неизвестный тип %q в поле %s.%s", f.GetTypeName(), m.GetName(), f.GetName())
+				}
+				f.TypeName = proto.String("." + full)
+				f.Type = kind.Enum()
+			}
+			if err := resolve(msgScope+".", m.GetNestedType()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return resolve(prefix, fdp.GetMessageType())
+}
+
+// lookupProtoType ищет тип по правилам областей видимости protobuf: от текущего
+// сообщения наружу до корня
+func lookupProtoType(kinds map[string]descriptorpb.FieldDescriptorProto_Type, scope, name string) (string, descriptorpb.FieldDescriptorProto_Type, bool) {
+	if full, ok := strings.CutPrefix(name, "."); ok {
+		kind, found := kinds[full]
+		return full, kind, found
+	}
+
+	for {
+		candidate := name
+		if scope != "" {
+			candidate = scope + "." + name
+		}
+		if kind, ok := kinds[candidate]; ok {
+			return candidate, kind, true
+		}
+		if scope == "" {
+			return "", 0, false
+		}
+		if i := strings.LastIndex(scope, "."); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package decoder
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Модуль Range Test отправляет текст вида "seq 42"
+var rangeTestSeqRe = regexp.MustCompile(`(?i)seq\s*(\d+)`)
+
+const (
+	// rangeTestReorderWindow - насколько номер может отстать от последнего, чтобы пакет
+	// считался опоздавшим или повтором, а не началом новой сессии
+	rangeTestReorderWindow = 5
+	// rangeTestDupWindow - копии одного пакета через MQTT приходят в пределах этого окна,
+	// тот же номер позже - уже новая сессия перезапущенного отправителя
+	rangeTestDupWindow = 30 * time.Second
+	// rangeTestSessionGap - после такой паузы отставший номер считается началом новой сессии
+	rangeTestSessionGap = 5 * time.Minute
+)
+
+// decodeRangeTest извлекает номер последовательности из текста Range Test
+func decodeRangeTest(payload []byte, record *CSVRecord) {
+	text := strings.TrimSpace(string(payload))
+	match := rangeTestSeqRe.FindStringSubmatch(text)
+	if match == nil {
+		record.Error = fmt.Sprintf("Не найден номер последовательности Range Test: %q", text)
+		return
+	}
+	record.RangeTestSeq = match[1]
+}
+
+// rangeTestPacket - один принятый пакет Range Test
+type rangeTestPacket struct {
+	Timestamp string
+	Seq       uint64
+	Missed    uint64
+	Latitude  string
+	Longitude string
+	SNR       string
+	RSSI      string
+}
+
+// rangeTestPair - статистика по паре (отправитель, шлюз)
+type rangeTestPair struct {
+	Sender   string
+	Gateway  string
+	Packets  []rangeTestPacket
+	received map[uint64]time.Time
+	// Счетчики по сессиям: при перезапуске отправителя нумерация начинается заново
+	expected uint64
+	first    uint64
+	last     uint64
+	lastAt   time.Time
+}
+
+// rangeTestTracker собирает пакеты Range Test и последние известные позиции отправителей
+type rangeTestTracker struct {
+	pairs     map[string]*rangeTestPair
+	positions map[string][2]string
+}
+
+func newRangeTestTracker() *rangeTestTracker {
+	return &rangeTestTracker{
+		pairs:     make(map[string]*rangeTestPair),
+		positions: make(map[string][2]string),
+	}
+}
+
+// Observe учитывает очередную запись. Записи нужно передавать в порядке захвата,
+// чтобы позиция отправителя соответствовала моменту приема пакета.
+func (t *rangeTestTracker) Observe(record *CSVRecord) {
+	if record.From != "" && record.Latitude != "" && record.Longitude != "" {
+		t.positions[record.From] = [2]string{record.Latitude, record.Longitude}
+	}
+
+	if record.RangeTestSeq == "" {
+		return
+	}
+	seq, err := strconv.ParseUint(record.RangeTestSeq, 10, 64)
+	if err != nil {
+		return
+	}
+
+	key := record.From + "|" + record.GatewayID
+	pair, ok := t.pairs[key]
+	if !ok {
+		pair = &rangeTestPair{
+			Sender:   record.From,
+			Gateway:  record.GatewayID,
+			received: make(map[uint64]time.Time),
+		}
+		t.pairs[key] = pair
+	}
+
+	at, _ := parseTimestamp(record.Timestamp)
+	gap := !at.IsZero() && !pair.lastAt.IsZero() && at.Sub(pair.lastAt) > rangeTestSessionGap
+	seenAt, seen := pair.received[seq]
+	duplicate := seen && (at.IsZero() || seenAt.IsZero() || at.Sub(seenAt) <= rangeTestDupWindow)
+
+	packet := rangeTestPacket{
+		Timestamp: record.Timestamp,
+		Seq:       seq,
+		SNR:       record.RxSNR,
+		RSSI:      record.RxRSSI,
+	}
+	if pos, ok := t.positions[record.From]; ok {
+		packet.Latitude, packet.Longitude = pos[0], pos[1]
+	}
+
+	// Повтором считается только тот же номер в пределах rangeTestDupWindow: перезапущенный
+	// отправитель снова шлет seq 1, 2, ..., и эти номера уже есть в принятых за прошлую сессию
+	switch {
+	case len(pair.received) == 0:
+		pair.first, pair.last = seq, seq
+		pair.expected = 1
+	case seq > pair.last:
+		packet.Missed = seq - pair.last - 1
+		pair.expected += seq - pair.last
+		pair.last = seq
+	case duplicate:
+		// Повтор того же пакета (например через MQTT дважды) не считаем
+		return
+	case !gap && pair.last-seq <= rangeTestReorderWindow && !seen:
+		if seq < pair.first {
+			// Пакет из начала сессии пришел позже остальных
+			pair.expected += pair.first - seq
+			pair.first = seq
+		}
+	default:
+		// Номер ушел назад дальше окна или повторился после долгой паузы -
+		// отправитель перезапущен, начинаем новую сессию
+		pair.first, pair.last = seq, seq
+		pair.expected++
+		pair.received = make(map[uint64]time.Time)
+	}
+	if at.After(pair.lastAt) {
+		pair.lastAt = at
+	}
+	pair.received[seq] = at
+	pair.Packets = append(pair.Packets, packet)
+}
+
+// Received возвращает количество уникальных принятых пакетов
+func (p *rangeTestPair) Received() uint64 {
+	return uint64(len(p.Packets))
+}
+
+// LossPercent возвращает долю потерянных пакетов в процентах
+func (p *rangeTestPair) LossPercent() float64 {
+	if p.expected == 0 || p.Received() >= p.expected {
+		return 0
+	}
+	return float64(p.expected-p.Received()) / float64(p.expected) * 100
+}
+
+// sortedPairs возвращает пары в стабильном порядке для отчета
+func (t *rangeTestTracker) sortedPairs() []*rangeTestPair {
+	pairs := make([]*rangeTestPair, 0, len(t.pairs))
+	for _, pair := range t.pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Sender != pairs[j].Sender {
+			return pairs[i].Sender < pairs[j].Sender
+		}
+		return pairs[i].Gateway < pairs[j].Gateway
+	})
+	return pairs
+}
+
+// WriteReport пишет сводку по парам в path и подробности по пакетам в <path>_packets.csv
+func (t *rangeTestTracker) WriteReport(path string) error {
+	pairs := t.sortedPairs()
+
+	summary := [][]string{{"Sender", "SenderID", "GatewayID", "Received", "Expected", "Lost", "LossPercent"}}
+	for _, pair := range pairs {
+		summary = append(summary, []string{
+			pair.Sender, NodeIDFromString(pair.Sender), pair.Gateway,
+			fmt.Sprintf("%d", pair.Received()), fmt.Sprintf("%d", pair.expected),
+			fmt.Sprintf("%d", pair.expected-pair.Received()), fmt.Sprintf("%.1f", pair.LossPercent()),
+		})
+	}
+	if err := writeCSVFile(path, summary); err != nil {
+		return err
+	}
+
+	packets := [][]string{{"Sender", "SenderID", "GatewayID", "Timestamp", "Seq", "MissedBefore",
+		"SenderLatitude", "SenderLongitude", "RxSNR", "RxRSSI"}}
+	for _, pair := range pairs {
+		for _, p := range pair.Packets {
+			packets = append(packets, []string{
+				pair.Sender, NodeIDFromString(pair.Sender), pair.Gateway, p.Timestamp,
+				fmt.Sprintf("%d", p.Seq), fmt.Sprintf("%d", p.Missed),
+				p.Latitude, p.Longitude, p.SNR, p.RSSI,
+			})
+		}
+	}
+	return writeCSVFile(withSuffix(path, "_packets"), packets)
+}
+
+// PrintSummary выводит сводку в консоль
+func (t *rangeTestTracker) PrintSummary() {
+	for _, pair := range t.sortedPairs() {
+		fmt.Printf("Range Test %s -> %s: принято %d из %d, потери %.1f%%\n",
+			NodeIDFromString(pair.Sender), pair.Gateway, pair.Received(), pair.expected, pair.LossPercent())
+	}
+}
+
+// writeCSVFile создает CSV файл и записывает в него все строки
+func writeCSVFile(path string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("ошибка записи %s: %w", path, err)
+	}
+	return nil
+}
+
+// withSuffix добавляет суффикс к имени файла перед расширением: report.csv -> report_packets.csv
+func withSuffix(path, suffix string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + suffix + ext
+}
@@ -0,0 +1,70 @@
+package decoder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRangeTestSessions(t *testing.T) {
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.Local)
+	type rx struct {
+		seq uint64
+		at  time.Duration
+	}
+	tests := []struct {
+		name     string
+		packets  []rx
+		received uint64
+		expected uint64
+	}{
+		{
+			name:     "loss",
+			packets:  []rx{{1, 0}, {2, time.Minute}, {5, 4 * time.Minute}},
+			received: 3, expected: 5,
+		},
+		{
+			name:     "mqtt duplicate",
+			packets:  []rx{{1, 0}, {2, time.Minute}, {2, time.Minute + time.Second}, {3, 2 * time.Minute}},
+			received: 3, expected: 3,
+		},
+		{
+			name:     "late packet",
+			packets:  []rx{{1, 0}, {3, 2 * time.Minute}, {2, 2*time.Minute + time.Second}},
+			received: 3, expected: 3,
+		},
+		{
+			// Перезапуск после нескольких пакетов: номера 1 и 2 уже приняты в прошлой сессии
+			name:     "short restart",
+			packets:  []rx{{1, 0}, {2, time.Minute}, {3, 2 * time.Minute}, {1, 3 * time.Minute}, {2, 4 * time.Minute}, {4, 6 * time.Minute}},
+			received: 6, expected: 7,
+		},
+		{
+			name:     "restart after pause",
+			packets:  []rx{{1, 0}, {2, time.Minute}, {2, time.Hour}, {3, time.Hour + time.Minute}},
+			received: 4, expected: 4,
+		},
+		{
+			name:     "long restart",
+			packets:  []rx{{200, 0}, {201, time.Minute}, {1, 2 * time.Minute}},
+			received: 3, expected: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newRangeTestTracker()
+			for _, p := range tt.packets {
+				tracker.Observe(&CSVRecord{
+					Timestamp:    start.Add(p.at).Format("20060102_150405"),
+					From:         "1",
+					GatewayID:    "!00000002",
+					RangeTestSeq: fmt.Sprint(p.seq),
+				})
+			}
+			pair := tracker.pairs["1|!00000002"]
+			if pair.Received() != tt.received || pair.expected != tt.expected {
+				t.Errorf("received/expected = %d/%d, want %d/%d", pair.Received(), pair.expected, tt.received, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// PayloadDecoder декодирует payload одного portnum: собственного модуля прошивки или
+// встроенного, если его нужно разобрать иначе, чем это делает decodeData. Результат пишется в колонки CustomDecoder/CustomValues (или в общие колонки записи).
+type PayloadDecoder interface {
+	// Name возвращает имя декодера для колонки CustomDecoder
+	Name() string
+	// Decode разбирает payload и заполняет запись
+	Decode(payload []byte, record *CSVRecord) error
+}
+
+// payloadDecoders - зарегистрированные декодеры по portnum
+var payloadDecoders = make(map[generated.PortNum]PayloadDecoder)
+
+// RegisterPayloadDecoder регистрирует декодер для portnum. Декодер вызывается вместо
+// встроенного разбора decodeData, в том числе для стандартных portnum. Декларативные
+// декодеры регистрируются из файла, переданного флагом -decoders.
+func RegisterPayloadDecoder(portnum generated.PortNum, decoder PayloadDecoder) {
+	payloadDecoders[portnum] = decoder
+}
+
+// decodeRegistered вызывает зарегистрированный декодер. Возвращает false, если декодера нет.
+func decodeRegistered(portnum generated.PortNum, payload []byte, record *CSVRecord) bool {
+	decoder, ok := payloadDecoders[portnum]
+	if !ok {
+		return false
+	}
+
+	record.CustomDecoder = decoder.Name()
+	if err := decoder.Decode(payload, record); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования %s: %v", decoder.Name(), err)
+	}
+	return true
+}
+
+// decoderConfig - описание декларативного декодера в JSON файле:
+//
+//	[
+//	  {"portnum": 256, "name": "weather", "proto": "weather.proto", "message": "arkh.Weather"},
+//	  {"portnum": 287, "name": "counter", "layout": "version:u8 count:u16 temp:i16/10 label:str"}
+//	]
+type decoderConfig struct {
+	Portnum int    `json:"portnum"`
+	Name    string `json:"name"`
+	Proto   string `json:"proto,omitempty"`
+	Message string `json:"message,omitempty"`
+	Layout  string `json:"layout,omitempty"`
+}
+
+// loadDecoderConfig читает файл описаний и регистрирует декодеры.
+// Пути к .proto файлам считаются относительно файла конфигурации.
+func loadDecoderConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", path, err)
+	}
+
+	var configs []decoderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("ошибка разбора %s: %w", path, err)
+	}
+
+	for _, cfg := range configs {
+		if cfg.Portnum <= 0 {
+			return fmt.Errorf("декодер %q: не указан portnum", cfg.Name)
+		}
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("portnum_%d", cfg.Portnum)
+		}
+
+		var decoder PayloadDecoder
+		switch {
+		case cfg.Proto != "" && cfg.Layout != "":
+			return fmt.Errorf("декодер %q: нужно указать либо proto, либо layout", cfg.Name)
+		case cfg.Proto != "":
+			protoPath := cfg.Proto
+			if !filepath.IsAbs(protoPath) {
+				protoPath = filepath.Join(filepath.Dir(path), protoPath)
+			}
+			decoder, err = newProtoDecoder(cfg.Name, protoPath, cfg.Message)
+		case cfg.Layout != "":
+			decoder, err = newLayoutDecoder(cfg.Name, cfg.Layout)
+		default:
+			return fmt.Errorf("декодер %q: не указан proto или layout", cfg.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("декодер %q: %w", cfg.Name, err)
+		}
+
+		RegisterPayloadDecoder(generated.PortNum(cfg.Portnum), decoder)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package decoder
+
+import (
+	"testing"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+type upperDecoder struct{}
+
+func (upperDecoder) Name() string { return "upper" }
+
+func (upperDecoder) Decode(payload []byte, record *CSVRecord) error {
+	record.CustomValues = "text=" + string(payload)
+	return nil
+}
+
+func TestRegisteredDecoderOverridesBuiltin(t *testing.T) {
+	for _, portnum := range []generated.PortNum{generated.PortNum_TEXT_MESSAGE_APP, generated.PortNum_PRIVATE_APP} {
+		t.Run(portnum.String(), func(t *testing.T) {
+			RegisterPayloadDecoder(portnum, upperDecoder{})
+			defer delete(payloadDecoders, portnum)
+
+			var record CSVRecord
+			decodeData(&generated.Data{Portnum: portnum, Payload: []byte("hello")}, &record)
+			if record.CustomDecoder != "upper" || record.CustomValues != "text=hello" || record.TextMessage != "" {
+				t.Errorf("record = decoder %q values %q text %q", record.CustomDecoder, record.CustomValues, record.TextMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package decoder
+
+import (
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTTOptions - подключение к брокеру для PublishMQTT
+type MQTTOptions struct {
+	// Broker - адрес брокера (tcp://host:1883)
+	Broker string
+	// User и Password - учетные данные, пустой User - без авторизации
+	User, Password string
+	// Timeout ограничивает подключение и публикацию, 0 - 10 секунд
+	Timeout time.Duration
+}
+
+// PublishMQTT публикует сообщение (например собранное EncodeTextMessage) в топик
+// topic с QoS 1 и дожидается подтверждения брокера
+func PublishMQTT(opts MQTTOptions, topic string, payload []byte) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	clientOpts := mqtt.NewClientOptions()
+	clientOpts.AddBroker(opts.Broker)
+	clientOpts.SetClientID("go_mqtt_send_" + fmt.Sprint(time.Now().Unix()))
+	clientOpts.SetConnectTimeout(opts.Timeout)
+	if opts.User != "" {
+		clientOpts.SetUsername(opts.User)
+		clientOpts.SetPassword(opts.Password)
+	}
+	client := mqtt.NewClient(clientOpts)
+	if token := client.Connect(); !token.WaitTimeout(opts.Timeout) || token.Error() != nil {
+		return fmt.Errorf("ошибка подключения к %s: %w", opts.Broker, tokenError(token))
+	}
+	defer client.Disconnect(250)
+
+	if token := client.Publish(topic, 1, false, payload); !token.WaitTimeout(opts.Timeout) || token.Error() != nil {
+		return fmt.Errorf("ошибка публикации в %s: %w", topic, tokenError(token))
+	}
+	return nil
+}
+
+// tokenError возвращает ошибку операции MQTT или признак таймаута
+func tokenError(token mqtt.Token) error {
+	if err := token.Error(); err != nil {
+		return err
+	}
+	return fmt.Errorf("таймаут")
+}
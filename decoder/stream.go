@@ -0,0 +1,504 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Таймауты соединения WebSocket
+const (
+	streamWriteWait  = 10 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = 30 * time.Second
+	// Повторные копии пакета через другие шлюзы помечаются duplicate в течение этого окна
+	streamDuplicateWindow = time.Minute
+)
+
+// Буфер клиента по умолчанию, сообщений
+const DefaultStreamBuffer = 256
+
+// streamPacket - пакет в потоке
+type streamPacket struct {
+	Time      time.Time          `json:"time"`
+	Topic     string             `json:"topic"`
+	Channel   string             `json:"channel,omitempty"`
+	Gateway   string             `json:"gateway,omitempty"`
+	From      string             `json:"from,omitempty"`
+	FromName  string             `json:"from_name,omitempty"`
+	To        string             `json:"to,omitempty"`
+	ID        string             `json:"id,omitempty"`
+	Portnum   string             `json:"portnum,omitempty"`
+	HopsAway  *int               `json:"hops_away,omitempty"`
+	SNR       *float64           `json:"snr,omitempty"`
+	RSSI      *int               `json:"rssi,omitempty"`
+	Text      string             `json:"text,omitempty"`
+	IsAlert   bool               `json:"is_alert"`
+	Position  *apiPosition       `json:"position,omitempty"`
+	Telemetry map[string]float64 `json:"telemetry,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Duplicate bool               `json:"duplicate,omitempty"`
+}
+
+// streamNodeState - переход состояния узла в потоке
+type streamNodeState struct {
+	Time      time.Time `json:"time"`
+	Node      string    `json:"node"`
+	Name      string    `json:"name,omitempty"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	LastHeard time.Time `json:"last_heard"`
+	Silence   float64   `json:"silence_s"`
+}
+
+// streamMessage - сообщение клиенту: type = packet, node_state, geofence или dropped
+type streamMessage struct {
+	Type      string            `json:"type"`
+	Packet    *streamPacket     `json:"packet,omitempty"`
+	NodeState *streamNodeState  `json:"node_state,omitempty"`
+	Geofence  *apiGeofenceEvent `json:"geofence,omitempty"`
+	// Dropped - сколько сообщений не поместилось в буфер клиента с прошлого уведомления
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+// streamMeta - поля, по которым фильтруются сообщения
+type streamMeta struct {
+	Type      string
+	Channel   string
+	Nodes     []string
+	Portnum   string
+	Position  *geoPosition
+	Duplicate bool
+	Alert     bool
+}
+
+// streamFilter - фильтр клиента. Задается параметрами URL при подключении
+// (/ws?channel=LongFast&node=!a1b2c3d4&portnum=TEXT_MESSAGE_APP&area=64.5,40.4,64.6,40.7)
+// и может быть заменен JSON сообщением клиента с теми же ключами:
+// {"channel": "LongFast", "portnum": "TEXT_MESSAGE_APP,POSITION_APP"}.
+// Пустой фильтр пропускает все, значения внутри ключа объединяются через запятую.
+// alert=true оставляет из пакетов только тревоги ALERT_APP.
+type streamFilter struct {
+	Types      map[string]bool
+	Channels   map[string]bool
+	Nodes      map[string]bool
+	Portnums   map[string]bool
+	Area       *[4]float64 // minLat, minLon, maxLat, maxLon
+	Duplicates bool
+	Alerts     bool
+}
+
+func splitList(value string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+// parseStreamFilter разбирает фильтр из пар ключ-значение
+func parseStreamFilter(get func(key string) string) (streamFilter, error) {
+	f := streamFilter{
+		Types:    splitList(get("types")),
+		Channels: splitList(get("channel")),
+		Portnums: splitList(get("portnum")),
+	}
+	var err error
+	if f.Nodes, err = parseNodeList(get("node")); err != nil {
+		return f, err
+	}
+	if v := get("duplicates"); v != "" {
+		if f.Duplicates, err = strconv.ParseBool(v); err != nil {
+			return f, fmt.Errorf("неверное значение duplicates %q", v)
+		}
+	}
+	if v := get("alert"); v != "" {
+		if f.Alerts, err = strconv.ParseBool(v); err != nil {
+			return f, fmt.Errorf("неверное значение alert %q", v)
+		}
+	}
+	if v := get("area"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return f, fmt.Errorf("area задается как lat1,lon1,lat2,lon2")
+		}
+		var box [4]float64
+		for i, p := range parts {
+			if box[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+				return f, fmt.Errorf("неверная координата area %q", p)
+			}
+		}
+		f.Area = &[4]float64{min(box[0], box[2]), min(box[1], box[3]), max(box[0], box[2]), max(box[1], box[3])}
+	}
+	return f, nil
+}
+
+// Match проверяет, нужно ли сообщение клиенту. Фильтры channel, portnum и alert относятся
+// только к пакетам, node и area - к пакетам, переходам состояния узлов и событиям геозон.
+func (f streamFilter) Match(m streamMeta) bool {
+	if len(f.Types) > 0 && !f.Types[m.Type] {
+		return false
+	}
+	if m.Type == "packet" {
+		if m.Duplicate && !f.Duplicates {
+			return false
+		}
+		if len(f.Channels) > 0 && !f.Channels[m.Channel] {
+			return false
+		}
+		if len(f.Portnums) > 0 && !f.Portnums[m.Portnum] {
+			return false
+		}
+		if f.Alerts && !m.Alert {
+			return false
+		}
+	}
+	if len(f.Nodes) > 0 {
+		found := false
+		for _, n := range m.Nodes {
+			found = found || f.Nodes[n]
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Area != nil {
+		p := m.Position
+		if p == nil || p.Lat < f.Area[0] || p.Lon < f.Area[1] || p.Lat > f.Area[2] || p.Lon > f.Area[3] {
+			return false
+		}
+	}
+	return true
+}
+
+// streamClient - подключенный клиент с собственным буфером
+type streamClient struct {
+	conn    *websocket.Conn
+	send    chan []byte
+	mu      sync.Mutex
+	filter  streamFilter
+	dropped atomic.Int64
+	slow    atomic.Bool
+}
+
+func (c *streamClient) match(m streamMeta) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.filter.Match(m)
+}
+
+// StreamHub рассылает декодированные пакеты и переходы состояния узлов клиентам
+// WebSocket. Рассылка никогда не блокируется: если буфер клиента полон, сообщение
+// для него отбрасывается, а клиент получает уведомление dropped, когда догонит поток.
+// Клиент, потерявший больше четырех буферов подряд, отключается.
+type StreamHub struct {
+	mu         sync.Mutex
+	bufferSize int
+	clients    map[*streamClient]bool
+	positions  map[string]geoPosition
+	names      map[string]string
+	recent     map[string]time.Time
+	upgrader   websocket.Upgrader
+	// AllowedOrigins - Origin страниц с других адресов, которым разрешено подключаться
+	// ("https://panel.example.org"), "*" - любым. Страницы с того же адреса и клиенты
+	// без заголовка Origin (не браузеры) подключаются всегда.
+	AllowedOrigins []string
+}
+
+// NewStreamHub создает рассылку с буфером bufferSize сообщений на клиента
+func NewStreamHub(bufferSize int) *StreamHub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultStreamBuffer
+	}
+	h := &StreamHub{
+		bufferSize: bufferSize,
+		clients:    make(map[*streamClient]bool),
+		positions:  make(map[string]geoPosition),
+		names:      make(map[string]string),
+		recent:     make(map[string]time.Time),
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	return h
+}
+
+// checkOrigin пропускает страницы с того же адреса и из AllowedOrigins, чтобы чужой
+// сайт не мог читать поток из браузера пользователя
+func (h *StreamHub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.AllowedOrigins {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clients возвращает число подключенных клиентов
+func (h *StreamHub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// PublishRecord рассылает декодированную запись
+func (h *StreamHub) PublishRecord(record *CSVRecord) {
+	at, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	packet := &streamPacket{
+		Time: at, Topic: record.Topic, Channel: record.ChannelID, Gateway: record.GatewayID,
+		ID: record.PacketID, Portnum: record.PortnumName, Text: record.TextMessage,
+		IsAlert: record.IsAlert == "true", Error: record.Error,
+	}
+	meta := streamMeta{Type: "packet", Channel: record.ChannelID, Portnum: record.PortnumName, Alert: packet.IsAlert}
+	if record.From != "" {
+		packet.From = NodeIDFromString(record.From)
+		meta.Nodes = append(meta.Nodes, packet.From)
+		if name := firstNonEmpty(record.UserLongName, record.MapLongName); name != "" {
+			h.names[packet.From] = name
+		}
+		packet.FromName = h.names[packet.From]
+	}
+	if record.To != "" {
+		packet.To = NodeIDFromString(record.To)
+		meta.Nodes = append(meta.Nodes, packet.To)
+	}
+	if hops, err := strconv.Atoi(record.HopsAway); err == nil {
+		packet.HopsAway = &hops
+	}
+	if snr, err := strconv.ParseFloat(record.RxSNR, 64); err == nil {
+		packet.SNR = &snr
+	}
+	if rssi, err := strconv.Atoi(record.RxRSSI); err == nil {
+		packet.RSSI = &rssi
+	}
+	if pos, ok := recordPosition(record); ok {
+		packet.Position = newAPIPosition(pos, record, at)
+		if packet.From != "" {
+			h.positions[packet.From] = pos
+		}
+	}
+	if len(record.metrics) > 0 {
+		packet.Telemetry = make(map[string]float64, len(record.metrics))
+		for _, m := range record.metrics {
+			packet.Telemetry[m.Name] = m.Value
+		}
+	}
+	if pos, ok := h.positions[packet.From]; ok {
+		meta.Position = &pos
+	}
+
+	if packet.ID != "" && packet.ID != "0" {
+		key := packet.From + "|" + packet.ID
+		if seen, ok := h.recent[key]; ok && at.Sub(seen) < streamDuplicateWindow {
+			packet.Duplicate = true
+		} else {
+			h.recent[key] = at
+		}
+		for k, seen := range h.recent {
+			if at.Sub(seen) >= streamDuplicateWindow {
+				delete(h.recent, k)
+			}
+		}
+	}
+	meta.Duplicate = packet.Duplicate
+
+	h.publish(meta, streamMessage{Type: "packet", Packet: packet})
+}
+
+// PublishPresence рассылает переход состояния узла
+func (h *StreamHub) PublishPresence(event PresenceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from := string(event.From)
+	if event.From == PresenceUnknown {
+		from = "new"
+	}
+	meta := streamMeta{Type: "node_state", Nodes: []string{event.Node}}
+	if pos, ok := h.positions[event.Node]; ok {
+		meta.Position = &pos
+	}
+	h.publish(meta, streamMessage{Type: "node_state", NodeState: &streamNodeState{
+		Time: event.Time, Node: event.Node, Name: event.Name, From: from, To: string(event.To),
+		LastHeard: event.LastHeard, Silence: event.Silence().Seconds(),
+	}})
+}
+
+// PublishGeofence рассылает вход узла в геозону или выход из нее
+func (h *StreamHub) PublishGeofence(event GeofenceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pos := geoPosition{Lat: event.Lat, Lon: event.Lon, Uncertainty: event.Uncertainty}
+	meta := streamMeta{Type: "geofence", Nodes: []string{event.Node}, Position: &pos}
+	h.publish(meta, streamMessage{Type: "geofence", Geofence: newAPIGeofenceEvent(event)})
+}
+
+// publish кодирует сообщение один раз и кладет его в буферы подходящих клиентов
+func (h *StreamHub) publish(meta streamMeta, message streamMessage) {
+	if len(h.clients) == 0 {
+		return
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	for c := range h.clients {
+		if !c.match(meta) {
+			continue
+		}
+		select {
+		case c.send <- data:
+		default:
+			if c.dropped.Add(1) > int64(4*h.bufferSize) {
+				log.Printf("WebSocket client %s is too slow, disconnecting", c.conn.RemoteAddr())
+				c.slow.Store(true)
+				h.remove(c)
+			}
+		}
+	}
+}
+
+// remove отключает клиента; вызывается под h.mu
+func (h *StreamHub) remove(c *streamClient) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// ServeHTTP принимает подключение WebSocket
+func (h *StreamHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStreamFilter(r.URL.Query().Get)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &streamClient{conn: conn, send: make(chan []byte, h.bufferSize), filter: filter}
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+
+	go h.writeLoop(c)
+	h.readLoop(c)
+}
+
+// readLoop принимает новые фильтры клиента и ответы на ping
+func (h *StreamHub) readLoop(c *streamClient) {
+	defer func() {
+		h.mu.Lock()
+		h.remove(c)
+		h.mu.Unlock()
+	}()
+
+	c.conn.SetReadLimit(64 * 1024)
+	c.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var values map[string]any
+		if err := json.Unmarshal(data, &values); err != nil {
+			h.sendError(c, fmt.Errorf("фильтр должен быть JSON объектом: %w", err))
+			continue
+		}
+		filter, err := parseStreamFilter(func(key string) string {
+			if v, ok := values[key]; ok && v != nil {
+				return fmt.Sprint(v)
+			}
+			return ""
+		})
+		if err != nil {
+			h.sendError(c, err)
+			continue
+		}
+		c.mu.Lock()
+		c.filter = filter
+		c.mu.Unlock()
+	}
+}
+
+// sendError отправляет клиенту ошибку разбора фильтра, если в буфере есть место.
+// Буфер проверяется под h.mu: медленного клиента publish мог уже отключить и закрыть send.
+func (h *StreamHub) sendError(c *streamClient, err error) {
+	data, _ := json.Marshal(map[string]string{"type": "error", "error": err.Error()})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.clients[c] {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
+// writeLoop отправляет сообщения из буфера клиента и поддерживает соединение ping
+func (h *StreamHub) writeLoop(c *streamClient) {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	write := func(kind int, data []byte) error {
+		c.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		return c.conn.WriteMessage(kind, data)
+	}
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				if c.slow.Load() {
+					write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer"))
+				}
+				return
+			}
+			if err := write(websocket.TextMessage, data); err != nil {
+				return
+			}
+			if dropped := c.dropped.Swap(0); dropped > 0 {
+				notice, _ := json.Marshal(streamMessage{Type: "dropped", Dropped: dropped})
+				if err := write(websocket.TextMessage, notice); err != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := write(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package decoder
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamHubCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{name: "no origin", want: true},
+		{name: "same host", origin: "http://collector.local:8080", want: true},
+		{name: "other host", origin: "https://evil.example.org"},
+		{name: "other port", origin: "http://collector.local:9000"},
+		{name: "allowed", origin: "https://panel.example.org", allowed: []string{"https://other.org", " https://panel.example.org/"}, want: true},
+		{name: "any", origin: "https://evil.example.org", allowed: []string{"*"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewStreamHub(0)
+			h.AllowedOrigins = tt.allowed
+			r := httptest.NewRequest("GET", "http://collector.local:8080/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := h.checkOrigin(r); got != tt.want {
+				t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package decoder
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+// decodeTAK разбирает TAKPacket официального ATAK плагина (PLI, GeoChat, Contact, Group, Status)
+func decodeTAK(payload []byte, record *CSVRecord) {
+	var tak generated.TAKPacket
+	if err := proto.Unmarshal(payload, &tak); err != nil {
+		record.Error = fmt.Sprintf("Ошибка декодирования TAKPacket: %v", err)
+		return
+	}
+
+	record.tak = &tak
+	record.TakCompressed = boolToString(tak.GetIsCompressed())
+
+	if contact := tak.GetContact(); contact != nil {
+		record.TakCallsign = contact.GetCallsign()
+		record.TakDeviceCallsign = contact.GetDeviceCallsign()
+	}
+	if group := tak.GetGroup(); group != nil {
+		record.TakTeam = cotTeamName(group.GetTeam())
+		record.TakRole = cotRoleName(group.GetRole())
+	}
+	if status := tak.GetStatus(); status != nil {
+		record.TakBattery = fmt.Sprintf("%d", status.GetBattery())
+	}
+
+	switch {
+	case tak.GetPli() != nil:
+		pli := tak.GetPli()
+		record.TakVariant = "PLI"
+		lat := float64(pli.GetLatitudeI()) / 1e7
+		lon := float64(pli.GetLongitudeI()) / 1e7
+		if lat != 0 || lon != 0 {
+			record.Latitude = fmt.Sprintf("%.7f", lat)
+			record.Longitude = fmt.Sprintf("%.7f", lon)
+			record.Altitude = fmt.Sprintf("%d", pli.GetAltitude())
+		}
+		record.TakSpeed = fmt.Sprintf("%d", pli.GetSpeed())
+		record.TakCourse = fmt.Sprintf("%d", pli.GetCourse())
+	case tak.GetChat() != nil:
+		chat := tak.GetChat()
+		record.TakVariant = "GeoChat"
+		record.TextMessage = chat.GetMessage()
+		record.TakChatTo = chat.GetTo()
+		record.TakChatToCallsign = chat.GetToCallsign()
+	case tak.GetDetail() != nil:
+		record.TakVariant = "Detail"
+	}
+
+	// Строки сжатые unishox2 оставляем как есть - распаковка не поддерживается
+	if tak.GetIsCompressed() {
+		record.Error = "TAKPacket сжат (unishox2), строковые поля не распакованы"
+	}
+}
+
+// cotTeamName возвращает имя команды в формате ATAK ("Dark Blue", "Cyan"...)
+func cotTeamName(team generated.Team) string {
+	if team == generated.Team_Unspecifed_Color {
+		return "Cyan"
+	}
+	return strings.ReplaceAll(team.String(), "_", " ")
+}
+
+// cotRoleName возвращает роль участника в формате ATAK ("Team Member", "HQ"...)
+func cotRoleName(role generated.MemberRole) string {
+	switch role {
+	case generated.MemberRole_Unspecifed, generated.MemberRole_TeamMember:
+		return "Team Member"
+	case generated.MemberRole_TeamLead:
+		return "Team Lead"
+	case generated.MemberRole_ForwardObserver:
+		return "Forward Observer"
+	default:
+		return role.String()
+	}
+}
+
+// Структуры Cursor-on-Target события в объеме, достаточном для ATAK/WinTAK
+type cotEvent struct {
+	XMLName xml.Name  `xml:"event"`
+	Version string    `xml:"version,attr"`
+	UID     string    `xml:"uid,attr"`
+	Type    string    `xml:"type,attr"`
+	How     string    `xml:"how,attr"`
+	Time    string    `xml:"time,attr"`
+	Start   string    `xml:"start,attr"`
+	Stale   string    `xml:"stale,attr"`
+	Point   cotPoint  `xml:"point"`
+	Detail  cotDetail `xml:"detail"`
+}
+
+// Координаты храним строками, чтобы encoding/xml не переводил их в экспоненциальную запись
+type cotPoint struct {
+	Lat string `xml:"lat,attr"`
+	Lon string `xml:"lon,attr"`
+	Hae string `xml:"hae,attr"`
+	Ce  string `xml:"ce,attr"`
+	Le  string `xml:"le,attr"`
+}
+
+type cotDetail struct {
+	Contact *cotContact `xml:"contact,omitempty"`
+	Group   *cotGroup   `xml:"__group,omitempty"`
+	Status  *cotStatus  `xml:"status,omitempty"`
+	Track   *cotTrack   `xml:"track,omitempty"`
+	UID     *cotUID     `xml:"uid,omitempty"`
+	Chat    *cotChat    `xml:"__chat,omitempty"`
+	Link    *cotLink    `xml:"link,omitempty"`
+	Remarks *cotRemarks `xml:"remarks,omitempty"`
+}
+
+type cotContact struct {
+	Callsign string `xml:"callsign,attr"`
+	Endpoint string `xml:"endpoint,attr,omitempty"`
+}
+
+type cotGroup struct {
+	Name string `xml:"name,attr"`
+	Role string `xml:"role,attr"`
+}
+
+type cotStatus struct {
+	Battery uint32 `xml:"battery,attr"`
+}
+
+type cotTrack struct {
+	Speed  uint32 `xml:"speed,attr"`
+	Course uint32 `xml:"course,attr"`
+}
+
+type cotUID struct {
+	Droid string `xml:"Droid,attr"`
+}
+
+type cotChat struct {
+	Parent         string     `xml:"parent,attr"`
+	GroupOwner     string     `xml:"groupOwner,attr"`
+	Chatroom       string     `xml:"chatroom,attr"`
+	ID             string     `xml:"id,attr"`
+	SenderCallsign string     `xml:"senderCallsign,attr"`
+	ChatGroup      cotChatGrp `xml:"chatgrp"`
+}
+
+type cotChatGrp struct {
+	UID0 string `xml:"uid0,attr"`
+	UID1 string `xml:"uid1,attr"`
+	ID   string `xml:"id,attr"`
+}
+
+type cotLink struct {
+	UID      string `xml:"uid,attr"`
+	Relation string `xml:"relation,attr"`
+	Type     string `xml:"type,attr"`
+}
+
+type cotRemarks struct {
+	Source string `xml:"source,attr"`
+	To     string `xml:"to,attr"`
+	Time   string `xml:"time,attr"`
+	Text   string `xml:",chardata"`
+}
+
+const (
+	cotTimeLayout  = "2006-01-02T15:04:05.000Z"
+	cotUnknown     = "9999999.0"
+	cotAllChatRoom = "All Chat Rooms"
+)
+
+// buildCoTEvent формирует CoT событие из декодированного TAKPacket или тревоги ALERT_APP.
+// Возвращает nil, если пакет не содержит PLI, GeoChat или тревогу, а также для сжатого
+// TAKPacket: позывные и текст в нем не распакованы и попали бы в ATAK мусором.
+func buildCoTEvent(record *CSVRecord) *cotEvent {
+	if record.IsAlert == "true" {
+		return buildCoTAlert(record)
+	}
+
+	tak := record.tak
+	if tak == nil || tak.GetIsCompressed() {
+		return nil
+	}
+
+	eventTime, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		eventTime = time.Now()
+	}
+	eventTime = eventTime.UTC()
+
+	uid := record.TakDeviceCallsign
+	if uid == "" {
+		uid = NodeIDFromString(record.From)
+	}
+	callsign := record.TakCallsign
+	if callsign == "" {
+		callsign = uid
+	}
+
+	event := &cotEvent{
+		Version: "2.0",
+		How:     "m-g",
+		Time:    eventTime.Format(cotTimeLayout),
+		Start:   eventTime.Format(cotTimeLayout),
+		Point:   cotPoint{Lat: "0.0", Lon: "0.0", Hae: cotUnknown, Ce: cotUnknown, Le: cotUnknown},
+	}
+
+	switch {
+	case tak.GetPli() != nil:
+		pli := tak.GetPli()
+		event.UID = uid
+		event.Type = "a-f-G-U-C"
+		event.Stale = eventTime.Add(10 * time.Minute).Format(cotTimeLayout)
+		event.Point.Lat = fmt.Sprintf("%.7f", float64(pli.GetLatitudeI())/1e7)
+		event.Point.Lon = fmt.Sprintf("%.7f", float64(pli.GetLongitudeI())/1e7)
+		event.Point.Hae = fmt.Sprintf("%d", pli.GetAltitude())
+		event.Detail.Contact = &cotContact{Callsign: callsign, Endpoint: "0.0.0.0:4242:tcp"}
+		event.Detail.UID = &cotUID{Droid: callsign}
+		event.Detail.Track = &cotTrack{Speed: pli.GetSpeed(), Course: pli.GetCourse()}
+		if tak.GetGroup() != nil {
+			event.Detail.Group = &cotGroup{Name: record.TakTeam, Role: record.TakRole}
+		}
+		if tak.GetStatus() != nil {
+			event.Detail.Status = &cotStatus{Battery: tak.GetStatus().GetBattery()}
+		}
+
+	case tak.GetChat() != nil:
+		chat := tak.GetChat()
+		chatroom := cotAllChatRoom
+		if chat.GetToCallsign() != "" {
+			chatroom = chat.GetToCallsign()
+		}
+		chatroomID := chatroom
+		if chat.GetTo() != "" && chat.GetTo() != cotAllChatRoom {
+			chatroomID = chat.GetTo()
+		}
+		event.UID = fmt.Sprintf("GeoChat.%s.%s.%s", uid, chatroomID, record.PacketID)
+		event.Type = "b-t-f"
+		event.How = "h-g-i-g-o"
+		event.Stale = eventTime.Add(24 * time.Hour).Format(cotTimeLayout)
+		event.Detail.Chat = &cotChat{
+			Parent:         "RootContactGroup",
+			GroupOwner:     "false",
+			Chatroom:       chatroom,
+			ID:             chatroomID,
+			SenderCallsign: callsign,
+			ChatGroup:      cotChatGrp{UID0: uid, UID1: chatroomID, ID: chatroomID},
+		}
+		event.Detail.Link = &cotLink{UID: uid, Relation: "p-p", Type: "a-f-G-U-C"}
+		event.Detail.Remarks = &cotRemarks{
+			Source: "BAO.F.ATAK." + uid,
+			To:     chatroomID,
+			Time:   eventTime.Format(cotTimeLayout),
+			Text:   chat.GetMessage(),
+		}
+
+	default:
+		return nil
+	}
+
+	return event
+}
+
+// buildCoTAlert превращает тревогу ALERT_APP в сообщение общего чата ATAK
+// с пометкой "[ALERT]", чтобы она не терялась среди обычных сообщений
+func buildCoTAlert(record *CSVRecord) *cotEvent {
+	eventTime, err := parseTimestamp(record.Timestamp)
+	if err != nil {
+		eventTime = time.Now()
+	}
+	eventTime = eventTime.UTC()
+	uid := NodeIDFromString(record.From)
+
+	return &cotEvent{
+		Version: "2.0",
+		UID:     fmt.Sprintf("GeoChat.%s.%s.%s", uid, cotAllChatRoom, record.PacketID),
+		Type:    "b-t-f",
+		How:     "h-g-i-g-o",
+		Time:    eventTime.Format(cotTimeLayout),
+		Start:   eventTime.Format(cotTimeLayout),
+		Stale:   eventTime.Add(24 * time.Hour).Format(cotTimeLayout),
+		Point:   cotPoint{Lat: "0.0", Lon: "0.0", Hae: cotUnknown, Ce: cotUnknown, Le: cotUnknown},
+		Detail: cotDetail{
+			Chat: &cotChat{
+				Parent:         "RootContactGroup",
+				GroupOwner:     "false",
+				Chatroom:       cotAllChatRoom,
+				ID:             cotAllChatRoom,
+				SenderCallsign: uid,
+				ChatGroup:      cotChatGrp{UID0: uid, UID1: cotAllChatRoom, ID: cotAllChatRoom},
+			},
+			Link: &cotLink{UID: uid, Relation: "p-p", Type: "a-f-G-U-C"},
+			Remarks: &cotRemarks{
+				Source: "BAO.F.ATAK." + uid,
+				To:     cotAllChatRoom,
+				Time:   eventTime.Format(cotTimeLayout),
+				Text:   "[ALERT] " + record.TextMessage,
+			},
+		},
+	}
+}
+
+// cotExporter отправляет CoT события на UDP/multicast адрес и/или пишет их в файл
+type cotExporter struct {
+	conn net.Conn
+	file *os.File
+}
+
+// newCoTExporter создает экспортер. Пустые udpAddr и filePath отключают соответствующий вывод.
+func newCoTExporter(udpAddr, filePath string) (*cotExporter, error) {
+	exporter := &cotExporter{}
+
+	if udpAddr != "" {
+		// net.Dial для UDP одинаково работает с unicast и multicast адресами (например 239.2.3.1:6969)
+		conn, err := net.Dial("udp", udpAddr)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка подключения к %s: %w", udpAddr, err)
+		}
+		exporter.conn = conn
+	}
+
+	if filePath != "" {
+		file, err := os.Create(filePath)
+		if err != nil {
+			exporter.Close()
+			return nil, fmt.Errorf("ошибка создания файла %s: %w", filePath, err)
+		}
+		exporter.file = file
+	}
+
+	return exporter, nil
+}
+
+// Export формирует CoT событие по записи и отправляет его во все настроенные выходы.
+// Записи без TAKPacket и тревоги, а также сжатые TAKPacket пропускаются.
+func (e *cotExporter) Export(record *CSVRecord) error {
+	event := buildCoTEvent(record)
+	if event == nil {
+		return nil
+	}
+
+	body, err := xml.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования CoT: %w", err)
+	}
+	data := append([]byte(xml.Header), body...)
+
+	if e.conn != nil {
+		if _, err := e.conn.Write(data); err != nil {
+			return fmt.Errorf("ошибка отправки CoT: %w", err)
+		}
+	}
+	if e.file != nil {
+		if _, err := e.file.Write(append(body, '\n')); err != nil {
+			return fmt.Errorf("ошибка записи CoT: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *cotExporter) Close() {
+	if e.conn != nil {
+		e.conn.Close()
+	}
+	if e.file != nil {
+		e.file.Close()
+	}
+}
@@ -0,0 +1,129 @@
+package decoder
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	generated "fyneMMQT/model/meshtastic"
+)
+
+func TestBuildCoTEvent(t *testing.T) {
+	contact := &generated.Contact{Callsign: "ALPHA", DeviceCallsign: "ANDROID-1"}
+	pli := &generated.TAKPacket_Pli{Pli: &generated.PLI{LatitudeI: 645391000, LongitudeI: 405162000, Altitude: 12, Speed: 3, Course: 90}}
+	tests := []struct {
+		name     string
+		tak      *generated.TAKPacket
+		record   CSVRecord
+		wantType string
+		wantUID  string
+		check    func(t *testing.T, e *cotEvent)
+	}{
+		{
+			name: "pli",
+			tak: &generated.TAKPacket{
+				Contact:        contact,
+				Group:          &generated.Group{Team: generated.Team_Dark_Blue, Role: generated.MemberRole_TeamLead},
+				Status:         &generated.Status{Battery: 77},
+				PayloadVariant: pli,
+			},
+			wantType: "a-f-G-U-C",
+			wantUID:  "ANDROID-1",
+			check: func(t *testing.T, e *cotEvent) {
+				if e.Point.Lat != "64.5391000" || e.Point.Lon != "40.5162000" || e.Point.Hae != "12" {
+					t.Errorf("point = %+v", e.Point)
+				}
+				if e.Detail.Contact == nil || e.Detail.Contact.Callsign != "ALPHA" {
+					t.Errorf("contact = %+v", e.Detail.Contact)
+				}
+				if e.Detail.Group == nil || e.Detail.Group.Name != "Dark Blue" || e.Detail.Group.Role != "Team Lead" {
+					t.Errorf("group = %+v", e.Detail.Group)
+				}
+				if e.Detail.Status == nil || e.Detail.Status.Battery != 77 {
+					t.Errorf("status = %+v", e.Detail.Status)
+				}
+				if e.Detail.Track == nil || e.Detail.Track.Speed != 3 || e.Detail.Track.Course != 90 {
+					t.Errorf("track = %+v", e.Detail.Track)
+				}
+			},
+		},
+		{
+			name: "geochat",
+			tak: &generated.TAKPacket{
+				Contact: contact,
+				PayloadVariant: &generated.TAKPacket_Chat{Chat: &generated.GeoChat{
+					Message: "на позиции", To: proto.String("ANDROID-2"), ToCallsign: proto.String("BRAVO"),
+				}},
+			},
+			wantType: "b-t-f",
+			wantUID:  "GeoChat.ANDROID-1.ANDROID-2.42",
+			check: func(t *testing.T, e *cotEvent) {
+				if e.Detail.Chat == nil || e.Detail.Chat.Chatroom != "BRAVO" || e.Detail.Chat.SenderCallsign != "ALPHA" {
+					t.Errorf("chat = %+v", e.Detail.Chat)
+				}
+				if e.Detail.Remarks == nil || e.Detail.Remarks.Text != "на позиции" || e.Detail.Remarks.To != "ANDROID-2" {
+					t.Errorf("remarks = %+v", e.Detail.Remarks)
+				}
+			},
+		},
+		{
+			name: "geochat to all",
+			tak: &generated.TAKPacket{
+				PayloadVariant: &generated.TAKPacket_Chat{Chat: &generated.GeoChat{Message: "всем"}},
+			},
+			wantType: "b-t-f",
+			wantUID:  "GeoChat.!00000001.All Chat Rooms.42",
+		},
+		{
+			name: "compressed",
+			tak:  &generated.TAKPacket{IsCompressed: true, Contact: contact, PayloadVariant: pli},
+		},
+		{
+			name: "detail",
+			tak:  &generated.TAKPacket{Contact: contact, PayloadVariant: &generated.TAKPacket_Detail{Detail: []byte("<x/>")}},
+		},
+		{
+			name:     "alert",
+			record:   CSVRecord{IsAlert: "true", TextMessage: "SOS"},
+			wantType: "b-t-f",
+			wantUID:  "GeoChat.!00000001.All Chat Rooms.42",
+			check: func(t *testing.T, e *cotEvent) {
+				if e.Detail.Remarks == nil || e.Detail.Remarks.Text != "[ALERT] SOS" {
+					t.Errorf("remarks = %+v", e.Detail.Remarks)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.record
+			record.Timestamp = "11.17.2025 12:00:00"
+			record.From = "1"
+			record.PacketID = "42"
+			if tt.tak != nil {
+				payload, err := proto.Marshal(tt.tak)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decodeTAK(payload, &record)
+			}
+
+			event := buildCoTEvent(&record)
+			if tt.wantType == "" {
+				if event != nil {
+					t.Fatalf("event = %+v, want nil", event)
+				}
+				return
+			}
+			if event == nil {
+				t.Fatal("event = nil")
+			}
+			if event.Type != tt.wantType || event.UID != tt.wantUID {
+				t.Errorf("type %q uid %q, want %q and %q", event.Type, event.UID, tt.wantType, tt.wantUID)
+			}
+			if tt.check != nil {
+				tt.check(t, event)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package decoder
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// metricSample - одно числовое показание датчика для временного ряда
+type metricSample struct {
+	Name  string
+	Value float64
+}
+
+// addMetric добавляет показание к записи для экспорта временного ряда
+func (r *CSVRecord) addMetric(name string, value float64) {
+	r.metrics = append(r.metrics, metricSample{Name: name, Value: value})
+}
+
+// telemetrySeriesWriter пишет показания Telemetry и Cayenne LPP во временной ряд
+// в "длинном" формате: одна строка на одно показание
+type telemetrySeriesWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newTelemetrySeriesWriter(path string) (*telemetrySeriesWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания файла %s: %w", path, err)
+	}
+
+	writer := csv.NewWriter(file)
+	headers := []string{"Timestamp", "From", "NodeID", "GatewayID", "Source", "Metric", "Value"}
+	if err := writer.Write(headers); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ошибка записи заголовков: %w", err)
+	}
+
+	return &telemetrySeriesWriter{file: file, writer: writer}, nil
+}
+
+// Write добавляет все показания записи, записи без показаний пропускаются
+func (w *telemetrySeriesWriter) Write(record *CSVRecord) error {
+	for _, m := range record.metrics {
+		row := []string{
+			record.Timestamp, record.From, NodeIDFromString(record.From), record.GatewayID,
+			record.PortnumName, m.Name, strconv.FormatFloat(m.Value, 'f', -1, 64),
+		}
+		if err := w.writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *telemetrySeriesWriter) Close() {
+	w.writer.Flush()
+	w.file.Close()
+}
@@ -0,0 +1,516 @@
+package decoder
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// topologyNode - узел сети с позицией и метриками связности
+type topologyNode struct {
+	ID   string
+	Name string
+	// Position - последняя известная позиция, nil если узел ее не передавал
+	Position    *geoPosition
+	Degree      int
+	Betweenness float64
+	// Articulation - без этого узла сеть распадается на части
+	Articulation bool
+	Component    int
+}
+
+// topologyEdge - неориентированная связь между двумя узлами
+type topologyEdge struct {
+	A, B         string
+	Observations int
+	// BestSNR - лучший из наблюдавшихся SNR в любом направлении
+	BestSNR string
+	Sources map[string]int
+}
+
+// topologyGraph собирает граф сети из наблюдаемых связей в записях
+type topologyGraph struct {
+	nodes map[string]*topologyNode
+	edges map[string]*topologyEdge
+	adj   map[string]map[string]bool
+
+	components [][]string
+}
+
+func newTopologyGraph() *topologyGraph {
+	return &topologyGraph{
+		nodes: make(map[string]*topologyNode),
+		edges: make(map[string]*topologyEdge),
+		adj:   make(map[string]map[string]bool),
+	}
+}
+
+func (g *topologyGraph) node(id string) *topologyNode {
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &topologyNode{ID: id}
+		g.nodes[id] = n
+		g.adj[id] = make(map[string]bool)
+	}
+	return n
+}
+
+// Observe добавляет связи записи и запоминает имя и позицию отправителя
+func (g *topologyGraph) Observe(record *CSVRecord) {
+	for _, link := range record.links {
+		g.addEdge(link)
+	}
+
+	if record.From == "" {
+		return
+	}
+	// Узлы без связей в граф не попадают, но имя и позицию запоминаем заранее
+	n := g.node(NodeIDFromString(record.From))
+	if record.UserLongName != "" {
+		n.Name = record.UserLongName
+	} else if record.MapLongName != "" && n.Name == "" {
+		n.Name = record.MapLongName
+	}
+	if pos, ok := recordPosition(record); ok {
+		n.Position = &pos
+	}
+}
+
+func (g *topologyGraph) addEdge(link nodeLink) {
+	a, b := link.From, link.To
+	if a > b {
+		a, b = b, a
+	}
+	g.node(a)
+	g.node(b)
+	g.adj[a][b] = true
+	g.adj[b][a] = true
+
+	key := a + "|" + b
+	edge, ok := g.edges[key]
+	if !ok {
+		edge = &topologyEdge{A: a, B: b, Sources: make(map[string]int)}
+		g.edges[key] = edge
+	}
+	edge.Observations++
+	edge.Sources[link.Source]++
+	if link.SNR != "" {
+		snr, err := strconv.ParseFloat(link.SNR, 64)
+		best, bestErr := strconv.ParseFloat(edge.BestSNR, 64)
+		if err == nil && (bestErr != nil || snr > best) {
+			edge.BestSNR = link.SNR
+		}
+	}
+}
+
+// connected возвращает отсортированный список узлов, у которых есть хотя бы одна связь
+func (g *topologyGraph) connected() []string {
+	var ids []string
+	for id, neighbors := range g.adj {
+		if len(neighbors) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (g *topologyGraph) sortedEdges() []*topologyEdge {
+	edges := make([]*topologyEdge, 0, len(g.edges))
+	for _, e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].A != edges[j].A {
+			return edges[i].A < edges[j].A
+		}
+		return edges[i].B < edges[j].B
+	})
+	return edges
+}
+
+func (g *topologyGraph) neighbors(id string) []string {
+	var list []string
+	for n := range g.adj[id] {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Analyze считает степень, центральность по посредничеству (алгоритм Брандеса),
+// точки сочленения (Тарьян) и компоненты связности
+func (g *topologyGraph) Analyze() {
+	ids := g.connected()
+	for _, id := range ids {
+		g.nodes[id].Degree = len(g.adj[id])
+	}
+
+	// Брандес: BFS из каждого узла и обратный проход с накоплением зависимостей
+	for _, s := range ids {
+		var stack []string
+		preds := make(map[string][]string)
+		sigma := map[string]float64{s: 1}
+		dist := map[string]int{s: 0}
+		queue := []string{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range g.neighbors(v) {
+				if _, seen := dist[w]; !seen {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+
+		delta := make(map[string]float64)
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				g.nodes[w].Betweenness += delta[w]
+			}
+		}
+	}
+	// Граф неориентированный: каждый путь учтен дважды
+	for _, id := range ids {
+		g.nodes[id].Betweenness /= 2
+	}
+
+	// Тарьян: обход в глубину с временем входа и low-link
+	disc := make(map[string]int)
+	low := make(map[string]int)
+	timer := 0
+	var visit func(v, parent string)
+	visit = func(v, parent string) {
+		timer++
+		disc[v], low[v] = timer, timer
+		children := 0
+		for _, w := range g.neighbors(v) {
+			if _, seen := disc[w]; !seen {
+				children++
+				visit(w, v)
+				low[v] = min(low[v], low[w])
+				if parent != "" && low[w] >= disc[v] {
+					g.nodes[v].Articulation = true
+				}
+			} else if w != parent {
+				low[v] = min(low[v], disc[w])
+			}
+		}
+		if parent == "" && children > 1 {
+			g.nodes[v].Articulation = true
+		}
+	}
+
+	g.components = nil
+	for _, id := range ids {
+		if _, seen := disc[id]; seen {
+			continue
+		}
+		before := make(map[string]bool, len(disc))
+		for v := range disc {
+			before[v] = true
+		}
+		visit(id, "")
+
+		var component []string
+		for v := range disc {
+			if !before[v] {
+				component = append(component, v)
+			}
+		}
+		sort.Strings(component)
+		g.components = append(g.components, component)
+	}
+
+	// Самая большая компонента первая, остальные - изолированные кластеры
+	sort.SliceStable(g.components, func(i, j int) bool {
+		return len(g.components[i]) > len(g.components[j])
+	})
+	for i, component := range g.components {
+		for _, id := range component {
+			g.nodes[id].Component = i + 1
+		}
+	}
+}
+
+// ranked возвращает узлы со связями по убыванию центральности
+func (g *topologyGraph) ranked() []*topologyNode {
+	var nodes []*topologyNode
+	for _, id := range g.connected() {
+		nodes = append(nodes, g.nodes[id])
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Betweenness > nodes[j].Betweenness
+	})
+	return nodes
+}
+
+// edgeSources выводит источники связи как "direct=3 traceroute=1"
+func edgeSources(e *topologyEdge) string {
+	var parts []string
+	for _, source := range []string{linkDirect, linkNeighborInfo, linkTraceroute} {
+		if count := e.Sources[source]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", source, count))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (n *topologyNode) label() string {
+	if n.Name == "" {
+		return n.ID
+	}
+	return n.ID + "\\n" + strings.ReplaceAll(n.Name, "\"", "'")
+}
+
+// dot формирует неориентированный граф Graphviz; точки сочленения выделены цветом
+func (g *topologyGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("graph mesh {\n  layout=neato;\n  overlap=false;\n  node [fontname=\"monospace\"];\n")
+	for _, id := range g.connected() {
+		n := g.nodes[id]
+		attrs := fmt.Sprintf("label=\"%s\\nbc %.1f\"", n.label(), n.Betweenness)
+		if n.Articulation {
+			attrs += ", style=filled, fillcolor=salmon"
+		}
+		fmt.Fprintf(&b, "  \"%s\" [%s];\n", id, attrs)
+	}
+	for _, e := range g.sortedEdges() {
+		style := "solid"
+		if e.Sources[linkDirect] == 0 && e.Sources[linkNeighborInfo] == 0 {
+			// Связь известна только из traceroute
+			style = "dashed"
+		}
+		label := e.BestSNR
+		if label != "" {
+			label += "dB"
+		}
+		fmt.Fprintf(&b, "  \"%s\" -- \"%s\" [label=\"%s\", style=%s];\n", e.A, e.B, label, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Структуры GraphML (http://graphml.graphdrawing.org/)
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (g *topologyGraph) graphML() ([]byte, error) {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "name", For: "node", AttrName: "name", AttrType: "string"},
+			{ID: "lat", For: "node", AttrName: "latitude", AttrType: "double"},
+			{ID: "lon", For: "node", AttrName: "longitude", AttrType: "double"},
+			{ID: "uncertainty", For: "node", AttrName: "position_uncertainty_m", AttrType: "double"},
+			{ID: "betweenness", For: "node", AttrName: "betweenness", AttrType: "double"},
+			{ID: "articulation", For: "node", AttrName: "articulation", AttrType: "boolean"},
+			{ID: "component", For: "node", AttrName: "component", AttrType: "int"},
+			{ID: "snr", For: "edge", AttrName: "best_snr", AttrType: "double"},
+			{ID: "observations", For: "edge", AttrName: "observations", AttrType: "int"},
+			{ID: "sources", For: "edge", AttrName: "sources", AttrType: "string"},
+		},
+		Graph: graphMLGraph{ID: "mesh", EdgeDefault: "undirected"},
+	}
+
+	for _, id := range g.connected() {
+		n := g.nodes[id]
+		node := graphMLNode{ID: id}
+		if n.Name != "" {
+			node.Data = append(node.Data, graphMLData{Key: "name", Value: n.Name})
+		}
+		if n.Position != nil {
+			node.Data = append(node.Data,
+				graphMLData{Key: "lat", Value: fmt.Sprintf("%.7f", n.Position.Lat)},
+				graphMLData{Key: "lon", Value: fmt.Sprintf("%.7f", n.Position.Lon)},
+				graphMLData{Key: "uncertainty", Value: fmt.Sprintf("%.0f", n.Position.Uncertainty)})
+		}
+		node.Data = append(node.Data,
+			graphMLData{Key: "betweenness", Value: fmt.Sprintf("%.3f", n.Betweenness)},
+			graphMLData{Key: "articulation", Value: boolToString(n.Articulation)},
+			graphMLData{Key: "component", Value: fmt.Sprintf("%d", n.Component)})
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+
+	for _, e := range g.sortedEdges() {
+		edge := graphMLEdge{Source: e.A, Target: e.B}
+		if e.BestSNR != "" {
+			edge.Data = append(edge.Data, graphMLData{Key: "snr", Value: e.BestSNR})
+		}
+		edge.Data = append(edge.Data,
+			graphMLData{Key: "observations", Value: fmt.Sprintf("%d", e.Observations)},
+			graphMLData{Key: "sources", Value: edgeSources(e)})
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	return marshalXML(doc)
+}
+
+// geoJSON выводит узлы с известной позицией как Point, а связи между ними как LineString
+func (g *topologyGraph) geoJSON() *geoFeatureCollection {
+	collection := newFeatureCollection()
+
+	for _, id := range g.connected() {
+		n := g.nodes[id]
+		if n.Position == nil {
+			continue
+		}
+		collection.Add("Point", []float64{n.Position.Lon, n.Position.Lat}, map[string]any{
+			"id":            n.ID,
+			"uncertainty_m": math.Round(n.Position.Uncertainty),
+			"name":          n.Name,
+			"degree":        n.Degree,
+			"betweenness":   n.Betweenness,
+			"articulation":  n.Articulation,
+			"component":     n.Component,
+		})
+	}
+
+	for _, e := range g.sortedEdges() {
+		a, b := g.nodes[e.A].Position, g.nodes[e.B].Position
+		if a == nil || b == nil {
+			continue
+		}
+		length, uncertainty := a.DistanceTo(*b)
+		collection.Add("LineString", [][]float64{{a.Lon, a.Lat}, {b.Lon, b.Lat}}, map[string]any{
+			"from":                 e.A,
+			"length_m":             math.Round(length),
+			"length_uncertainty_m": math.Round(uncertainty),
+			"to":                   e.B,
+			"best_snr":             e.BestSNR,
+			"observations":         e.Observations,
+			"sources":              edgeSources(e),
+		})
+	}
+	return collection
+}
+
+// Write пишет <prefix>.dot, <prefix>.graphml, <prefix>.geojson и <prefix>_nodes.csv
+func (g *topologyGraph) Write(prefix string) error {
+	if err := os.WriteFile(prefix+".dot", []byte(g.dot()), 0644); err != nil {
+		return fmt.Errorf("ошибка записи %s.dot: %w", prefix, err)
+	}
+
+	data, err := g.graphML()
+	if err != nil {
+		return fmt.Errorf("ошибка формирования GraphML: %w", err)
+	}
+	if err := os.WriteFile(prefix+".graphml", data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи %s.graphml: %w", prefix, err)
+	}
+
+	if err := g.geoJSON().WriteFile(prefix + ".geojson"); err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Node", "Name", "Latitude", "Longitude", "PositionUncertainty", "Degree", "Betweenness",
+		"Articulation", "Component", "ComponentSize"}}
+	for _, n := range g.ranked() {
+		lat, lon, uncertainty := "", "", ""
+		if n.Position != nil {
+			lat, lon = fmt.Sprintf("%.7f", n.Position.Lat), fmt.Sprintf("%.7f", n.Position.Lon)
+			uncertainty = fmt.Sprintf("%.0f", n.Position.Uncertainty)
+		}
+		rows = append(rows, []string{n.ID, n.Name, lat, lon, uncertainty,
+			fmt.Sprintf("%d", n.Degree), fmt.Sprintf("%.3f", n.Betweenness),
+			boolToString(n.Articulation), fmt.Sprintf("%d", n.Component),
+			fmt.Sprintf("%d", len(g.components[n.Component-1]))})
+	}
+	return writeCSVFile(prefix+"_nodes.csv", rows)
+}
+
+// PrintSummary выводит главные ретрансляторы, точки сочленения и изолированные кластеры
+func (g *topologyGraph) PrintSummary() {
+	fmt.Printf("Узлов со связями: %d, связей: %d, компонент связности: %d\n",
+		len(g.connected()), len(g.edges), len(g.components))
+
+	for i, n := range g.ranked() {
+		if i == 10 || n.Betweenness == 0 {
+			break
+		}
+		fmt.Printf("  %s %s: центральность %.1f, соседей %d\n", n.ID, n.Name, n.Betweenness, n.Degree)
+	}
+
+	var critical []string
+	for _, id := range g.connected() {
+		if g.nodes[id].Articulation {
+			critical = append(critical, id)
+		}
+	}
+	if len(critical) > 0 {
+		fmt.Printf("Точки сочленения (без них сеть распадается): %s\n", strings.Join(critical, ", "))
+	}
+
+	for i, component := range g.components {
+		if i == 0 {
+			continue
+		}
+		fmt.Printf("Изолированный кластер %d: %s\n", i+1, strings.Join(component, ", "))
+	}
+}
+
+// WriteTopology строит граф сети по соседям, traceroute и прямым приемам из файла
+// захвата и пишет его в файлы с префиксом output (.dot, .graphml, .geojson, _nodes.csv)
+func WriteTopology(capturePath, output string) error {
+	graph := newTopologyGraph()
+	if err := forEachCaptureRecord(capturePath, graph.Observe); err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	graph.Analyze()
+	if err := graph.Write(output); err != nil {
+		return fmt.Errorf("ошибка записи топологии: %w", err)
+	}
+	graph.PrintSummary()
+	fmt.Printf("Топология записана: %s.dot, %s.graphml, %s.geojson, %s_nodes.csv\n",
+		output, output, output, output)
+	return nil
+}
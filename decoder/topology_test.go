@@ -0,0 +1,100 @@
+package decoder
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTopologyCriticalRelays(t *testing.T) {
+	tests := []struct {
+		name         string
+		edges        [][2]string
+		articulation []string
+		components   int
+		// центральность узла center
+		center      string
+		betweenness float64
+	}{
+		{
+			name:         "chain",
+			edges:        [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}},
+			articulation: []string{"b", "c"},
+			components:   1,
+			center:       "b", betweenness: 2,
+		},
+		{
+			name:         "star",
+			edges:        [][2]string{{"hub", "a"}, {"hub", "b"}, {"hub", "c"}},
+			articulation: []string{"hub"},
+			components:   1,
+			center:       "hub", betweenness: 3,
+		},
+		{
+			name:       "ring has no single point of failure",
+			edges:      [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}, {"d", "a"}},
+			components: 1,
+			center:     "a", betweenness: 0.5,
+		},
+		{
+			name: "two triangles joined by a bridge",
+			edges: [][2]string{
+				{"a", "b"}, {"b", "c"}, {"c", "a"},
+				{"c", "x"},
+				{"x", "y"}, {"y", "z"}, {"z", "x"},
+			},
+			articulation: []string{"c", "x"},
+			components:   1,
+			center:       "c", betweenness: 6,
+		},
+		{
+			name:       "isolated clusters",
+			edges:      [][2]string{{"a", "b"}, {"b", "c"}, {"c", "a"}, {"x", "y"}},
+			components: 2,
+			center:     "x", betweenness: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTopologyGraph()
+			for _, e := range tt.edges {
+				g.addEdge(nodeLink{From: e[0], To: e[1], Source: linkDirect})
+			}
+			g.Analyze()
+
+			var articulation []string
+			for _, id := range g.connected() {
+				if g.nodes[id].Articulation {
+					articulation = append(articulation, id)
+				}
+			}
+			if !slices.Equal(articulation, tt.articulation) {
+				t.Errorf("articulation = %v, want %v", articulation, tt.articulation)
+			}
+			if len(g.components) != tt.components {
+				t.Errorf("components = %v, want %d", g.components, tt.components)
+			}
+			if got := g.nodes[tt.center].Betweenness; got != tt.betweenness {
+				t.Errorf("betweenness(%s) = %v, want %v", tt.center, got, tt.betweenness)
+			}
+		})
+	}
+}
+
+func TestTopologyEdgeMerge(t *testing.T) {
+	g := newTopologyGraph()
+	g.addEdge(nodeLink{From: "b", To: "a", SNR: "-3.50", Source: linkDirect})
+	g.addEdge(nodeLink{From: "a", To: "b", SNR: "2.25", Source: linkTraceroute})
+	g.addEdge(nodeLink{From: "a", To: "b", SNR: "-7", Source: linkDirect})
+
+	edges := g.sortedEdges()
+	if len(edges) != 1 {
+		t.Fatalf("edges = %d, want 1", len(edges))
+	}
+	e := edges[0]
+	if e.A != "a" || e.B != "b" || e.Observations != 3 || e.BestSNR != "2.25" {
+		t.Errorf("edge = %+v", e)
+	}
+	if got := edgeSources(e); got != "direct=2 traceroute=1" {
+		t.Errorf("sources = %q", got)
+	}
+}
@@ -0,0 +1,563 @@
+package decoder
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trackPoint - одна позиция узла на треке
+type trackPoint struct {
+	Time time.Time
+	Lat  float64
+	Lon  float64
+	// Alt - высота в метрах, NaN если неизвестна
+	Alt float64
+	// PrecisionBits - точность координат из Position/MapReport, 0 или 32 - без округления
+	PrecisionBits int
+	// Uncertainty - радиус ячейки округления в метрах, координаты - ее центр
+	Uncertainty float64
+	Source      string
+
+	// Speed (м/с) и Heading (градусы) считаются по соседним точкам, NaN если неизвестны.
+	// Скорость, переданная узлом в ground_speed, имеет приоритет.
+	Speed   float64
+	Heading float64
+}
+
+// nodeTrack - упорядоченный по времени трек одного узла
+type nodeTrack struct {
+	Node   string
+	Name   string
+	Points []trackPoint
+}
+
+// trackWaypoint - метка WAYPOINT_APP
+type trackWaypoint struct {
+	ID          string
+	Name        string
+	Description string
+	From        string
+	Time        time.Time
+	Lat         float64
+	Lon         float64
+}
+
+// trackFilter ограничивает экспорт узлами и интервалом времени
+type trackFilter struct {
+	nodes        map[string]bool
+	from, to     time.Time
+	minPrecision int
+}
+
+func (f *trackFilter) accepts(node string, at time.Time, precision int) bool {
+	if len(f.nodes) > 0 && !f.nodes[node] {
+		return false
+	}
+	if !f.from.IsZero() && at.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && at.After(f.to) {
+		return false
+	}
+	return f.minPrecision == 0 || precision == 0 || precision >= f.minPrecision
+}
+
+// trackCollector собирает позиции из POSITION_APP, MapReport, ATAK PLI и Cayenne LPP
+type trackCollector struct {
+	filter    trackFilter
+	tracks    map[string]*nodeTrack
+	names     map[string]string
+	waypoints []trackWaypoint
+	seenWpt   map[string]bool
+}
+
+func newTrackCollector(filter trackFilter) *trackCollector {
+	return &trackCollector{
+		filter:  filter,
+		tracks:  make(map[string]*nodeTrack),
+		names:   make(map[string]string),
+		seenWpt: make(map[string]bool),
+	}
+}
+
+// positionTime возвращает время фиксации позиции: Position.time, если задано, иначе время приема
+func positionTime(record *CSVRecord) (time.Time, bool) {
+	if sec, err := strconv.ParseInt(record.PositionTime, 10, 64); err == nil && sec > 0 {
+		return time.Unix(sec, 0).In(captureLocation), true
+	}
+	t, err := parseTimestamp(record.Timestamp)
+	return t, err == nil
+}
+
+// Observe добавляет позицию или метку из записи
+func (c *trackCollector) Observe(record *CSVRecord) {
+	if record.From == "" {
+		return
+	}
+	node := NodeIDFromString(record.From)
+	if record.UserLongName != "" {
+		c.names[node] = record.UserLongName
+	} else if record.MapLongName != "" && c.names[node] == "" {
+		c.names[node] = record.MapLongName
+	}
+
+	at, ok := positionTime(record)
+	if !ok {
+		return
+	}
+
+	if record.WaypointID != "" {
+		lat, errLat := strconv.ParseFloat(record.Latitude, 64)
+		lon, errLon := strconv.ParseFloat(record.Longitude, 64)
+		if errLat != nil || errLon != nil {
+			return
+		}
+		// Одна и та же метка приходит через несколько шлюзов и повторяется при изменении
+		key := record.WaypointID + "|" + record.Latitude + "|" + record.Longitude + "|" + record.WaypointName
+		if c.seenWpt[key] || !c.filter.accepts(node, at, 0) {
+			return
+		}
+		c.seenWpt[key] = true
+		c.waypoints = append(c.waypoints, trackWaypoint{
+			ID: record.WaypointID, Name: record.WaypointName, Description: record.WaypointDescription,
+			From: node, Time: at, Lat: lat, Lon: lon,
+		})
+		return
+	}
+
+	pos, ok := recordPosition(record)
+	if !ok {
+		return
+	}
+	point := trackPoint{Time: at, Lat: pos.Lat, Lon: pos.Lon, Uncertainty: pos.Uncertainty,
+		Alt: math.NaN(), Speed: math.NaN(), Heading: math.NaN()}
+	if alt, err := strconv.ParseFloat(record.Altitude, 64); err == nil {
+		point.Alt = alt
+	}
+	// Скорость от GPS точнее оценки по соседним точкам
+	if speed, err := strconv.ParseFloat(record.GroundSpeed, 64); err == nil {
+		point.Speed = speed
+	}
+	switch {
+	case record.PortnumName == "POSITION_APP":
+		point.Source = "position"
+		point.PrecisionBits, _ = strconv.Atoi(record.PrecisionBits)
+	case record.MessageType == "MapReport" || record.PortnumName == "MAP_REPORT_APP":
+		point.Source = "mapreport"
+		point.PrecisionBits, _ = strconv.Atoi(record.MapPositionPrecision)
+	case record.TakVariant != "":
+		point.Source = "atak"
+	default:
+		point.Source = strings.ToLower(strings.TrimSuffix(record.PortnumName, "_APP"))
+	}
+	if !c.filter.accepts(node, at, point.PrecisionBits) {
+		return
+	}
+
+	track, ok := c.tracks[node]
+	if !ok {
+		track = &nodeTrack{Node: node}
+		c.tracks[node] = track
+	}
+	track.Points = append(track.Points, point)
+}
+
+// Tracks сортирует точки по времени, убирает повторы и считает скорость и курс
+func (c *trackCollector) Tracks() []*nodeTrack {
+	var tracks []*nodeTrack
+	for _, track := range c.tracks {
+		track.Name = c.names[track.Node]
+		sort.SliceStable(track.Points, func(i, j int) bool {
+			return track.Points[i].Time.Before(track.Points[j].Time)
+		})
+
+		// Копии через разные шлюзы и периодические отчеты стоящего узла дают одинаковые точки
+		var points []trackPoint
+		for _, p := range track.Points {
+			if n := len(points); n > 0 {
+				last := points[n-1]
+				if last.Lat == p.Lat && last.Lon == p.Lon &&
+					(last.Alt == p.Alt || math.IsNaN(last.Alt) && math.IsNaN(p.Alt)) {
+					continue
+				}
+			}
+			points = append(points, p)
+		}
+
+		for i := 1; i < len(points); i++ {
+			prev, cur := &points[i-1], &points[i]
+			// Смещение в пределах погрешности округленных позиций - не движение,
+			// а переход между ячейками: скорость и курс по нему не считаем
+			distance, uncertainty := prev.position().DistanceTo(cur.position())
+			if distance <= uncertainty {
+				continue
+			}
+			cur.Heading = bearingDegrees(prev.Lat, prev.Lon, cur.Lat, cur.Lon)
+			if dt := cur.Time.Sub(prev.Time).Seconds(); dt > 0 && math.IsNaN(cur.Speed) {
+				cur.Speed = distance / dt
+			}
+		}
+		track.Points = points
+		tracks = append(tracks, track)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].Node < tracks[j].Node
+	})
+	return tracks
+}
+
+func (p trackPoint) position() geoPosition {
+	return geoPosition{Lat: p.Lat, Lon: p.Lon, Uncertainty: p.Uncertainty}
+}
+
+// Length возвращает длину трека в метрах
+func (t *nodeTrack) Length() float64 {
+	total := 0.0
+	for i := 1; i < len(t.Points); i++ {
+		total += distanceMeters(t.Points[i-1].Lat, t.Points[i-1].Lon, t.Points[i].Lat, t.Points[i].Lon)
+	}
+	return total
+}
+
+func (t *nodeTrack) title() string {
+	if t.Name == "" {
+		return t.Node
+	}
+	return t.Node + " " + t.Name
+}
+
+// Структуры GPX 1.1 с расширением Garmin TrackPointExtension для скорости и курса
+type gpxDoc struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Version   string     `xml:"version,attr"`
+	Creator   string     `xml:"creator,attr"`
+	Xmlns     string     `xml:"xmlns,attr"`
+	XmlnsTPX  string     `xml:"xmlns:gpxtpx,attr"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Tracks    []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Desc     string       `xml:"desc,omitempty"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        string         `xml:"lat,attr"`
+	Lon        string         `xml:"lon,attr"`
+	Ele        string         `xml:"ele,omitempty"`
+	Time       string         `xml:"time,omitempty"`
+	Name       string         `xml:"name,omitempty"`
+	Desc       string         `xml:"desc,omitempty"`
+	Src        string         `xml:"src,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExt `xml:"gpxtpx:TrackPointExtension"`
+}
+
+type gpxTrackPointExt struct {
+	Speed  string `xml:"gpxtpx:speed,omitempty"`
+	Course string `xml:"gpxtpx:course,omitempty"`
+}
+
+func (c *trackCollector) gpx(tracks []*nodeTrack) ([]byte, error) {
+	doc := gpxDoc{
+		Version:  "1.1",
+		Creator:  "fyneMMQT decoder",
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsTPX: "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+	}
+	for _, w := range c.waypoints {
+		doc.Waypoints = append(doc.Waypoints, gpxPoint{
+			Lat: fmt.Sprintf("%.7f", w.Lat), Lon: fmt.Sprintf("%.7f", w.Lon),
+			Time: w.Time.UTC().Format(time.RFC3339), Name: w.Name, Desc: w.Description, Src: w.From,
+		})
+	}
+	for _, t := range tracks {
+		var seg gpxSegment
+		for _, p := range t.Points {
+			pt := gpxPoint{
+				Lat: fmt.Sprintf("%.7f", p.Lat), Lon: fmt.Sprintf("%.7f", p.Lon),
+				Time: p.Time.UTC().Format(time.RFC3339), Src: p.Source,
+			}
+			if !math.IsNaN(p.Alt) {
+				pt.Ele = fmt.Sprintf("%.0f", p.Alt)
+			}
+			if p.Uncertainty > 0 {
+				pt.Desc = fmt.Sprintf("precision_bits=%d, ±%.0f м", p.PrecisionBits, p.Uncertainty)
+			}
+			if !math.IsNaN(p.Speed) || !math.IsNaN(p.Heading) {
+				pt.Extensions = &gpxExtensions{}
+				if !math.IsNaN(p.Speed) {
+					pt.Extensions.TrackPoint.Speed = fmt.Sprintf("%.2f", p.Speed)
+				}
+				if !math.IsNaN(p.Heading) {
+					pt.Extensions.TrackPoint.Course = fmt.Sprintf("%.1f", p.Heading)
+				}
+			}
+			seg.Points = append(seg.Points, pt)
+		}
+		doc.Tracks = append(doc.Tracks, gpxTrack{Name: t.title(), Segments: []gpxSegment{seg}})
+	}
+	return marshalXML(doc)
+}
+
+// Структуры KML 2.2
+type kmlDoc struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string        `xml:"name"`
+	Description string        `xml:"description,omitempty"`
+	TimeSpan    *kmlTimeSpan  `xml:"TimeSpan,omitempty"`
+	TimeStamp   *kmlTimeStamp `xml:"TimeStamp,omitempty"`
+	Point       *kmlGeometry  `xml:"Point,omitempty"`
+	LineString  *kmlGeometry  `xml:"LineString,omitempty"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlGeometry struct {
+	AltitudeMode string `xml:"altitudeMode,omitempty"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+func kmlCoordinate(p trackPoint) string {
+	if math.IsNaN(p.Alt) {
+		return fmt.Sprintf("%.7f,%.7f", p.Lon, p.Lat)
+	}
+	return fmt.Sprintf("%.7f,%.7f,%.0f", p.Lon, p.Lat, p.Alt)
+}
+
+func (c *trackCollector) kml(tracks []*nodeTrack) ([]byte, error) {
+	doc := kmlDoc{
+		Xmlns:    "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{Name: "Meshtastic tracks"},
+	}
+	for _, t := range tracks {
+		first, last := t.Points[0], t.Points[len(t.Points)-1]
+		placemark := kmlPlacemark{
+			Name:        t.title(),
+			Description: fmt.Sprintf("точек: %d, длина: %.2f км", len(t.Points), t.Length()/1000),
+		}
+		if len(t.Points) == 1 {
+			placemark.TimeStamp = &kmlTimeStamp{When: first.Time.UTC().Format(time.RFC3339)}
+			placemark.Point = &kmlGeometry{Coordinates: kmlCoordinate(first)}
+		} else {
+			placemark.TimeSpan = &kmlTimeSpan{
+				Begin: first.Time.UTC().Format(time.RFC3339),
+				End:   last.Time.UTC().Format(time.RFC3339),
+			}
+			coords := make([]string, len(t.Points))
+			for i, p := range t.Points {
+				coords[i] = kmlCoordinate(p)
+			}
+			placemark.LineString = &kmlGeometry{AltitudeMode: "clampToGround", Coordinates: strings.Join(coords, " ")}
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, placemark)
+	}
+	for _, w := range c.waypoints {
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:        w.Name,
+			Description: strings.TrimSpace(w.Description + " (" + w.From + ")"),
+			TimeStamp:   &kmlTimeStamp{When: w.Time.UTC().Format(time.RFC3339)},
+			Point:       &kmlGeometry{Coordinates: fmt.Sprintf("%.7f,%.7f", w.Lon, w.Lat)},
+		})
+	}
+	return marshalXML(doc)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// geoJSON выводит трек узла как LineString (или Point для одной позиции) и метки как Point
+func (c *trackCollector) geoJSON(tracks []*nodeTrack) *geoFeatureCollection {
+	collection := newFeatureCollection()
+	for _, t := range tracks {
+		coords := make([][]float64, len(t.Points))
+		times := make([]string, len(t.Points))
+		uncertainties := make([]float64, len(t.Points))
+		speeds := make([]any, len(t.Points))
+		for i, p := range t.Points {
+			coords[i] = []float64{p.Lon, p.Lat}
+			if !math.IsNaN(p.Alt) {
+				coords[i] = append(coords[i], p.Alt)
+			}
+			times[i] = p.Time.UTC().Format(time.RFC3339)
+			uncertainties[i] = math.Round(p.Uncertainty)
+			if !math.IsNaN(p.Speed) {
+				speeds[i] = math.Round(p.Speed*100) / 100
+			}
+		}
+		properties := map[string]any{
+			"node":            t.Node,
+			"name":            t.Name,
+			"points":          len(t.Points),
+			"length_m":        math.Round(t.Length()),
+			"times":           times,
+			"uncertainties_m": uncertainties,
+			"speeds":          speeds,
+		}
+		if len(coords) == 1 {
+			collection.Add("Point", coords[0], properties)
+		} else {
+			collection.Add("LineString", coords, properties)
+		}
+	}
+	for _, w := range c.waypoints {
+		collection.Add("Point", []float64{w.Lon, w.Lat}, map[string]any{
+			"waypoint_id": w.ID,
+			"name":        w.Name,
+			"description": w.Description,
+			"from":        w.From,
+			"time":        w.Time.UTC().Format(time.RFC3339),
+		})
+	}
+	return collection
+}
+
+// Write пишет <prefix>.gpx, <prefix>.kml и <prefix>.geojson
+func (c *trackCollector) Write(prefix string) ([]*nodeTrack, error) {
+	tracks := c.Tracks()
+
+	data, err := c.gpx(tracks)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования GPX: %w", err)
+	}
+	if err := os.WriteFile(prefix+".gpx", data, 0644); err != nil {
+		return nil, fmt.Errorf("ошибка записи %s.gpx: %w", prefix, err)
+	}
+
+	data, err = c.kml(tracks)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования KML: %w", err)
+	}
+	if err := os.WriteFile(prefix+".kml", data, 0644); err != nil {
+		return nil, fmt.Errorf("ошибка записи %s.kml: %w", prefix, err)
+	}
+
+	return tracks, c.geoJSON(tracks).WriteFile(prefix + ".geojson")
+}
+
+// parseNodeList разбирает список узлов "!a1b2c3d4,123456" в формат "!xxxxxxxx"
+func parseNodeList(list string) (map[string]bool, error) {
+	nodes := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, "!") {
+			n, err := strconv.ParseUint(item[1:], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("неверный ID узла %q", item)
+			}
+			nodes[nodeIDFromNum(uint32(n))] = true
+			continue
+		}
+		n, err := strconv.ParseUint(item, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("неверный ID узла %q", item)
+		}
+		nodes[nodeIDFromNum(uint32(n))] = true
+	}
+	return nodes, nil
+}
+
+// parseTimeFlag разбирает границу интервала: RFC3339, "2006-01-02 15:04:05", "2006-01-02"
+// или формат меток времени захвата
+func parseTimeFlag(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, captureLocation); err == nil {
+			return t, nil
+		}
+	}
+	return parseTimestamp(value)
+}
+
+// TrackOptions - отбор точек для WriteTracks
+type TrackOptions struct {
+	// Nodes - узлы через запятую (!xxxxxxxx или десятичный номер), пусто - все
+	Nodes string
+	// From и To - границы интервала: RFC3339, "2006-01-02 15:04:05", "2006-01-02"
+	// или формат меток времени захвата
+	From, To string
+	// MinPrecision - позиции с precision_bits меньше заданного пропускаются
+	MinPrecision int
+}
+
+// WriteTracks собирает треки узлов из файла захвата и пишет их в файлы с префиксом
+// output (.gpx, .kml, .geojson)
+func WriteTracks(capturePath, output string, opts TrackOptions) error {
+	filter := trackFilter{minPrecision: opts.MinPrecision}
+	if opts.Nodes != "" {
+		nodes, err := parseNodeList(opts.Nodes)
+		if err != nil {
+			return fmt.Errorf("ошибка в списке узлов: %w", err)
+		}
+		filter.nodes = nodes
+	}
+	for _, bound := range []struct {
+		value string
+		dst   *time.Time
+	}{{opts.From, &filter.from}, {opts.To, &filter.to}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseTimeFlag(bound.value)
+		if err != nil {
+			return fmt.Errorf("неверная граница интервала: %w", err)
+		}
+		*bound.dst = t
+	}
+
+	collector := newTrackCollector(filter)
+	if err := forEachCaptureRecord(capturePath, collector.Observe); err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	tracks, err := collector.Write(output)
+	if err != nil {
+		return fmt.Errorf("ошибка записи треков: %w", err)
+	}
+	for _, t := range tracks {
+		fmt.Printf("  %s: точек %d, длина %.2f км, %s - %s\n", t.title(), len(t.Points), t.Length()/1000,
+			t.Points[0].Time.Format("2006-01-02 15:04:05"), t.Points[len(t.Points)-1].Time.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("Треков: %d, меток: %d. Записано: %s.gpx, %s.kml, %s.geojson\n",
+		len(tracks), len(collector.waypoints), output, output, output)
+	return nil
+}
@@ -0,0 +1,151 @@
+package decoder
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackCollector(t *testing.T) {
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.UTC)
+	position := func(at time.Duration, lat, speed string) CSVRecord {
+		return CSVRecord{
+			Timestamp: CaptureTimestamp(start.Add(at)), From: "1", PortnumName: "POSITION_APP",
+			Latitude: lat, Longitude: "40.5000000", GroundSpeed: speed,
+		}
+	}
+	records := []CSVRecord{
+		{Timestamp: CaptureTimestamp(start), From: "1", UserLongName: "Alpha"},
+		position(0, "64.5000000", ""),
+		// Копия через другой шлюз и точки не по порядку
+		position(0, "64.5000000", ""),
+		position(2*time.Minute, "64.5180000", ""),
+		position(time.Minute, "64.5090000", "5"),
+		{
+			Timestamp: CaptureTimestamp(start), From: "2", MessageType: "MapReport",
+			Latitude: "64.6000000", Longitude: "40.5000000", Altitude: "120",
+			MapPositionPrecision: "13", PositionUncertainty: "2000",
+		},
+		{
+			Timestamp: CaptureTimestamp(start), From: "1", WaypointID: "7", WaypointName: "Camp",
+			WaypointDescription: "base", Latitude: "64.5500000", Longitude: "40.6000000",
+		},
+	}
+	collector := newTrackCollector(trackFilter{})
+	for i := range records {
+		collector.Observe(&records[i])
+	}
+
+	prefix := filepath.Join(t.TempDir(), "tracks")
+	tracks, err := collector.Write(prefix)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(tracks) != 2 || tracks[0].title() != "!00000001 Alpha" || tracks[1].title() != "!00000002" {
+		t.Fatalf("tracks = %v", tracks)
+	}
+
+	moving := tracks[0].Points
+	if len(moving) != 3 {
+		t.Fatalf("points = %d, want 3", len(moving))
+	}
+	wantSpeed := []float64{math.NaN(), 5, distanceMeters(64.509, 40.5, 64.518, 40.5) / 60}
+	for i, p := range moving {
+		if want := wantSpeed[i]; math.IsNaN(want) != math.IsNaN(p.Speed) || math.Abs(p.Speed-want) > 0.01 {
+			t.Errorf("point %d speed = %.2f, want %.2f", i, p.Speed, want)
+		}
+	}
+	if !math.IsNaN(moving[0].Heading) || moving[2].Heading != 0 {
+		t.Errorf("heading = %.1f/%.1f, want NaN/0", moving[0].Heading, moving[2].Heading)
+	}
+
+	tests := []struct {
+		ext    string
+		points int
+		want   []string
+	}{
+		{
+			ext:    ".gpx",
+			points: 4,
+			want: []string{
+				`<name>!00000001 Alpha</name>`,
+				`<trkpt lat="64.5090000" lon="40.5000000">`,
+				`<time>2025-11-17T12:01:00Z</time>`,
+				`<gpxtpx:speed>5.00</gpxtpx:speed>`,
+				`<gpxtpx:course>0.0</gpxtpx:course>`,
+				`<ele>120</ele>`,
+				`<desc>precision_bits=13, ±2000 м</desc>`,
+				`<wpt lat="64.5500000" lon="40.6000000">`,
+				`<src>!00000001</src>`,
+			},
+		},
+		{
+			ext:    ".kml",
+			points: 0,
+			want: []string{
+				`<description>точек: 3, длина: 2.00 км</description>`,
+				`<begin>2025-11-17T12:00:00Z</begin>`,
+				`<end>2025-11-17T12:02:00Z</end>`,
+				`<coordinates>40.5000000,64.5000000 40.5000000,64.5090000 40.5000000,64.5180000</coordinates>`,
+				`<coordinates>40.5000000,64.6000000,120</coordinates>`,
+				`<when>2025-11-17T12:00:00Z</when>`,
+				`<description>base (!00000001)</description>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			data, err := os.ReadFile(prefix + tt.ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := string(data)
+			if n := strings.Count(doc, "<trkpt "); n != tt.points {
+				t.Errorf("trkpt = %d, want %d", n, tt.points)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(doc, want) {
+					t.Errorf("missing %s in:\n%s", want, doc)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackFilter(t *testing.T) {
+	start := time.Date(2025, 11, 17, 12, 0, 0, 0, time.UTC)
+	nodes, err := parseNodeList("!00000001, 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := trackFilter{nodes: nodes, from: start, to: start.Add(time.Hour), minPrecision: 16}
+
+	tests := []struct {
+		name      string
+		node      string
+		at        time.Duration
+		precision int
+		want      bool
+	}{
+		{name: "hex id", node: "!00000001", at: time.Minute, want: true},
+		{name: "decimal id", node: "!00000002", at: time.Minute, precision: 32, want: true},
+		{name: "other node", node: "!00000003", at: time.Minute},
+		{name: "before interval", node: "!00000001", at: -time.Minute},
+		{name: "after interval", node: "!00000001", at: 2 * time.Hour},
+		{name: "coarse precision", node: "!00000001", at: time.Minute, precision: 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.accepts(tt.node, start.Add(tt.at), tt.precision); got != tt.want {
+				t.Errorf("accepts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseNodeList("!zz"); err == nil {
+		t.Error("parseNodeList(!zz): want error")
+	}
+}
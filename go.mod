@@ -5,7 +5,7 @@ go 1.25.1
 require github.com/joho/godotenv v1.5.1
 
 require (
-	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/gorilla/websocket v1.5.3
 	golang.org/x/sync v0.17.0 // indirect
 	google.golang.org/protobuf v1.36.10
 )